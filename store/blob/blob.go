@@ -0,0 +1,63 @@
+// Package blob keeps files, such as product images, under keys in a local
+// directory or in an S3-compatible bucket and hands out the URLs clients
+// download them from. With a bucket, servers behind a load balancer share
+// their files and keep no state of their own.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned when no blob is stored under a key.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores blobs under keys, which are slash-separated relative
+// paths such as "products/3f2a.png"; see ValidKey.
+type BlobStore interface {
+	// Put stores the content read from r under key, replacing any blob
+	// stored there.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get returns the content stored under key, or ErrNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists reports whether a blob is stored under key.
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is
+	// not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the URL clients download key from: a public URL or, for
+	// private buckets, one signed to expire.
+	URL(key string) string
+}
+
+// ValidKey reports whether key can name a blob: a relative slash-separated
+// path whose segments are neither empty nor start with a dot, which keeps
+// keys from escaping a directory or naming hidden files.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 1024 || strings.ContainsAny(key, "\\\x00") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeKey escapes every segment of key for use in a URL path, the way S3
+// signatures expect.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = uriEncode(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// errInvalidKey is returned for keys that ValidKey rejects.
+type errInvalidKey string
+
+func (e errInvalidKey) Error() string { return "invalid blob key " + string(e) }
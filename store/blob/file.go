@@ -0,0 +1,111 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStore keeps blobs as files below a directory of the local file
+// system, which Handler serves at baseURL.
+type FileStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewFileStore returns a store that keeps its files in dir and whose URLs
+// start with baseURL, such as "/uploads".
+func NewFileStore(dir, baseURL string) *FileStore {
+	return &FileStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (s *FileStore) path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", errInvalidKey(key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the content to a temporary file first, so that a file is never
+// seen half written.
+func (s *FileStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *FileStore) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) URL(key string) string {
+	return s.baseURL + "/" + escapeKey(key)
+}
+
+// Handler serves the stored files, with the base URL stripped from the
+// request path. Keys of uploads change with their content, so clients may
+// cache them for good.
+func (s *FileStore) Handler() http.Handler {
+	files := http.FileServer(http.Dir(s.dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ValidKey(strings.TrimPrefix(r.URL.Path, "/")) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		files.ServeHTTP(w, r)
+	})
+}
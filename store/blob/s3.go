@@ -0,0 +1,187 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"store/config"
+)
+
+// S3Store keeps blobs in a bucket of Amazon S3 or of a compatible service
+// such as MinIO, talking to its REST API directly.
+type S3Store struct {
+	endpoint  *url.URL
+	bucket    string
+	pathStyle bool
+	publicURL string
+	expiry    time.Duration
+	signer    signer
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewS3Store returns a store for the bucket described by cfg, which must be
+// valid.
+func NewS3Store(cfg config.S3Config) (*S3Store, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("parse S3 endpoint: %w", err)
+	}
+	return &S3Store{
+		endpoint:  endpoint,
+		bucket:    cfg.Bucket,
+		pathStyle: cfg.PathStyle,
+		publicURL: strings.TrimSuffix(cfg.PublicURL, "/"),
+		expiry:    cfg.URLExpiry,
+		signer:    signer{accessKey: cfg.AccessKey, secretKey: cfg.SecretKey, region: cfg.Region},
+		client:    &http.Client{Timeout: time.Minute},
+		now:       time.Now,
+	}, nil
+}
+
+// bucketURL returns the URL of the bucket itself, which has no trailing
+// slash with path-style addressing.
+func (s *S3Store) bucketURL() *url.URL {
+	u := *s.endpoint
+	u.Path, u.RawPath = strings.TrimSuffix(u.Path, "/"), strings.TrimSuffix(u.EscapedPath(), "/")
+	if s.pathStyle {
+		u.Path, u.RawPath = u.Path+"/"+s.bucket, u.RawPath+"/"+uriEncode(s.bucket)
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	return &u
+}
+
+// objectURL returns the URL of key, or of the bucket itself if key is
+// empty.
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := s.bucketURL()
+	if key != "" {
+		u.Path, u.RawPath = u.Path+"/"+key, u.RawPath+"/"+escapeKey(key)
+	}
+	return u
+}
+
+// do sends a signed request for key with the optional body and returns the
+// response, which the caller must close.
+func (s *S3Store) do(ctx context.Context, method, key string, body []byte, header http.Header) (*http.Response, error) {
+	if key != "" && !ValidKey(key) {
+		return nil, errInvalidKey(key)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	s.signer.sign(req, hashHex(body), s.now())
+	return s.client.Do(req)
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	// The payload is signed, so it is read whole; images are small.
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(http.MethodPut, key, resp)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	defer resp.Body.Close()
+	return nil, responseError(http.MethodGet, key, resp)
+}
+
+func (s *S3Store) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, responseError(http.MethodHead, key, resp)
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return responseError(http.MethodDelete, key, resp)
+}
+
+// URL returns the public URL of key if the store has one, and otherwise a
+// signed URL valid for the configured expiry.
+func (s *S3Store) URL(key string) string {
+	if s.publicURL != "" {
+		return s.publicURL + "/" + escapeKey(key)
+	}
+	return s.signer.presign(http.MethodGet, s.objectURL(key), s.now(), s.expiry).String()
+}
+
+// Ping checks that the bucket exists and that the credentials are accepted.
+func (s *S3Store) Ping(ctx context.Context) error {
+	resp, err := s.do(ctx, http.MethodHead, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bucket %s: %s", s.bucket, resp.Status)
+	}
+	return nil
+}
+
+// responseError describes a failed request, with the error code S3 sent.
+func responseError(method, key string, resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return fmt.Errorf("s3 %s %s: %s: %s: %s", method, key, resp.Status, body.Code, body.Message)
+	}
+	return fmt.Errorf("s3 %s %s: %s", method, key, resp.Status)
+}
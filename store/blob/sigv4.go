@@ -0,0 +1,146 @@
+package blob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Requests to S3 are authenticated with AWS Signature Version 4:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+
+const (
+	sigAlgorithm    = "AWS4-HMAC-SHA256"
+	sigDateFormat   = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// signer signs requests to the S3 service of a region.
+type signer struct {
+	accessKey string
+	secretKey string
+	region    string
+}
+
+// sign adds the headers authenticating req, whose body hashes to
+// payloadHash, as sent at t.
+func (s signer) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format(sigDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           t.Format(sigDateFormat),
+	}
+	canonical := canonicalRequest(req.Method, req.URL, headers, signed, payloadHash)
+	signature := s.signature(canonical, t)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigAlgorithm, s.accessKey, s.scope(t), strings.Join(signed, ";"), signature))
+}
+
+// presign returns u with query parameters authenticating a request with
+// method made from t until it expires.
+func (s signer) presign(method string, u *url.URL, t time.Time, expires time.Duration) *url.URL {
+	t = t.UTC()
+	signedURL := *u
+	q := signedURL.Query()
+	q.Set("X-Amz-Algorithm", sigAlgorithm)
+	q.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(t))
+	q.Set("X-Amz-Date", t.Format(sigDateFormat))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	q.Set("X-Amz-SignedHeaders", "host")
+	signedURL.RawQuery = canonicalQuery(q)
+
+	canonical := canonicalRequest(method, &signedURL, map[string]string{"host": u.Host}, []string{"host"}, unsignedPayload)
+	signedURL.RawQuery += "&X-Amz-Signature=" + s.signature(canonical, t)
+	return &signedURL
+}
+
+func (s signer) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+func (s signer) signature(canonicalRequest string, t time.Time) string {
+	stringToSign := strings.Join([]string{sigAlgorithm, t.Format(sigDateFormat), s.scope(t), hashHex([]byte(canonicalRequest))}, "\n")
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format("20060102"))
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalRequest describes a request the way both ends of the signature
+// see it. signed lists the lower-case names of the headers to sign, sorted.
+func canonicalRequest(method string, u *url.URL, headers map[string]string, signed []string, payloadHash string) string {
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return strings.Join([]string{
+		method,
+		path,
+		canonicalQuery(u.Query()),
+		canonicalHeaders.String(),
+		strings.Join(signed, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// canonicalQuery encodes q sorted by name, escaping everything but the
+// unreserved characters of RFC 3986.
+func canonicalQuery(q url.Values) string {
+	names := make([]string, 0, len(q))
+	for name := range q {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		values := append([]string(nil), q[name]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(name)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode escapes s as S3 expects, which differs from url.QueryEscape in
+// escaping spaces as %20 and leaving ~ alone.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,137 @@
+// Package catalog moves products in bulk between the store and CSV or JSON
+// Lines files. Imports upsert products by SKU and report the problems of each
+// row; exports stream the products matching a listing query. The HTTP API and
+// the command line share it.
+package catalog
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"store/model"
+	"store/money"
+)
+
+// Format is a file format for bulk imports and exports.
+type Format string
+
+const (
+	// CSV files start with a header naming the columns of the rows below.
+	// Lists are written as one comma-separated value.
+	CSV Format = "csv"
+	// JSONL files hold one JSON object per line with the fields of Row.
+	JSONL Format = "jsonl"
+)
+
+// ParseFormat reads a format name, as used by the format parameter and the
+// extension of a file.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimPrefix(name, "."))); f {
+	case CSV, JSONL:
+		return f, nil
+	case "ndjson":
+		return JSONL, nil
+	}
+	return "", fmt.Errorf("unknown format %q; must be csv or jsonl", name)
+}
+
+// FormatOf returns the format of a body with the given Content-Type, or
+// false if it is not a bulk format.
+func FormatOf(contentType string) (Format, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return CSV, true
+	case "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+		return JSONL, true
+	}
+	return "", false
+}
+
+// ContentType is the media type exports in f are served with.
+func (f Format) ContentType() string {
+	if f == CSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/jsonl"
+}
+
+// Row is one product of a bulk file. SKU identifies the product: a row
+// updates the product with its SKU, or creates one if there is none, so
+// Read requires it. ID is optional, but a row for an existing product must
+// not contradict its ID, and a new product keeps the ID it is given.
+//
+// The HTTP API describes the products it creates and replaces with the
+// same type, so both accept the same fields under the same rules.
+type Row struct {
+	SKU    string        `json:"sku" validate:"max=64"`
+	ID     int           `json:"id" validate:"gte=0"`
+	Name   string        `json:"name" validate:"required,max=200"`
+	Price  money.Money   `json:"price" validate:"required,gt=0"`
+	Prices []money.Money `json:"prices" validate:"max=50,dive,gt=0"`
+	Image  string        `json:"image" validate:"max=255"`
+
+	Description      string       `json:"description" validate:"max=5000"`
+	Category         string       `json:"category" validate:"max=100"`
+	Brand            string       `json:"brand" validate:"max=100"`
+	Gender           model.Gender `json:"gender" validate:"omitempty,oneof=men women kids unisex"`
+	Sizes            []string     `json:"sizes" validate:"max=30,dive,required,max=20"`
+	Colors           []string     `json:"colors" validate:"max=30,dive,required,max=40"`
+	Material         string       `json:"material" validate:"max=200"`
+	CareInstructions string       `json:"careInstructions" validate:"max=2000"`
+	Tags             []string     `json:"tags" validate:"max=50,dive,required,max=50"`
+}
+
+// Columns are the CSV columns in the order exports write them. Imports
+// accept them in any order and only require sku, name and price. Prices
+// are written as an amount and a currency, such as "19.99 USD".
+var Columns = []string{
+	"sku", "id", "name", "price", "prices", "image", "description", "category", "brand",
+	"gender", "sizes", "colors", "material", "careInstructions", "tags",
+}
+
+// RowOf describes p as a row. Variants and stock are not part of bulk files.
+func RowOf(p model.Product) Row {
+	return Row{
+		SKU:              p.SKU,
+		ID:               p.ID,
+		Name:             p.Name,
+		Price:            p.Price,
+		Prices:           p.Prices,
+		Image:            p.Image,
+		Description:      p.Description,
+		Category:         p.Category,
+		Brand:            p.Brand,
+		Gender:           p.Gender,
+		Sizes:            p.Sizes,
+		Colors:           p.Colors,
+		Material:         p.Material,
+		CareInstructions: p.CareInstructions,
+		Tags:             p.Tags,
+	}
+}
+
+// Product builds the product described by the row with its lists
+// normalised.
+func (row Row) Product() model.Product {
+	p := model.Product{
+		ID:               row.ID,
+		SKU:              strings.TrimSpace(row.SKU),
+		Name:             row.Name,
+		Price:            row.Price,
+		Prices:           row.Prices,
+		Image:            row.Image,
+		Description:      row.Description,
+		Category:         row.Category,
+		Brand:            row.Brand,
+		Gender:           row.Gender,
+		Sizes:            model.NormalizeList(row.Sizes),
+		Colors:           model.NormalizeList(row.Colors),
+		Material:         row.Material,
+		CareInstructions: row.CareInstructions,
+		Tags:             model.NormalizeList(row.Tags),
+	}
+	p.ApplyDefaults()
+	return p
+}
@@ -0,0 +1,136 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"store/model"
+	"store/money"
+	"store/repository"
+)
+
+func usd(cents int64) money.Money {
+	return money.Money{Amount: cents, Currency: "USD"}
+}
+
+func TestReadCSV(t *testing.T) {
+	in := "sku,name,price,prices,sizes,id\n" +
+		"TEE-1,Tee,19.5 USD,\"18 EUR,2900 JPY\",\"S,M\",\n" +
+		"TEE-2,,19.5,,,\n" +
+		"TEE-3,Short row\n" +
+		" ,Blank,5 USD,,,\n"
+	records, err := Read(strings.NewReader(in), CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %+v", records)
+	}
+	if rec := records[0]; rec.Line != 2 || len(rec.Errors) > 0 || rec.Row.Price != usd(1950) || len(rec.Row.Prices) != 2 || rec.Row.Prices[1].String() != "2900 JPY" || !slices.Equal(rec.Row.Sizes, []string{"S", "M"}) {
+		t.Errorf("unexpected first record %+v", rec)
+	}
+	if errs := records[1].Errors; len(errs) != 2 || errs[0].Field != "price" || errs[1].Field != "name" {
+		t.Errorf("expected the price without a currency and the missing name, got %v", errs)
+	}
+	if errs := records[2].Errors; records[2].Line != 4 || len(errs) != 1 || errs[0].Field != "row" {
+		t.Errorf("expected the short row to be rejected, got %+v", records[2])
+	}
+	if errs := records[3].Errors; len(errs) != 1 || errs[0].Field != "sku" || errs[0].Message != "is required" {
+		t.Errorf("expected the blank SKU to be rejected, got %v", errs)
+	}
+
+	_, err = Read(strings.NewReader("sku,name,colour\n"), CSV)
+	if err == nil || !strings.Contains(err.Error(), `"colour" is not a known column`) || !strings.Contains(err.Error(), `must include "price"`) {
+		t.Errorf("expected header errors, got %v", err)
+	}
+}
+
+func TestImportUpsertsBySKU(t *testing.T) {
+	ctx := context.Background()
+	products := repository.NewMemoryProductRepository()
+	if err := products.Import(ctx, &model.Product{ID: 5, SKU: "TEE-1", Name: "Tee", Price: usd(1000), Image: "tee.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+
+	in := `{"sku": "TEE-1", "name": "Better Tee", "price": {"amount": "12", "currency": "USD"}, "image": "tee.jpg"}
+{"sku": "JEANS-1", "name": "Jeans", "price": {"amount": "40", "currency": "USD"}, "prices": [{"amount": "37", "currency": "EUR"}], "id": 9}
+
+{"sku": "TEE-1", "name": "Tee again", "price": {"amount": "12", "currency": "USD"}}
+{"sku": "CAP-1", "name": "Cap", "price": {"amount": "8", "currency": "USD"}, "id": 5}
+{"sku": "HAT-1", "name": "Hat", "price": {"amount": "9", "currency": "EUR"}}
+{"sku": "BAG-1", "name": "Bag", "price": {"amount": "30", "currency": "USD"}, "image": "products/other.png"}
+not json
+`
+	records, err := Read(strings.NewReader(in), JSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Import(ctx, products, "USD", records, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 1 || report.Updated != 1 || report.Failed != 5 {
+		t.Errorf("unexpected dry run %+v", report)
+	}
+	if p, _ := products.FindByID(ctx, 5); p.Name != "Tee" {
+		t.Errorf("expected a dry run not to write, got %+v", p)
+	}
+	var lines []int
+	for _, res := range report.Rows {
+		if res.Action == ActionError {
+			lines = append(lines, res.Line)
+		}
+	}
+	if !slices.Equal(lines, []int{4, 5, 6, 7, 8}) {
+		t.Errorf("expected lines 4 to 8 to fail, got %v", report.Rows)
+	}
+
+	report, err = Import(ctx, products, "USD", records, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 1 || report.Updated != 1 {
+		t.Errorf("unexpected import %+v", report)
+	}
+	if p, _ := products.FindByID(ctx, 5); p.Name != "Better Tee" || p.Image != "tee.jpg" {
+		t.Errorf("expected the tee to be updated keeping its image, got %+v", p)
+	}
+	if p, err := products.FindBySKU(ctx, "JEANS-1"); err != nil || p.ID != 9 || p.Prices[0].String() != "37.00 EUR" {
+		t.Errorf("expected the jeans to keep ID 9, got %+v, %v", p, err)
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	products := repository.NewMemoryProductRepository()
+	for i := 1; i <= exportBatch+1; i++ {
+		p := model.Product{SKU: fmt.Sprintf("SKU-%d", i), Name: "P", Price: usd(int64(i)), Prices: []money.Money{{Amount: int64(i), Currency: "EUR"}}, Tags: []string{"a", "b"}}
+		if err := products.Create(ctx, &p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, f := range []Format{CSV, JSONL} {
+		var buf bytes.Buffer
+		n, err := Export(ctx, &buf, products, repository.ProductQuery{}, f)
+		if err != nil || n != exportBatch+1 {
+			t.Fatalf("%s: exported %d, %v", f, n, err)
+		}
+		records, err := Read(&buf, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != n || records[n-1].Row.ID != n || records[n-1].Row.Price != usd(int64(n)) || !slices.Equal(records[0].Row.Tags, []string{"a", "b"}) {
+			t.Errorf("%s: unexpected records %+v ... %+v", f, records[0], records[len(records)-1])
+		}
+		report, err := Import(ctx, products, "USD", records, true)
+		if err != nil || report.Updated != n {
+			t.Errorf("%s: expected every exported row to update its product, got %+v, %v", f, report, err)
+		}
+	}
+}
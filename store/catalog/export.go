@@ -0,0 +1,100 @@
+package catalog
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"store/money"
+	"store/pagination"
+	"store/repository"
+	"store/sorting"
+)
+
+// exportBatch is how many products an export reads at a time.
+const exportBatch = 200
+
+// Export writes the products matching q to w in format f, ordered by ID,
+// and returns how many it wrote. The paging and sort order of q are
+// ignored. Products are read in batches and written as they arrive, so the
+// catalog is never held in memory; a failure therefore leaves w with the
+// rows written until then.
+func Export(ctx context.Context, w io.Writer, products repository.ProductRepository, q repository.ProductQuery, f Format) (int, error) {
+	q.Sort = sorting.Asc("id")
+	q.Skip, q.Limit, q.Cursor = 0, exportBatch, nil
+
+	var write func(Row) error
+	flush := func() error { return nil }
+	if f == CSV {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(Columns); err != nil {
+			return 0, err
+		}
+		write = func(row Row) error { return cw.Write(row.fields()) }
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	} else {
+		enc := json.NewEncoder(w)
+		write = func(row Row) error { return enc.Encode(row) }
+	}
+
+	n := 0
+	for {
+		batch, err := products.List(ctx, q)
+		if err != nil {
+			return n, err
+		}
+		for _, p := range batch {
+			if err := write(RowOf(p)); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if err := flush(); err != nil {
+			return n, err
+		}
+		if len(batch) < exportBatch {
+			return n, nil
+		}
+		q.Cursor = &pagination.Cursor{Values: repository.ProductSortValues(batch[len(batch)-1], q)}
+	}
+}
+
+// moneyList writes prices as one comma-separated value.
+func moneyList(prices []money.Money) string {
+	list := make([]string, len(prices))
+	for i, m := range prices {
+		list[i] = m.String()
+	}
+	return strings.Join(list, ",")
+}
+
+// fields returns the CSV fields of the row in the order of Columns.
+func (row Row) fields() []string {
+	id := ""
+	if row.ID != 0 {
+		id = strconv.Itoa(row.ID)
+	}
+	return []string{
+		row.SKU,
+		id,
+		row.Name,
+		row.Price.String(),
+		moneyList(row.Prices),
+		row.Image,
+		row.Description,
+		row.Category,
+		row.Brand,
+		string(row.Gender),
+		strings.Join(row.Sizes, ","),
+		strings.Join(row.Colors, ","),
+		row.Material,
+		row.CareInstructions,
+		strings.Join(row.Tags, ","),
+	}
+}
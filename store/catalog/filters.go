@@ -0,0 +1,70 @@
+package catalog
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"store/money"
+	"store/repository"
+	"store/validation"
+)
+
+// Filters reads the filters of a product listing from a query string:
+//
+//	name=jeans                 part of the name
+//	category=men               the category and its subcategories
+//	size=M&size=L or size=M,L  any of the sizes; color and brand alike
+//	minPrice=20&maxPrice=50    price range in the store currency, inclusive
+//	inStock=true               only products in stock
+//
+// The category slug is returned apart, for the caller to expand into the
+// categories below it. All invalid values are reported.
+func Filters(values url.Values) (q repository.ProductQuery, category string, errs validation.Errors) {
+	q = repository.ProductQuery{
+		Name:   values.Get("name"),
+		Sizes:  queryList(values, "size"),
+		Colors: queryList(values, "color"),
+		Brands: queryList(values, "brand"),
+	}
+
+	parseDecimal := func(field string) *money.Decimal {
+		v := strings.TrimSpace(values.Get(field))
+		if v == "" {
+			return nil
+		}
+		d, err := money.ParseDecimal(v)
+		if err != nil || d.Sign() < 0 {
+			errs = append(errs, validation.FieldError{Field: field, Message: "must be a non-negative number"})
+			return nil
+		}
+		return &d
+	}
+	q.MinPrice = parseDecimal("minPrice")
+	q.MaxPrice = parseDecimal("maxPrice")
+	if q.MinPrice != nil && q.MaxPrice != nil && q.MinPrice.Cmp(*q.MaxPrice) > 0 {
+		errs = append(errs, validation.FieldError{Field: "maxPrice", Message: "must be greater than or equal to minPrice"})
+	}
+	if v := strings.TrimSpace(values.Get("inStock")); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, validation.FieldError{Field: "inStock", Message: "must be true or false"})
+		}
+		q.InStock = &inStock
+	}
+	return q, strings.TrimSpace(values.Get("category")), errs
+}
+
+// queryList reads a query parameter that is either repeated or sent as a
+// single comma-separated value.
+func queryList(values url.Values, key string) []string {
+	var list []string
+	for _, v := range values[key] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
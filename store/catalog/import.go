@@ -0,0 +1,194 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"store/pricing"
+	"store/repository"
+)
+
+// Action is what an import does with a row.
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	// ActionError marks a row that is left out because of its Errors.
+	ActionError Action = "error"
+)
+
+// Result describes what happened, or with a dry run what would happen, to
+// one row of an import.
+type Result struct {
+	Line   int    `json:"line"`
+	SKU    string `json:"sku,omitempty"`
+	ID     int    `json:"id,omitempty"`
+	Action Action `json:"action"`
+	// Errors hold the problems of the row as "field: message".
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Report sums up an import, row by row in file order.
+type Report struct {
+	DryRun  bool     `json:"dryRun"`
+	Created int      `json:"created"`
+	Updated int      `json:"updated"`
+	Failed  int      `json:"failed"`
+	Rows    []Result `json:"rows"`
+}
+
+// fail marks the row as left out because of problems.
+func (res *Result) fail(problems ...string) {
+	res.Action = ActionError
+	res.Errors = append(res.Errors, problems...)
+}
+
+func (rep *Report) count() {
+	rep.Created, rep.Updated, rep.Failed = 0, 0, 0
+	for _, res := range rep.Rows {
+		switch res.Action {
+		case ActionCreate:
+			rep.Created++
+		case ActionUpdate:
+			rep.Updated++
+		case ActionError:
+			rep.Failed++
+		}
+	}
+}
+
+// Import upserts the rows of records by SKU: a row updates every attribute
+// of the product with its SKU but the image, and otherwise creates a
+// product. Images are uploaded to the products, so a row may only repeat
+// the image its product has. Rows with problems are reported and left
+// out; the others are imported. Prices must be in currency, the currency of
+// the store, and price lists in other currencies. With dryRun nothing is written and the
+// report tells what an import would do.
+//
+// An error is returned only when the repository fails, along with the report
+// of the rows imported until then.
+func Import(ctx context.Context, products repository.ProductRepository, currency string, records []Record, dryRun bool) (*Report, error) {
+	report := &Report{DryRun: dryRun, Rows: make([]Result, len(records))}
+	skus := map[string]int{}
+	ids := map[int]int{}
+
+	for i, rec := range records {
+		res := &report.Rows[i]
+		*res = Result{Line: rec.Line, SKU: rec.Row.SKU, ID: rec.Row.ID}
+		if len(rec.Errors) == 0 {
+			rec.Errors = pricing.CheckPrices(currency, &rec.Row.Price, rec.Row.Prices)
+		}
+		if len(rec.Errors) > 0 {
+			for _, fe := range rec.Errors {
+				res.fail(fe.Field + ": " + fe.Message)
+			}
+			continue
+		}
+		if line, ok := skus[rec.Row.SKU]; ok {
+			res.fail(fmt.Sprintf("sku: is repeated; first used on line %d", line))
+			continue
+		}
+		skus[rec.Row.SKU] = rec.Line
+
+		current, err := products.FindBySKU(ctx, rec.Row.SKU)
+		switch {
+		case err == nil:
+			res.Action = ActionUpdate
+			if rec.Row.ID != 0 && rec.Row.ID != current.ID {
+				res.fail(fmt.Sprintf("id: does not match product %d, which has this SKU", current.ID))
+			}
+			if rec.Row.Image != "" && rec.Row.Image != current.Image {
+				if len(current.Images) > 0 {
+					res.fail("image: the product has a gallery, whose first image is the cover; reorder the gallery instead")
+				} else {
+					res.fail("image: must be the current image of the product; upload a new one instead")
+				}
+			}
+			res.ID = current.ID
+		case errors.Is(err, repository.ErrNotFound):
+			res.Action = ActionCreate
+			if rec.Row.Image != "" {
+				res.fail("image: must be uploaded once the product exists")
+			}
+			if rec.Row.ID != 0 {
+				_, err := products.FindByID(ctx, rec.Row.ID)
+				if err == nil {
+					res.fail("id: is taken by a product with another SKU")
+				} else if !errors.Is(err, repository.ErrNotFound) {
+					return report, err
+				}
+			}
+		default:
+			return report, err
+		}
+		if res.ID != 0 && res.Action != ActionError {
+			if line, ok := ids[res.ID]; ok {
+				res.fail(fmt.Sprintf("id: is repeated; first used on line %d", line))
+			}
+			ids[res.ID] = rec.Line
+		}
+	}
+
+	report.count()
+	if dryRun {
+		return report, nil
+	}
+	for i, rec := range records {
+		if err := apply(ctx, products, rec.Row, &report.Rows[i]); err != nil {
+			report.count()
+			return report, fmt.Errorf("line %d: %w", rec.Line, err)
+		}
+	}
+	report.count()
+	return report, nil
+}
+
+// apply writes the row as planned in res and records the ID of a created
+// product. Conflicts found only while writing fail the row.
+func apply(ctx context.Context, products repository.ProductRepository, row Row, res *Result) error {
+	p := row.Product()
+	var err error
+	switch res.Action {
+	case ActionUpdate:
+		u := repository.ProductUpdate{
+			Name:             &p.Name,
+			Price:            &p.Price,
+			Prices:           &p.Prices,
+			Description:      &p.Description,
+			Category:         &p.Category,
+			Brand:            &p.Brand,
+			Gender:           &p.Gender,
+			Sizes:            &p.Sizes,
+			Colors:           &p.Colors,
+			Material:         &p.Material,
+			CareInstructions: &p.CareInstructions,
+			Tags:             &p.Tags,
+		}
+		err = products.Update(ctx, res.ID, u)
+	case ActionCreate:
+		if p.ID != 0 {
+			err = products.Import(ctx, &p)
+		} else {
+			err = products.Create(ctx, &p)
+		}
+		if err == nil {
+			res.ID = p.ID
+		}
+	default:
+		return nil
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		res.fail("sku: the product was deleted during the import")
+	case errors.Is(err, repository.ErrConflict) && row.ID != 0:
+		res.fail("id: the ID or the SKU is taken, possibly by a deleted product")
+	case errors.Is(err, repository.ErrConflict):
+		res.fail("sku: is taken by a deleted product")
+	case err != nil:
+		return err
+	}
+	return nil
+}
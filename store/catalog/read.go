@@ -0,0 +1,244 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"store/model"
+	"store/money"
+	"store/validation"
+)
+
+// MaxRows is the most rows a single import may hold.
+const MaxRows = 10000
+
+// Record is a row read from a file, with the line it starts on and the
+// problems found reading or validating it.
+type Record struct {
+	Line   int
+	Row    Row
+	Errors validation.Errors
+}
+
+// Read reads every row of a file in format f and validates it. Problems of
+// a single row are kept in its Record, so that the other rows can still be
+// imported. Problems of the whole file, such as an unknown CSV column, are
+// returned as validation.Errors; failures reading r are returned as they are.
+func Read(r io.Reader, f Format) ([]Record, error) {
+	var records []Record
+	var err error
+	if f == CSV {
+		records, err = readCSV(r)
+	} else {
+		records, err = readJSONL(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, validation.Errors{{Field: "rows", Message: "must contain at least one product"}}
+	}
+
+	for i := range records {
+		rec := &records[i]
+		if slices.ContainsFunc(rec.Errors, func(e validation.FieldError) bool { return e.Field == "row" }) {
+			// The row could not be read, so its fields are meaningless.
+			continue
+		}
+		rec.Row.SKU = strings.TrimSpace(rec.Row.SKU)
+		errs := validation.Struct(&rec.Row)
+		if rec.Row.SKU == "" {
+			errs = append(validation.Errors{{Field: "sku", Message: "is required"}}, errs...)
+		}
+		for _, fe := range errs {
+			if !slices.ContainsFunc(rec.Errors, func(e validation.FieldError) bool { return e.Field == fe.Field }) {
+				rec.Errors = append(rec.Errors, fe)
+			}
+		}
+	}
+	return records, nil
+}
+
+func tooManyRows() error {
+	return validation.Errors{{Field: "rows", Message: fmt.Sprintf("must contain at most %d products", MaxRows)}}
+}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, validation.Errors{{Field: "columns", Message: parseErr.Err.Error()}}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkHeader(header); err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for {
+		fields, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if len(records) == MaxRows {
+			return nil, tooManyRows()
+		}
+		if errors.As(err, &parseErr) {
+			records = append(records, Record{
+				Line:   parseErr.StartLine,
+				Errors: validation.Errors{{Field: "row", Message: parseErr.Err.Error()}},
+			})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := cr.FieldPos(0)
+		if len(fields) != len(header) {
+			records = append(records, Record{Line: line, Errors: validation.Errors{{
+				Field:   "row",
+				Message: fmt.Sprintf("has %d fields but the header has %d", len(fields), len(header)),
+			}}})
+			continue
+		}
+		rec := Record{Line: line}
+		for i, column := range header {
+			rec.Errors = append(rec.Errors, setColumn(&rec.Row, column, fields[i])...)
+		}
+		records = append(records, rec)
+	}
+}
+
+// checkHeader trims the column names of header in place and checks them.
+func checkHeader(header []string) error {
+	var errs validation.Errors
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+		switch {
+		case !slices.Contains(Columns, header[i]):
+			errs = append(errs, validation.FieldError{
+				Field:   "columns",
+				Message: fmt.Sprintf("%q is not a known column; must be one of: %s", header[i], strings.Join(Columns, ", ")),
+			})
+		case slices.Contains(header[:i], header[i]):
+			errs = append(errs, validation.FieldError{Field: "columns", Message: fmt.Sprintf("%q is listed more than once", header[i])})
+		}
+	}
+	for _, required := range []string{"sku", "name", "price"} {
+		if !slices.Contains(header, required) {
+			errs = append(errs, validation.FieldError{Field: "columns", Message: fmt.Sprintf("must include %q", required)})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// setColumn sets the field of row read from column to value. Lists are
+// comma-separated, like in multipart forms.
+func setColumn(row *Row, column, value string) validation.Errors {
+	list := func() []string {
+		if strings.TrimSpace(value) == "" {
+			return nil
+		}
+		return strings.Split(value, ",")
+	}
+	switch column {
+	case "sku":
+		row.SKU = value
+	case "id":
+		if strings.TrimSpace(value) != "" {
+			id, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return validation.Errors{{Field: "id", Message: "must be of type integer"}}
+			}
+			row.ID = id
+		}
+	case "name":
+		row.Name = value
+	case "price":
+		if strings.TrimSpace(value) != "" {
+			price, err := money.Parse(value)
+			if err != nil {
+				return validation.Errors{{Field: "price", Message: "must be an amount and a currency, such as 19.99 USD"}}
+			}
+			row.Price = price
+		}
+	case "prices":
+		var errs validation.Errors
+		row.Prices = nil
+		for i, v := range list() {
+			price, err := money.Parse(v)
+			if err != nil {
+				errs = append(errs, validation.FieldError{Field: fmt.Sprintf("prices[%d]", i), Message: "must be an amount and a currency, such as 18.50 EUR"})
+			}
+			row.Prices = append(row.Prices, price)
+		}
+		return errs
+	case "image":
+		row.Image = value
+	case "description":
+		row.Description = value
+	case "category":
+		row.Category = value
+	case "brand":
+		row.Brand = value
+	case "gender":
+		row.Gender = model.Gender(value)
+	case "sizes":
+		row.Sizes = list()
+	case "colors":
+		row.Colors = list()
+	case "material":
+		row.Material = value
+	case "careInstructions":
+		row.CareInstructions = value
+	case "tags":
+		row.Tags = list()
+	}
+	return nil
+}
+
+func readJSONL(r io.Reader) ([]Record, error) {
+	var records []Record
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			if len(records) == MaxRows {
+				return nil, tooManyRows()
+			}
+			rec := Record{Line: line}
+			var decodeErr *validation.DecodeError
+			switch err := validation.DecodeJSON(bytes.NewReader(data), &rec.Row); {
+			case errors.As(err, &decodeErr):
+				rec.Errors = validation.Errors{{Field: "row", Message: decodeErr.Message}}
+			case err != nil:
+				rec.Errors, _ = err.(validation.Errors)
+			}
+			records = append(records, rec)
+		}
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"store/catalog"
+	"store/config"
+	"store/repository"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const commandUsage = `usage:
+  store [-config file]                 serve the store
+  store [-config file] import [flags] file
+  store [-config file] export [flags]
+  store [-config file] migrate-images [flags]
+
+Run a command with -h to list its flags.`
+
+// command runs a subcommand against the database.
+type command func(ctx context.Context, db *mongo.Database) error
+
+// runCommand runs the import, export or migrate-images subcommand with args against the
+// configured database and returns the exit status.
+func runCommand(cfg *config.Config, logger *logrus.Logger, name string, args []string) int {
+	var run command
+	var err error
+	switch name {
+	case "import":
+		run, err = importCommand(cfg, args)
+	case "export":
+		run, err = exportCommand(args)
+	case "migrate-images":
+		run, err = migrateImagesCommand(cfg, args)
+	default:
+		err = usageError(fmt.Sprintf("unknown command %q\n%s", name, commandUsage))
+	}
+
+	if err == nil {
+		err = withDatabase(cfg, logger, run)
+	}
+	var usage usageError
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &usage):
+		if usage != "" {
+			fmt.Fprintln(os.Stderr, usage)
+		}
+		return 2
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// withDatabase connects to MongoDB, prepares it with prepareDatabase and
+// runs run.
+func withDatabase(cfg *config.Config, logger *logrus.Logger, run command) error {
+	client, err := connectMongoDB(cfg.Mongo, logger)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	db := client.Database(cfg.Mongo.Database)
+
+	if err := prepareDatabase(cfg, db, logger); err != nil {
+		return err
+	}
+	return run(context.Background(), db)
+}
+
+// usageError reports invalid arguments to a command. It is empty when the
+// flag package has already reported them.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// parseFlags parses args into flags, which report their own errors.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return usageError("")
+	}
+	return err
+}
+
+// errRowsFailed is returned by an import that left rows out.
+var errRowsFailed = errors.New("some rows were not imported")
+
+// commandLogOutputs sends the log lines written to stdout to stderr instead,
+// so that commands can write their output to stdout.
+func commandLogOutputs(outputs []string) []string {
+	var redirected []string
+	for _, out := range outputs {
+		if out == "stdout" {
+			out = "stderr"
+		}
+		if !slices.Contains(redirected, out) {
+			redirected = append(redirected, out)
+		}
+	}
+	return redirected
+}
+
+// importCommand upserts the products of a CSV or JSON Lines file by SKU,
+// like POST /api/v1/products/import.
+func importCommand(cfg *config.Config, args []string) (command, error) {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report what the import would do")
+	formatName := flags.String("format", "", "csv or jsonl (default: from the file extension)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: store import [-dry-run] [-format csv|jsonl] file (- for stdin)")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() != 1 {
+		return nil, usageError("import needs exactly one file; use - for stdin")
+	}
+	path := flags.Arg(0)
+	format, err := commandFormat(*formatName, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, db *mongo.Database) error {
+		return importFile(ctx, db, cfg.Pricing.Currency, path, format, *dryRun)
+	}, nil
+}
+
+// importFile imports the file at path, or stdin for -, with prices in
+// currency and prints the problems of every row and a summary.
+func importFile(ctx context.Context, db *mongo.Database, currency, path string, format catalog.Format, dryRun bool) error {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	records, err := catalog.Read(in, format)
+	if err != nil {
+		return err
+	}
+	report, err := catalog.Import(ctx, repository.NewMongoProductRepository(db), currency, records, dryRun)
+	for _, res := range report.Rows {
+		for _, problem := range res.Errors {
+			fmt.Fprintf(os.Stderr, "line %d: %s\n", res.Line, problem)
+		}
+	}
+	verb := "imported"
+	if dryRun {
+		verb = "would import"
+	}
+	fmt.Printf("%s: %d created, %d updated, %d failed\n", verb, report.Created, report.Updated, report.Failed)
+	if err == nil && report.Failed > 0 {
+		err = errRowsFailed
+	}
+	return err
+}
+
+// exportCommand writes the products matching -filter to a CSV or JSON Lines
+// file, like GET /api/v1/products/export.
+func exportCommand(args []string) (command, error) {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := flags.String("format", "", "csv or jsonl (default: from the -o extension, else csv)")
+	output := flags.String("o", "-", "file to write, or - for stdout")
+	filter := flags.String("filter", "", "listing filters as a query string, such as category=men&size=M,L")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: store export [-format csv|jsonl] [-o file] [-filter query]")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, usageError("export takes no arguments")
+	}
+	if *formatName == "" && *output == "-" {
+		*formatName = string(catalog.CSV)
+	}
+	format, err := commandFormat(*formatName, *output)
+	if err != nil {
+		return nil, err
+	}
+	values, err := url.ParseQuery(*filter)
+	if err != nil {
+		return nil, usageError(fmt.Sprintf("invalid -filter: %v", err))
+	}
+	query, slug, errs := catalog.Filters(values)
+	if len(errs) > 0 {
+		return nil, usageError(fmt.Sprintf("invalid -filter: %v", errs))
+	}
+
+	return func(ctx context.Context, db *mongo.Database) error {
+		return exportFile(ctx, db, *output, format, query, slug)
+	}, nil
+}
+
+// exportFile writes the products matching query and, unless it is empty,
+// the category slug and those below it.
+func exportFile(ctx context.Context, db *mongo.Database, path string, format catalog.Format, query repository.ProductQuery, slug string) error {
+	if slug != "" {
+		categories, err := repository.NewMongoCategoryRepository(db).List(ctx)
+		if err != nil {
+			return err
+		}
+		if query.Categories = categories.Descendants(slug); query.Categories == nil {
+			return fmt.Errorf("no category found with slug %s", slug)
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	n, err := catalog.Export(ctx, out, repository.NewMongoProductRepository(db), query, format)
+	fmt.Fprintf(os.Stderr, "exported %d products\n", n)
+	return err
+}
+
+// commandFormat returns the format named by the -format flag, or else the
+// one of the extension of path.
+func commandFormat(name, path string) (catalog.Format, error) {
+	if name == "" {
+		name = filepath.Ext(path)
+	}
+	if name == "" {
+		return "", usageError("cannot tell the format of " + path + "; use -format csv or -format jsonl")
+	}
+	format, err := catalog.ParseFormat(name)
+	if err != nil {
+		return "", usageError(err.Error())
+	}
+	return format, nil
+}
+
+// migrateImagesCommand moves the images that products name by their file in
+// the upload directory to the configured blob store and stores their keys.
+func migrateImagesCommand(cfg *config.Config, args []string) (command, error) {
+	flags := flag.NewFlagSet("migrate-images", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report what the migration would do")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: store migrate-images [-dry-run]")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, usageError("migrate-images takes no arguments")
+	}
+
+	return func(ctx context.Context, db *mongo.Database) error {
+		blobs, err := newBlobStore(cfg)
+		if err != nil {
+			return err
+		}
+		m := &imageMigration{dir: cfg.Server.UploadDir, blobs: blobs, dryRun: *dryRun, keys: map[string]string{}}
+		n, err := m.run(ctx, db.Collection("products"))
+		verb := "migrated"
+		if *dryRun {
+			verb = "would migrate"
+		}
+		fmt.Printf("%s: %d products, %d files copied\n", verb, n, m.copied)
+		return err
+	}, nil
+}
@@ -0,0 +1,503 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"store/money"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is prepended to every environment variable read by Load.
+const EnvPrefix = "STORE_"
+
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Mongo     MongoConfig     `yaml:"mongo"`
+	SMTP      SMTPConfig      `yaml:"smtp"`
+	Log       LogConfig       `yaml:"log"`
+	Inventory InventoryConfig `yaml:"inventory"`
+	Trash     TrashConfig     `yaml:"trash"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Pricing   PricingConfig   `yaml:"pricing"`
+}
+
+type ServerConfig struct {
+	Addr            string        `yaml:"addr"`
+	StaticDir       string        `yaml:"staticDir"`
+	UploadDir       string        `yaml:"uploadDir"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// RequestTimeout and MaxBodyBytes bound every API route; UploadTimeout
+	// and MaxUploadBytes replace them on routes that accept file uploads.
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+	UploadTimeout  time.Duration `yaml:"uploadTimeout"`
+	MaxBodyBytes   int64         `yaml:"maxBodyBytes"`
+	MaxUploadBytes int64         `yaml:"maxUploadBytes"`
+}
+
+type MongoConfig struct {
+	URI            string        `yaml:"uri"`
+	Database       string        `yaml:"database"`
+	ConnectTimeout time.Duration `yaml:"connectTimeout"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// InventoryConfig controls low-stock alerts. An alert is emailed to
+// AlertEmail whenever the available count of a product or variant drops to
+// LowStockThreshold or below; no alerts are sent while AlertEmail is empty.
+type InventoryConfig struct {
+	LowStockThreshold int    `yaml:"lowStockThreshold"`
+	AlertEmail        string `yaml:"alertEmail"`
+}
+
+// TrashConfig controls how long deleted products and users can be restored.
+// Every PurgeInterval, the ones deleted more than Retention ago are removed
+// for good.
+type TrashConfig struct {
+	Retention     time.Duration `yaml:"retention"`
+	PurgeInterval time.Duration `yaml:"purgeInterval"`
+}
+
+// StorageConfig selects where uploaded images are kept. Backend "local"
+// keeps them in Server.UploadDir and serves them under /uploads/; backend
+// "s3" keeps them in an S3-compatible bucket, so that several servers can
+// share them.
+type StorageConfig struct {
+	Backend string   `yaml:"backend"`
+	S3      S3Config `yaml:"s3"`
+}
+
+// S3Config describes a bucket of Amazon S3 or of a compatible service such as
+// MinIO. Endpoint is the base URL of the service, like
+// https://s3.eu-west-1.amazonaws.com or http://localhost:9000; PathStyle puts
+// the bucket in the path instead of the host name, as MinIO expects. Clients
+// download images from PublicURL followed by the key when it is set, and
+// otherwise from signed URLs that expire after URLExpiry.
+type S3Config struct {
+	Endpoint  string        `yaml:"endpoint"`
+	Region    string        `yaml:"region"`
+	Bucket    string        `yaml:"bucket"`
+	AccessKey string        `yaml:"accessKey"`
+	SecretKey string        `yaml:"secretKey"`
+	PathStyle bool          `yaml:"pathStyle"`
+	PublicURL string        `yaml:"publicUrl"`
+	URLExpiry time.Duration `yaml:"urlExpiry"`
+}
+
+// PricingConfig sets Currency, the ISO 4217 code of the currency product
+// prices are entered, filtered and sorted in. Exchange rates convert them to
+// the other currencies clients ask for.
+type PricingConfig struct {
+	Currency string `yaml:"currency"`
+}
+
+// LogConfig selects how and where log entries are written. Outputs may list
+// "stdout", "stderr" and "file"; the file sink is configured by File.
+type LogConfig struct {
+	Format  string        `yaml:"format"`
+	Level   string        `yaml:"level"`
+	Outputs []string      `yaml:"outputs"`
+	File    LogFileConfig `yaml:"file"`
+}
+
+// LogFileConfig describes the rotating log file. The file is rotated once it
+// would grow beyond MaxSizeMB or has been open for RotateEvery, whichever
+// comes first; zero disables either trigger. Only the newest MaxBackups
+// rotated files are kept, or all of them when MaxBackups is zero.
+type LogFileConfig struct {
+	Path        string        `yaml:"path"`
+	MaxSizeMB   int           `yaml:"maxSizeMB"`
+	RotateEvery time.Duration `yaml:"rotateEvery"`
+	MaxBackups  int           `yaml:"maxBackups"`
+}
+
+// Default returns the configuration used for any value that is set neither
+// in the config file nor in the environment.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:            ":8081",
+			StaticDir:       "./static",
+			UploadDir:       "./uploads",
+			ShutdownTimeout: 30 * time.Second,
+			RequestTimeout:  15 * time.Second,
+			UploadTimeout:   60 * time.Second,
+			MaxBodyBytes:    1 << 20,
+			MaxUploadBytes:  10 << 20,
+		},
+		Mongo: MongoConfig{
+			URI:            "mongodb://localhost:27017",
+			Database:       "storeDB",
+			ConnectTimeout: 10 * time.Second,
+		},
+		SMTP: SMTPConfig{
+			Host: "smtp.gmail.com",
+			Port: 587,
+		},
+		Log: LogConfig{
+			Format:  "text",
+			Level:   "info",
+			Outputs: []string{"stdout"},
+			File: LogFileConfig{
+				Path:        "./logs/store.log",
+				MaxSizeMB:   100,
+				RotateEvery: 24 * time.Hour,
+				MaxBackups:  7,
+			},
+		},
+		Inventory: InventoryConfig{
+			LowStockThreshold: 5,
+		},
+		Trash: TrashConfig{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Storage: StorageConfig{
+			Backend: "local",
+			S3: S3Config{
+				Region:    "us-east-1",
+				URLExpiry: time.Hour,
+			},
+		},
+		Pricing: PricingConfig{
+			Currency: "USD",
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the optional YAML or JSON
+// file at path and finally the STORE_* environment variables, in that order
+// of precedence. The result is validated before it is returned.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+	default:
+		return fmt.Errorf("unsupported config file extension %q", ext)
+	}
+
+	// JSON is a subset of YAML, so one decoder handles both formats and
+	// durations such as "30s" are parsed the same way in each.
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv(lookup func(string) (string, bool)) error {
+	strVars := map[string]*string{
+		"HTTP_ADDR":             &c.Server.Addr,
+		"STATIC_DIR":            &c.Server.StaticDir,
+		"UPLOAD_DIR":            &c.Server.UploadDir,
+		"MONGO_URI":             &c.Mongo.URI,
+		"MONGO_DATABASE":        &c.Mongo.Database,
+		"SMTP_HOST":             &c.SMTP.Host,
+		"SMTP_USERNAME":         &c.SMTP.Username,
+		"SMTP_PASSWORD":         &c.SMTP.Password,
+		"SMTP_FROM":             &c.SMTP.From,
+		"LOG_FORMAT":            &c.Log.Format,
+		"LOG_LEVEL":             &c.Log.Level,
+		"LOG_FILE":              &c.Log.File.Path,
+		"LOW_STOCK_ALERT_EMAIL": &c.Inventory.AlertEmail,
+		"STORAGE_BACKEND":       &c.Storage.Backend,
+		"S3_ENDPOINT":           &c.Storage.S3.Endpoint,
+		"S3_REGION":             &c.Storage.S3.Region,
+		"S3_BUCKET":             &c.Storage.S3.Bucket,
+		"S3_ACCESS_KEY":         &c.Storage.S3.AccessKey,
+		"S3_SECRET_KEY":         &c.Storage.S3.SecretKey,
+		"S3_PUBLIC_URL":         &c.Storage.S3.PublicURL,
+		"CURRENCY":              &c.Pricing.Currency,
+	}
+	listVars := map[string]*[]string{
+		"LOG_OUTPUTS": &c.Log.Outputs,
+	}
+	durationVars := map[string]*time.Duration{
+		"SHUTDOWN_TIMEOUT":      &c.Server.ShutdownTimeout,
+		"REQUEST_TIMEOUT":       &c.Server.RequestTimeout,
+		"UPLOAD_TIMEOUT":        &c.Server.UploadTimeout,
+		"MONGO_CONNECT_TIMEOUT": &c.Mongo.ConnectTimeout,
+		"LOG_ROTATE_EVERY":      &c.Log.File.RotateEvery,
+		"TRASH_RETENTION":       &c.Trash.Retention,
+		"TRASH_PURGE_INTERVAL":  &c.Trash.PurgeInterval,
+		"S3_URL_EXPIRY":         &c.Storage.S3.URLExpiry,
+	}
+	intVars := map[string]*int{
+		"SMTP_PORT":       &c.SMTP.Port,
+		"LOG_MAX_SIZE_MB": &c.Log.File.MaxSizeMB,
+		"LOG_MAX_BACKUPS": &c.Log.File.MaxBackups,
+	}
+	int64Vars := map[string]*int64{
+		"MAX_BODY_BYTES":   &c.Server.MaxBodyBytes,
+		"MAX_UPLOAD_BYTES": &c.Server.MaxUploadBytes,
+	}
+	boolVars := map[string]*bool{
+		"S3_PATH_STYLE": &c.Storage.S3.PathStyle,
+	}
+
+	var errs []error
+	for name, dst := range strVars {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			*dst = v
+		}
+	}
+	for name, dst := range listVars {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			*dst = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*dst = append(*dst, item)
+				}
+			}
+		}
+	}
+	for name, dst := range durationVars {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s%s: %w", EnvPrefix, name, err))
+				continue
+			}
+			*dst = d
+		}
+	}
+	for name, dst := range intVars {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s%s: %w", EnvPrefix, name, err))
+				continue
+			}
+			*dst = n
+		}
+	}
+	for name, dst := range int64Vars {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s%s: %w", EnvPrefix, name, err))
+				continue
+			}
+			*dst = n
+		}
+	}
+	for name, dst := range boolVars {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s%s: %w", EnvPrefix, name, err))
+				continue
+			}
+			*dst = b
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once instead of stopping at the
+// first one.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if c.Server.StaticDir == "" {
+		errs = append(errs, errors.New("server.staticDir is required"))
+	}
+	if c.Server.UploadDir == "" {
+		errs = append(errs, errors.New("server.uploadDir is required"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdownTimeout must be positive"))
+	}
+	if c.Server.RequestTimeout <= 0 {
+		errs = append(errs, errors.New("server.requestTimeout must be positive"))
+	}
+	if c.Server.UploadTimeout <= 0 {
+		errs = append(errs, errors.New("server.uploadTimeout must be positive"))
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("server.maxBodyBytes must be positive"))
+	}
+	if c.Server.MaxUploadBytes <= 0 {
+		errs = append(errs, errors.New("server.maxUploadBytes must be positive"))
+	}
+
+	if !strings.HasPrefix(c.Mongo.URI, "mongodb://") && !strings.HasPrefix(c.Mongo.URI, "mongodb+srv://") {
+		errs = append(errs, errors.New("mongo.uri must start with mongodb:// or mongodb+srv://"))
+	}
+	if c.Mongo.Database == "" {
+		errs = append(errs, errors.New("mongo.database is required"))
+	}
+	if c.Mongo.ConnectTimeout <= 0 {
+		errs = append(errs, errors.New("mongo.connectTimeout must be positive"))
+	}
+
+	if c.SMTP.Host == "" {
+		errs = append(errs, errors.New("smtp.host is required"))
+	}
+	if c.SMTP.Port <= 0 || c.SMTP.Port > 65535 {
+		errs = append(errs, fmt.Errorf("smtp.port %d is out of range", c.SMTP.Port))
+	}
+	if (c.SMTP.Username == "") != (c.SMTP.Password == "") {
+		errs = append(errs, errors.New("smtp.username and smtp.password must be set together"))
+	}
+	if c.SMTP.From != "" {
+		if _, err := mail.ParseAddress(c.SMTP.From); err != nil {
+			errs = append(errs, fmt.Errorf("smtp.from: %w", err))
+		}
+	}
+
+	errs = append(errs, c.Log.validate()...)
+
+	if c.Inventory.LowStockThreshold < 0 {
+		errs = append(errs, errors.New("inventory.lowStockThreshold must not be negative"))
+	}
+	if c.Inventory.AlertEmail != "" {
+		if _, err := mail.ParseAddress(c.Inventory.AlertEmail); err != nil {
+			errs = append(errs, fmt.Errorf("inventory.alertEmail: %w", err))
+		}
+	}
+
+	if c.Trash.Retention <= 0 {
+		errs = append(errs, errors.New("trash.retention must be positive"))
+	}
+	if c.Trash.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("trash.purgeInterval must be positive"))
+	}
+
+	errs = append(errs, c.Storage.validate()...)
+
+	if !money.Known(c.Pricing.Currency) {
+		errs = append(errs, fmt.Errorf("pricing.currency %q must be an ISO 4217 currency code, such as USD", c.Pricing.Currency))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (c LogConfig) validate() []error {
+	var errs []error
+
+	switch c.Format {
+	case "json", "text":
+	default:
+		errs = append(errs, fmt.Errorf("log.format %q must be json or text", c.Format))
+	}
+	switch strings.ToLower(c.Level) {
+	case "panic", "fatal", "error", "warn", "warning", "info", "debug", "trace":
+	default:
+		errs = append(errs, fmt.Errorf("log.level %q is not a known level", c.Level))
+	}
+
+	if len(c.Outputs) == 0 {
+		errs = append(errs, errors.New("log.outputs must list at least one output"))
+	}
+	for _, out := range c.Outputs {
+		switch out {
+		case "stdout", "stderr":
+		case "file":
+			if c.File.Path == "" {
+				errs = append(errs, errors.New("log.file.path is required when logging to a file"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("log.outputs: unknown output %q", out))
+		}
+	}
+
+	if c.File.MaxSizeMB < 0 {
+		errs = append(errs, errors.New("log.file.maxSizeMB must not be negative"))
+	}
+	if c.File.RotateEvery < 0 {
+		errs = append(errs, errors.New("log.file.rotateEvery must not be negative"))
+	}
+	if c.File.MaxBackups < 0 {
+		errs = append(errs, errors.New("log.file.maxBackups must not be negative"))
+	}
+	return errs
+}
+
+func (c StorageConfig) validate() []error {
+	switch c.Backend {
+	case "local":
+		return nil
+	case "s3":
+	default:
+		return []error{fmt.Errorf("storage.backend %q must be local or s3", c.Backend)}
+	}
+
+	var errs []error
+	if u, err := url.Parse(c.S3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, errors.New("storage.s3.endpoint must be an http or https URL"))
+	}
+	if c.S3.Region == "" {
+		errs = append(errs, errors.New("storage.s3.region is required"))
+	}
+	if c.S3.Bucket == "" {
+		errs = append(errs, errors.New("storage.s3.bucket is required"))
+	}
+	if c.S3.AccessKey == "" || c.S3.SecretKey == "" {
+		errs = append(errs, errors.New("storage.s3.accessKey and storage.s3.secretKey are required"))
+	}
+	if c.S3.PublicURL != "" {
+		if u, err := url.Parse(c.S3.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("storage.s3.publicUrl must be an http or https URL"))
+		}
+	} else if c.S3.URLExpiry < time.Second || c.S3.URLExpiry > 7*24*time.Hour {
+		// Signed URLs cannot be valid for longer than a week.
+		errs = append(errs, errors.New("storage.s3.urlExpiry must be between 1s and 168h"))
+	}
+	return errs
+}
+
+// Sender returns the address outgoing mail is sent from, falling back to the
+// SMTP login when no explicit From address is configured.
+func (c SMTPConfig) Sender() string {
+	if c.From != "" {
+		return c.From
+	}
+	return c.Username
+}
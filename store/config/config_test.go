@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.yaml")
+	file := "server:\n  addr: \":9000\"\n  shutdownTimeout: 5s\nmongo:\n  database: fileDB\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("STORE_MONGO_DATABASE", "envDB")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Server.Addr != ":9000" {
+		t.Errorf("expected addr from file, got %q", cfg.Server.Addr)
+	}
+	if cfg.Server.ShutdownTimeout != 5*time.Second {
+		t.Errorf("expected shutdown timeout 5s, got %v", cfg.Server.ShutdownTimeout)
+	}
+	if cfg.Mongo.Database != "envDB" {
+		t.Errorf("expected database from env, got %q", cfg.Mongo.Database)
+	}
+	if cfg.SMTP.Port != 587 {
+		t.Errorf("expected default SMTP port, got %d", cfg.SMTP.Port)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	if err := os.WriteFile(path, []byte(`{"smtp": {"port": 2525}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.SMTP.Port != 2525 {
+		t.Errorf("expected SMTP port 2525, got %d", cfg.SMTP.Port)
+	}
+}
+
+func TestLoadRejectsUnknownFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.yaml")
+	if err := os.WriteFile(path, []byte("server:\n  adr: \":9000\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Default()
+	cfg.Mongo.URI = "localhost:27017"
+	cfg.SMTP.Port = 0
+	cfg.SMTP.Username = "shop@example.com"
+	cfg.Inventory.LowStockThreshold = -1
+	cfg.Inventory.AlertEmail = "stock team"
+	cfg.Trash.Retention = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"mongo.uri", "smtp.port", "smtp.username", "inventory.lowStockThreshold", "inventory.alertEmail", "trash.retention"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %s, got %v", want, err)
+		}
+	}
+}
+
+func TestLoadEnvInvalidDuration(t *testing.T) {
+	t.Setenv("STORE_SHUTDOWN_TIMEOUT", "soon")
+
+	if _, err := Load(""); err == nil {
+		t.Fatal("expected error for invalid duration")
+	}
+}
+
+func TestLoadLogOutputsFromEnv(t *testing.T) {
+	t.Setenv("STORE_LOG_OUTPUTS", "stdout, file")
+	t.Setenv("STORE_LOG_FORMAT", "json")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(cfg.Log.Outputs) != 2 || cfg.Log.Outputs[0] != "stdout" || cfg.Log.Outputs[1] != "file" {
+		t.Errorf("expected outputs [stdout file], got %v", cfg.Log.Outputs)
+	}
+
+	t.Setenv("STORE_LOG_OUTPUTS", "syslog")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "syslog") {
+		t.Errorf("expected unknown output to be rejected, got %v", err)
+	}
+}
+
+func TestLoadS3StorageFromEnv(t *testing.T) {
+	t.Setenv("STORE_STORAGE_BACKEND", "s3")
+	t.Setenv("STORE_S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("STORE_S3_BUCKET", "images")
+	t.Setenv("STORE_S3_PATH_STYLE", "true")
+
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "storage.s3.accessKey") {
+		t.Fatalf("expected the missing keys to be reported, got %v", err)
+	}
+
+	t.Setenv("STORE_S3_ACCESS_KEY", "minio")
+	t.Setenv("STORE_S3_SECRET_KEY", "minio123")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if s3 := cfg.Storage.S3; !s3.PathStyle || s3.Bucket != "images" || s3.Region != "us-east-1" {
+		t.Errorf("unexpected S3 config %+v", s3)
+	}
+}
+
+func TestLoadCurrencyFromEnv(t *testing.T) {
+	t.Setenv("STORE_CURRENCY", "EUR")
+	cfg, err := Load("")
+	if err != nil || cfg.Pricing.Currency != "EUR" {
+		t.Fatalf("expected EUR, got %+v %v", cfg, err)
+	}
+
+	t.Setenv("STORE_CURRENCY", "euro")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "pricing.currency") {
+		t.Errorf("expected an unknown currency to be rejected, got %v", err)
+	}
+}
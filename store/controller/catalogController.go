@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"store/catalog"
+	"store/validation"
+	"store/view"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// importCatalog serves POST /api/v1/products/import with a CSV or JSON Lines
+// body, upserting its rows by SKU. With dryRun=true nothing is written and
+// the report tells what the import would do. Rows with problems are listed
+// in the report and skipped; the others are imported.
+func (h *ProductHandler) importCatalog(w http.ResponseWriter, r *http.Request, format catalog.Format) {
+	dryRun := false
+	if v := strings.TrimSpace(r.URL.Query().Get("dryRun")); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			rejectRequest(w, r, h.logger, validation.Errors{{Field: "dryRun", Message: "must be true or false"}})
+			return
+		}
+	}
+
+	records, err := catalog.Read(r.Body, format)
+	if err != nil {
+		rejectRequest(w, r, h.logger, err)
+		return
+	}
+
+	report, err := catalog.Import(r.Context(), h.products, h.pricing.Currency(), records, dryRun)
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action":  "import_catalog",
+			"status":  "fail",
+			"created": report.Created,
+			"updated": report.Updated,
+			"error":   err.Error(),
+		}).Error("Failed to import products")
+		view.RenderError(w, r, view.Internal(fmt.Sprintf(
+			"Failed to import products; %d were created and %d updated before the failure", report.Created, report.Updated)))
+		return
+	}
+
+	view.Render(w, r, http.StatusOK, report)
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action":  "import_catalog",
+		"status":  "success",
+		"format":  format,
+		"dryRun":  dryRun,
+		"created": report.Created,
+		"updated": report.Updated,
+		"failed":  report.Failed,
+	}).Info("Imported products")
+}
+
+// ExportProducts handles GET /api/v1/products/export. It streams every
+// product matching the filters of AllProducts, ordered by ID, as CSV
+// (format=csv, the default) or JSON Lines (format=jsonl).
+func (h *ProductHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	format := catalog.CSV
+	if v := r.URL.Query().Get("format"); v != "" {
+		var err error
+		if format, err = catalog.ParseFormat(v); err != nil {
+			rejectRequest(w, r, h.logger, validation.Errors{{Field: "format", Message: "must be csv or jsonl"}})
+			return
+		}
+	}
+
+	query, _, ok := h.productFilters(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="products.%s"`, format))
+	n, err := catalog.Export(r.Context(), w, h.products, query, format)
+	if err != nil {
+		// The status line has been sent, so the client only sees the
+		// export end early.
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action":  "export_products",
+			"status":  "fail",
+			"written": n,
+			"error":   err.Error(),
+		}).Error("Export stopped early")
+		return
+	}
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "export_products",
+		"status": "success",
+		"format": format,
+		"count":  n,
+	}).Info("Exported products")
+}
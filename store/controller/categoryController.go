@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"store/model"
+	"store/repository"
+	"store/validation"
+	"store/view"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// slugPattern allows lowercase words separated by single hyphens, such as
+// "t-shirts".
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify derives a slug from a category name, for example "Men's T-Shirts"
+// becomes "men-s-t-shirts". It returns "" for names without ASCII letters or
+// digits.
+func slugify(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// CategoryHandler serves the category tree.
+type CategoryHandler struct {
+	categories repository.CategoryRepository
+	logger     *logrus.Logger
+}
+
+func NewCategoryHandler(categories repository.CategoryRepository, logger *logrus.Logger) *CategoryHandler {
+	return &CategoryHandler{categories: categories, logger: logger}
+}
+
+// AllCategories handles GET /api/v1/categories and returns the whole tree.
+func (h *CategoryHandler) AllCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.categories.List(r.Context())
+	if err != nil {
+		h.renderCategoryError(w, r, "all_categories", "", err)
+		return
+	}
+	view.Render(w, r, http.StatusOK, categories.Tree())
+}
+
+// GetCategory handles GET /api/v1/categories/{slug} and returns the category
+// with its subcategories.
+func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+
+	categories, err := h.categories.List(r.Context())
+	if err != nil {
+		h.renderCategoryError(w, r, "get_category", slug, err)
+		return
+	}
+	node, ok := categories.Subtree(slug)
+	if !ok {
+		h.renderCategoryError(w, r, "get_category", slug, repository.ErrNotFound)
+		return
+	}
+	view.Render(w, r, http.StatusOK, node)
+}
+
+// CreateCategory handles POST /api/v1/categories. The slug is derived from
+// the name when none is sent.
+func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var req categoryRequest
+	if err := validation.DecodeJSON(r.Body, &req); err != nil {
+		rejectRequest(w, r, h.logger, err)
+		return
+	}
+	req.Slug = strings.TrimSpace(req.Slug)
+	if req.Slug == "" {
+		req.Slug = slugify(req.Name)
+	}
+
+	categories, err := h.categories.List(r.Context())
+	if err != nil {
+		h.renderCategoryError(w, r, "create_category", req.Slug, err)
+		return
+	}
+	category, ok := h.categoryFromRequest(w, r, categories, req)
+	if !ok {
+		return
+	}
+
+	if err := h.categories.Create(r.Context(), &category); err != nil {
+		h.renderCategoryError(w, r, "create_category", category.Slug, err)
+		return
+	}
+
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "create_category",
+		"status": "success",
+		"slug":   category.Slug,
+		"parent": category.Parent,
+	}).Info("Successfully created category")
+	view.Render(w, r, http.StatusCreated, category)
+}
+
+// UpdateCategory handles PUT /api/v1/categories/{slug}. The body replaces the
+// name, parent and position; the slug cannot be changed because products
+// refer to it.
+func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+
+	var req categoryRequest
+	if err := validation.DecodeJSON(r.Body, &req); err != nil {
+		rejectRequest(w, r, h.logger, err)
+		return
+	}
+	if req.Slug != "" && req.Slug != slug {
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "slug", Message: "must match the slug in the path"}})
+		return
+	}
+	req.Slug = slug
+
+	categories, err := h.categories.List(r.Context())
+	if err != nil {
+		h.renderCategoryError(w, r, "update_category", slug, err)
+		return
+	}
+	if !slices.ContainsFunc(categories, func(c model.Category) bool { return c.Slug == slug }) {
+		h.renderCategoryError(w, r, "update_category", slug, repository.ErrNotFound)
+		return
+	}
+	category, ok := h.categoryFromRequest(w, r, categories, req)
+	if !ok {
+		return
+	}
+
+	err = h.categories.Update(r.Context(), slug, repository.CategoryUpdate{
+		Name:     &category.Name,
+		Parent:   &category.Parent,
+		Position: &category.Position,
+	})
+	if err != nil {
+		h.renderCategoryError(w, r, "update_category", slug, err)
+		return
+	}
+
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "update_category",
+		"status": "success",
+		"slug":   slug,
+		"parent": category.Parent,
+	}).Info("Successfully updated category")
+	view.Render(w, r, http.StatusOK, category)
+}
+
+// DeleteCategory handles DELETE /api/v1/categories/{slug}. Categories that
+// still have subcategories cannot be deleted.
+func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+
+	categories, err := h.categories.List(r.Context())
+	if err != nil {
+		h.renderCategoryError(w, r, "delete_category", slug, err)
+		return
+	}
+	if slices.ContainsFunc(categories, func(c model.Category) bool { return c.Parent == slug }) {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "delete_category",
+			"status": "fail",
+			"slug":   slug,
+		}).Warn("Category still has subcategories")
+		view.RenderError(w, r, view.Conflict(fmt.Sprintf("Category %s still has subcategories", slug)))
+		return
+	}
+
+	if err := h.categories.Delete(r.Context(), slug); err != nil {
+		h.renderCategoryError(w, r, "delete_category", slug, err)
+		return
+	}
+
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "delete_category",
+		"status": "success",
+		"slug":   slug,
+	}).Info("Successfully deleted category")
+	view.RenderMessage(w, r, http.StatusOK, fmt.Sprintf("Category %s successfully deleted", slug))
+}
+
+// categoryFromRequest validates req against the existing categories: the
+// parent must exist and must not be the category itself or one of its
+// descendants.
+func (h *CategoryHandler) categoryFromRequest(w http.ResponseWriter, r *http.Request, categories model.Categories, req categoryRequest) (model.Category, bool) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Parent = strings.TrimSpace(req.Parent)
+
+	errs := validation.Struct(&req)
+	if !hasFieldError(errs, "slug") {
+		switch {
+		case req.Slug == "" && req.Name != "":
+			errs = append(errs, validation.FieldError{Field: "slug", Message: "is required when the name has no letters a-z or digits"})
+		case req.Slug != "" && !slugPattern.MatchString(req.Slug):
+			errs = append(errs, validation.FieldError{Field: "slug", Message: "may only contain lowercase letters, digits and single '-' between them"})
+		}
+	}
+	if req.Parent != "" && !hasFieldError(errs, "parent") {
+		switch {
+		case !slices.ContainsFunc(categories, func(c model.Category) bool { return c.Slug == req.Parent }):
+			errs = append(errs, validation.FieldError{Field: "parent", Message: "must be an existing category"})
+		case slices.Contains(categories.Descendants(req.Slug), req.Parent):
+			errs = append(errs, validation.FieldError{Field: "parent", Message: "must not be the category itself or one of its subcategories"})
+		}
+	}
+	if len(errs) > 0 {
+		rejectRequest(w, r, h.logger, errs)
+		return model.Category{}, false
+	}
+
+	return model.Category{
+		Slug:     req.Slug,
+		Name:     req.Name,
+		Parent:   req.Parent,
+		Position: req.Position,
+	}, true
+}
+
+func (h *CategoryHandler) renderCategoryError(w http.ResponseWriter, r *http.Request, action string, slug string, err error) {
+	entry := h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": action,
+		"status": "fail",
+		"slug":   slug,
+	})
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		entry.Warn("No category found")
+		view.RenderError(w, r, view.NotFound(fmt.Sprintf("No category found with slug %s", slug)))
+	case errors.Is(err, repository.ErrConflict):
+		entry.Warn("Category slug is already taken")
+		view.RenderError(w, r, view.Conflict(fmt.Sprintf("A category with slug %s already exists", slug)))
+	default:
+		entry.WithField("error", err.Error()).Error("Failed to access categories")
+		view.RenderError(w, r, view.Internal("Failed to access categories"))
+	}
+}
@@ -1,38 +1,44 @@
 package controller
 
 import (
-	"encoding/json"
 	"net/http"
 	"store/email"
+	"store/view"
+
+	"github.com/sirupsen/logrus"
 )
 
-func SendPromotionalEmail(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// EmailHandler serves the promotional email endpoint.
+type EmailHandler struct {
+	mailer email.Mailer
+	logger *logrus.Logger
+}
 
-	var requestBody map[string]string
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+func NewEmailHandler(mailer email.Mailer, logger *logrus.Logger) *EmailHandler {
+	return &EmailHandler{mailer: mailer, logger: logger}
+}
+
+func (h *EmailHandler) SendPromotionalEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		view.RenderError(w, r, view.MethodNotAllowed("POST"))
 		return
 	}
 
-	to := requestBody["to"]
-	subject := requestBody["subject"]
-	body := requestBody["body"]
-
-	if to == "" || subject == "" || body == "" {
-		http.Error(w, "Missing required fields: to, subject, or body", http.StatusBadRequest)
+	var req promotionalEmailRequest
+	if !decodeRequest(w, r, h.logger, &req) {
 		return
 	}
 
-	err := email.SendEmail("ibragimtop1@gmail.com", "emlx wxgk ajik qiyl", to, subject, body, "")
+	err := h.mailer.SendEmail(req.To, req.Subject, req.Body)
 	if err != nil {
-		http.Error(w, "Failed to send email: "+err.Error(), http.StatusInternalServerError)
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "send_promotional_email",
+			"status": "fail",
+			"error":  err.Error(),
+		}).Error("Failed to send email")
+		view.RenderError(w, r, view.Internal("Failed to send email"))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Email sent successfully"))
+	view.RenderMessage(w, r, http.StatusOK, "Email sent successfully")
 }
@@ -3,17 +3,24 @@ package controller
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"store/blob"
+	"store/images"
+	"store/repository"
 	"testing"
+
+	"github.com/sirupsen/logrus"
 )
 
 func TestCreateAndDeleteProduct(t *testing.T) {
+	products := repository.NewMemoryProductRepository()
+	h := NewProductHandler(products, repository.NewMemoryCategoryRepository(), images.NewStore(blob.NewFileStore("uploads", "/uploads")), testPricing(), testStock(products), logrus.New())
+
 	product := map[string]interface{}{
-		"id":    101,
 		"name":  "New Product",
-		"price": 99.99,
-		"image": "product_image.png",
+		"price": map[string]string{"amount": "99.99", "currency": "USD"},
 	}
 
 	data, _ := json.Marshal(product)
@@ -24,32 +31,67 @@ func TestCreateAndDeleteProduct(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(HandleProductPostRequest)
+	handler := http.HandlerFunc(h.HandleProductPostRequest)
 	handler.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusOK {
 		t.Errorf("Expected status %v, got %v", http.StatusOK, status)
 	}
 
-	var response map[string]interface{}
+	var response struct {
+		Status string `json:"status"`
+		Data   struct {
+			ID int `json:"id"`
+		} `json:"data"`
+	}
 	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
 		t.Fatalf("Failed to decode response body: %v", err)
 	}
 
-	if response["status"] != "success" {
-		t.Errorf("Expected success status, got %v", response["status"])
+	if response.Status != "success" {
+		t.Errorf("Expected success status, got %v", response.Status)
+	}
+	if response.Data.ID == 0 {
+		t.Errorf("Expected the server to assign an ID")
 	}
 
-	deleteReq, err := http.NewRequest("DELETE", "/products", bytes.NewBuffer([]byte(`{"id": 101}`)))
+	deleteReq, err := http.NewRequest("DELETE", "/products", bytes.NewBuffer([]byte(fmt.Sprintf(`{"id": %d}`, response.Data.ID))))
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	rr = httptest.NewRecorder()
-	deleteHandler := http.HandlerFunc(DeleteProductByID)
+	deleteHandler := http.HandlerFunc(h.DeleteProductByID)
 	deleteHandler.ServeHTTP(rr, deleteReq)
 
 	if status := rr.Code; status != http.StatusOK {
 		t.Errorf("Expected status %v, got %v", http.StatusOK, status)
 	}
 }
+
+func TestProductHandlersAreIndependent(t *testing.T) {
+	firstProducts, secondProducts := repository.NewMemoryProductRepository(), repository.NewMemoryProductRepository()
+	first := NewProductHandler(firstProducts, repository.NewMemoryCategoryRepository(), images.NewStore(blob.NewFileStore("uploads", "/uploads")), testPricing(), testStock(firstProducts), logrus.New())
+	second := NewProductHandler(secondProducts, repository.NewMemoryCategoryRepository(), images.NewStore(blob.NewFileStore("uploads", "/uploads")), testPricing(), testStock(secondProducts), logrus.New())
+
+	data := []byte(`{"name": "Blazer", "price": {"amount": "120", "currency": "USD"}}`)
+	req, err := http.NewRequest("POST", "/products", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	first.HandleProductPostRequest(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v", http.StatusOK, rr.Code)
+	}
+
+	getReq, err := http.NewRequest("GET", "/products", bytes.NewBuffer([]byte(`{"id": 1}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	second.GetProductByID(rr, getReq)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %v from second handler, got %v", http.StatusNotFound, rr.Code)
+	}
+}
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"store/model"
+	"store/repository"
+	"store/validation"
+	"store/view"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MaxGalleryImages is the most images the gallery of a product may hold.
+const MaxGalleryImages = 20
+
+// AddProductImages handles POST /api/v1/products/{id}/images, a multipart
+// form with one or more "image" files. They are added to the gallery at
+// "position", counted from 0, or at its end; an image the gallery already
+// holds is moved there instead. The updated product is returned.
+func (h *ProductHandler) AddProductImages(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "image", Message: "must be uploaded as multipart/form-data"}})
+		return
+	}
+	if !h.parseMultipartForm(w, r) {
+		return
+	}
+	files := r.MultipartForm.File["image"]
+	if len(files) == 0 {
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "image", Message: "is required"}})
+		return
+	}
+
+	product, err := h.products.FindByID(r.Context(), id)
+	if err != nil {
+		h.renderPatchError(w, r, id, err)
+		return
+	}
+	position := len(product.Images)
+	if v := r.PostForm.Get("position"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			rejectRequest(w, r, h.logger, validation.Errors{{Field: "position", Message: "must be a non-negative integer"}})
+			return
+		}
+		position = min(n, position)
+	}
+
+	var added []model.Image
+	discard := func() {
+		for _, img := range added {
+			h.removeImage(r, img.Key)
+		}
+	}
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			discard()
+			h.logger.WithContext(r.Context()).Error("Error retrieving image: ", err)
+			view.RenderError(w, r, view.BadRequest("Unable to retrieve image"))
+			return
+		}
+		img, ok := h.saveImage(w, r, file)
+		file.Close()
+		if !ok {
+			discard()
+			return
+		}
+		added = append(added, *img)
+	}
+
+	gallery := insertImages(product.Images, position, added)
+	if len(gallery) > MaxGalleryImages {
+		discard()
+		rejectRequest(w, r, h.logger, validation.Errors{{
+			Field:   "image",
+			Message: fmt.Sprintf("the gallery can hold at most %d images", MaxGalleryImages),
+		}})
+		return
+	}
+	h.updateGallery(w, r, product, gallery, "add_product_images")
+}
+
+// ReorderProductImages handles PUT /api/v1/products/{id}/images, which
+// sends the key of every image of the gallery in its new order. The first
+// becomes the cover.
+func (h *ProductHandler) ReorderProductImages(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+	var req imageOrderRequest
+	if !decodeRequest(w, r, h.logger, &req) {
+		return
+	}
+
+	product, err := h.products.FindByID(r.Context(), id)
+	if err != nil {
+		h.renderPatchError(w, r, id, err)
+		return
+	}
+	gallery := make([]model.Image, 0, len(req.Keys))
+	listed := make([]bool, len(product.Images))
+	for _, key := range req.Keys {
+		i := product.ImageIndex(key)
+		if i < 0 || listed[i] {
+			break
+		}
+		listed[i] = true
+		gallery = append(gallery, product.Images[i])
+	}
+	if len(gallery) != len(req.Keys) || len(gallery) != len(product.Images) {
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "keys", Message: "must list every image of the gallery once"}})
+		return
+	}
+	h.updateGallery(w, r, product, gallery, "reorder_product_images")
+}
+
+// DeleteProductImage handles DELETE /api/v1/products/{id}/images/{key...}.
+// The blobs of the image are deleted unless another product uses them.
+func (h *ProductHandler) DeleteProductImage(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+
+	product, err := h.products.FindByID(r.Context(), id)
+	if err != nil {
+		h.renderPatchError(w, r, id, err)
+		return
+	}
+	i := product.ImageIndex(key)
+	if i < 0 {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "delete_product_image",
+			"status": "fail",
+			"id":     id,
+			"image":  key,
+		}).Warn("No such image in the gallery")
+		view.RenderError(w, r, view.NotFound(fmt.Sprintf("Product %d has no image %s", id, key)))
+		return
+	}
+	h.updateGallery(w, r, product, slices.Delete(slices.Clone(product.Images), i, i+1), "delete_product_image")
+}
+
+// updateGallery stores gallery as the gallery of product, with its first
+// image as the cover, and returns the updated product. Images no longer used
+// by any product are deleted: those dropped from the gallery on success and
+// those added to it on failure.
+func (h *ProductHandler) updateGallery(w http.ResponseWriter, r *http.Request, product *model.Product, gallery []model.Image, action string) {
+	after := *product
+	after.SetImages(gallery)
+	err := h.products.Update(r.Context(), product.ID, repository.ProductUpdate{Image: &after.Image, Images: &after.Images})
+	if err != nil {
+		h.removeImages(r, after, *product)
+		h.renderPatchError(w, r, product.ID, err)
+		return
+	}
+	h.removeImages(r, *product, after)
+
+	updated, err := h.products.FindByID(r.Context(), product.ID)
+	if err != nil {
+		h.renderPatchError(w, r, product.ID, err)
+		return
+	}
+	h.images.SetURLs(updated)
+	view.Render(w, r, http.StatusOK, updated)
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": action,
+		"status": "success",
+		"id":     product.ID,
+		"images": len(gallery),
+	}).Info("Successfully updated product gallery")
+}
+
+// insertImages returns images with added inserted at position. Images of
+// added that images already holds are moved rather than repeated.
+func insertImages(images []model.Image, position int, added []model.Image) []model.Image {
+	var unique []model.Image
+	for _, img := range added {
+		if !slices.ContainsFunc(unique, func(u model.Image) bool { return u.Key == img.Key }) {
+			unique = append(unique, img)
+		}
+	}
+	var before, after []model.Image
+	for i, img := range images {
+		switch {
+		case slices.ContainsFunc(unique, func(u model.Image) bool { return u.Key == img.Key }):
+		case i < position:
+			before = append(before, img)
+		default:
+			after = append(after, img)
+		}
+	}
+	return slices.Concat(before, unique, after)
+}
+
+// withCover returns images with img in place of its cover.
+func withCover(images []model.Image, img model.Image) []model.Image {
+	gallery := []model.Image{img}
+	for _, other := range images[min(1, len(images)):] {
+		if other.Key != img.Key {
+			gallery = append(gallery, other)
+		}
+	}
+	return gallery
+}
+
+// coverFirst returns images with the image with key moved to the front, or
+// without their cover if key is empty. It returns false if key is not in
+// images.
+func coverFirst(images []model.Image, key string) ([]model.Image, bool) {
+	if key == "" {
+		return slices.Clone(images[1:]), true
+	}
+	i := slices.IndexFunc(images, func(img model.Image) bool { return img.Key == key })
+	if i < 0 {
+		return nil, false
+	}
+	return slices.Concat(images[i:i+1], images[:i], images[i+1:]), true
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"store/catalog"
+	"store/model"
+	"store/pricing"
+	"store/repository"
+	"store/validation"
+	"store/view"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ImportProducts handles POST /api/v1/products/import. A CSV or JSON Lines
+// body is imported row by row by importCatalog. A JSON body, unlike a create,
+// keeps the IDs of the products it is sent, for moving a catalog between
+// stores. Every ID is required and must be free, SKUs must be free too, and
+// images are uploaded to the products afterwards; nothing is imported unless
+// all of them are.
+func (h *ProductHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	if format, ok := catalog.FormatOf(r.Header.Get("Content-Type")); ok {
+		h.importCatalog(w, r, format)
+		return
+	}
+
+	var req productImportRequest
+	if !decodeRequest(w, r, h.logger, &req) {
+		return
+	}
+
+	var errs validation.Errors
+	seen := make(map[int]bool, len(req.Products))
+	seenSKUs := make(map[string]bool, len(req.Products))
+	for i, p := range req.Products {
+		field := fmt.Sprintf("products[%d].id", i)
+		switch {
+		case p.ID == 0:
+			errs = append(errs, validation.FieldError{Field: field, Message: "is required"})
+		case seen[p.ID]:
+			errs = append(errs, validation.FieldError{Field: field, Message: "is repeated in the import"})
+		}
+		seen[p.ID] = true
+		if sku := strings.TrimSpace(p.SKU); sku != "" {
+			if seenSKUs[sku] {
+				errs = append(errs, validation.FieldError{Field: fmt.Sprintf("products[%d].sku", i), Message: "is repeated in the import"})
+			}
+			seenSKUs[sku] = true
+		}
+		if p.Image != "" {
+			errs = append(errs, validation.FieldError{Field: fmt.Sprintf("products[%d].image", i), Message: errImageNotUploaded.Message})
+		}
+		for _, fe := range pricing.CheckPrices(h.pricing.Currency(), &p.Price, p.Prices) {
+			errs = append(errs, validation.FieldError{Field: fmt.Sprintf("products[%d].%s", i, fe.Field), Message: fe.Message})
+		}
+	}
+	if len(errs) > 0 {
+		rejectRequest(w, r, h.logger, errs)
+		return
+	}
+
+	var taken []string
+	imported := make(model.Products, len(req.Products))
+	for i, pr := range req.Products {
+		imported[i] = pr.product()
+		p := &imported[i]
+		_, err := h.products.FindByID(r.Context(), p.ID)
+		if err == nil {
+			taken = append(taken, fmt.Sprintf("ID %d", p.ID))
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			h.renderImportError(w, r, err)
+			return
+		}
+		if p.SKU == "" {
+			continue
+		}
+		_, err = h.products.FindBySKU(r.Context(), p.SKU)
+		if err == nil {
+			taken = append(taken, "SKU "+p.SKU)
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			h.renderImportError(w, r, err)
+			return
+		}
+	}
+	if len(taken) > 0 {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "import_products",
+			"status": "fail",
+			"taken":  taken,
+		}).Warn("Imported product IDs or SKUs are already taken")
+		view.RenderError(w, r, view.Conflict("Already taken: "+strings.Join(taken, ", ")+"; nothing was imported"))
+		return
+	}
+
+	ptrs := make([]*model.Product, len(imported))
+	for i := range imported {
+		ptrs[i] = &imported[i]
+	}
+	err := h.products.Import(r.Context(), ptrs...)
+	if errors.Is(err, repository.ErrConflict) {
+		// An ID or SKU belongs to a product in the trash, which the checks
+		// above cannot see, or another request took it since.
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "import_products",
+			"status": "fail",
+		}).Warn("Imported product IDs or SKUs are already taken")
+		view.RenderError(w, r, view.Conflict("An ID or SKU is taken, possibly by a deleted product; nothing was imported"))
+		return
+	}
+	if err != nil {
+		h.renderImportError(w, r, err)
+		return
+	}
+
+	view.Render(w, r, http.StatusCreated, imported)
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "import_products",
+		"status": "success",
+		"count":  len(imported),
+	}).Info("Imported products")
+}
+
+func (h *ProductHandler) renderImportError(w http.ResponseWriter, r *http.Request, err error) {
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "import_products",
+		"status": "fail",
+		"error":  err.Error(),
+	}).Error("Failed to import products")
+	view.RenderError(w, r, view.Internal("Failed to import products"))
+}
@@ -4,7 +4,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"store/blob"
+	"store/images"
+	"store/repository"
 	"testing"
+
+	"github.com/sirupsen/logrus"
 )
 
 func TestAllProducts(t *testing.T) {
@@ -13,10 +18,11 @@ func TestAllProducts(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	InitializeProduct(client)
+	products := repository.NewMemoryProductRepository()
+	h := NewProductHandler(products, repository.NewMemoryCategoryRepository(), images.NewStore(blob.NewFileStore("uploads", "/uploads")), testPricing(), testStock(products), logrus.New())
 
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(AllProducts)
+	handler := http.HandlerFunc(h.AllProducts)
 	handler.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusOK {
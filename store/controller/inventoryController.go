@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"store/inventory"
+	"store/model"
+	"store/repository"
+	"store/validation"
+	"store/view"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// InventoryHandler serves the stock levels of products and their variants.
+// Stock is kept per SKU for products with variants and per product otherwise.
+type InventoryHandler struct {
+	products  repository.ProductRepository
+	inventory *inventory.Service
+	logger    *logrus.Logger
+}
+
+func NewInventoryHandler(products repository.ProductRepository, inventory *inventory.Service, logger *logrus.Logger) *InventoryHandler {
+	return &InventoryHandler{products: products, inventory: inventory, logger: logger}
+}
+
+// GetInventory handles GET /api/v1/products/{id}/inventory.
+func (h *InventoryHandler) GetInventory(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+	if _, err := h.products.FindByID(r.Context(), id); err != nil {
+		h.renderInventoryError(w, r, "get_inventory", id, "", err)
+		return
+	}
+
+	levels, err := h.inventory.Levels(r.Context(), id)
+	if err != nil {
+		h.renderInventoryError(w, r, "get_inventory", id, "", err)
+		return
+	}
+	view.Render(w, r, http.StatusOK, levels)
+}
+
+// InventoryHistory handles GET /api/v1/products/{id}/inventory/history. The
+// optional sku query parameter limits the history to one variant.
+func (h *InventoryHandler) InventoryHistory(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+	sku := strings.TrimSpace(r.URL.Query().Get("sku"))
+	if _, err := h.products.FindByID(r.Context(), id); err != nil {
+		h.renderInventoryError(w, r, "get_inventory_history", id, sku, err)
+		return
+	}
+
+	history, err := h.inventory.History(r.Context(), id, sku)
+	if err != nil {
+		h.renderInventoryError(w, r, "get_inventory_history", id, sku, err)
+		return
+	}
+	view.Render(w, r, http.StatusOK, history)
+}
+
+// AdjustInventory handles POST /api/v1/products/{id}/inventory/adjustments.
+// A positive delta adds units on hand, a negative one removes them.
+func (h *InventoryHandler) AdjustInventory(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+	var req stockAdjustmentRequest
+	if !decodeRequest(w, r, h.logger, &req) {
+		return
+	}
+	req.SKU = strings.TrimSpace(req.SKU)
+	if !h.checkSKU(w, r, "adjust_inventory", id, req.SKU) {
+		return
+	}
+
+	level, err := h.inventory.Adjust(r.Context(), id, req.SKU, req.Delta, strings.TrimSpace(req.Reason))
+	if err != nil {
+		h.renderInventoryError(w, r, "adjust_inventory", id, req.SKU, err)
+		return
+	}
+
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "adjust_inventory",
+		"status": "success",
+		"id":     id,
+		"sku":    req.SKU,
+		"delta":  req.Delta,
+		"reason": req.Reason,
+	}).Info("Successfully adjusted inventory")
+	view.Render(w, r, http.StatusOK, level)
+}
+
+// ReserveInventory handles POST /api/v1/products/{id}/inventory/reservations.
+func (h *InventoryHandler) ReserveInventory(w http.ResponseWriter, r *http.Request) {
+	h.changeStock(w, r, "reserve_inventory", h.inventory.Reserve)
+}
+
+// ReleaseInventory handles POST /api/v1/products/{id}/inventory/releases.
+func (h *InventoryHandler) ReleaseInventory(w http.ResponseWriter, r *http.Request) {
+	h.changeStock(w, r, "release_inventory", h.inventory.Release)
+}
+
+// CommitInventory handles POST /api/v1/products/{id}/inventory/commits.
+func (h *InventoryHandler) CommitInventory(w http.ResponseWriter, r *http.Request) {
+	h.changeStock(w, r, "commit_inventory", h.inventory.Commit)
+}
+
+type stockChange func(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error)
+
+func (h *InventoryHandler) changeStock(w http.ResponseWriter, r *http.Request, action string, change stockChange) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+	var req stockQuantityRequest
+	if !decodeRequest(w, r, h.logger, &req) {
+		return
+	}
+	req.SKU = strings.TrimSpace(req.SKU)
+	if !h.checkSKU(w, r, action, id, req.SKU) {
+		return
+	}
+
+	level, err := change(r.Context(), id, req.SKU, req.Quantity)
+	if err != nil {
+		h.renderInventoryError(w, r, action, id, req.SKU, err)
+		return
+	}
+
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action":   action,
+		"status":   "success",
+		"id":       id,
+		"sku":      req.SKU,
+		"quantity": req.Quantity,
+	}).Info("Successfully changed inventory")
+	view.Render(w, r, http.StatusOK, level)
+}
+
+// checkSKU makes sure sku names one of the product's variants, or is empty
+// when the product has none.
+func (h *InventoryHandler) checkSKU(w http.ResponseWriter, r *http.Request, action string, id int, sku string) bool {
+	product, err := h.products.FindByID(r.Context(), id)
+	if err != nil {
+		h.renderInventoryError(w, r, action, id, "", err)
+		return false
+	}
+
+	switch {
+	case len(product.Variants) == 0 && sku != "":
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "sku", Message: "must be empty for a product without variants"}})
+		return false
+	case len(product.Variants) > 0 && sku == "":
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "sku", Message: "is required for a product with variants"}})
+		return false
+	case sku != "":
+		if _, ok := product.Variant(sku); !ok {
+			h.renderInventoryError(w, r, action, id, sku, repository.ErrNotFound)
+			return false
+		}
+	}
+	return true
+}
+
+func (h *InventoryHandler) renderInventoryError(w http.ResponseWriter, r *http.Request, action string, id int, sku string, err error) {
+	entry := h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": action,
+		"status": "fail",
+		"id":     id,
+		"sku":    sku,
+	})
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		entry.Warn("No product, variant or stock level found")
+		if sku == "" {
+			view.RenderError(w, r, view.NotFound(fmt.Sprintf("No stock found for product %d", id)))
+		} else {
+			view.RenderError(w, r, view.NotFound(fmt.Sprintf("No stock found for variant %s of product %d", sku, id)))
+		}
+	case errors.Is(err, repository.ErrInsufficientStock):
+		entry.Warn("Not enough stock for the requested change")
+		view.RenderError(w, r, view.Conflict("Not enough stock for the requested change"))
+	default:
+		entry.WithField("error", err.Error()).Error("Failed to access inventory")
+		view.RenderError(w, r, view.Internal("Failed to access inventory"))
+	}
+}
@@ -1,299 +1,427 @@
 package controller
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"store/images"
+	"store/inventory"
 	"store/model"
+	"store/money"
+	"store/pagination"
+	"store/pricing"
+	"store/repository"
+	"store/sorting"
+	"store/validation"
 	"store/view"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/sirupsen/logrus"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var client *mongo.Client
-var productCollection *mongo.Collection
-var logger = logrus.New()
+// ProductHandler serves the product endpoints.
+type ProductHandler struct {
+	products   repository.ProductRepository
+	categories repository.CategoryRepository
+	images     *images.Store
+	pricing    *pricing.Service
+	stock      *inventory.Service
+	logger     *logrus.Logger
+}
 
-func init() {
-	logFile, err := os.OpenFile("logging.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		fmt.Printf("Failed to open log file: %v\n", err)
-		return
+// NewProductHandler returns a handler that keeps uploaded product images in
+// imgs. categories is used to expand the category filter of listings,
+// prices to check prices and show them in the currency clients ask for, and
+// stock to show the stock of variants and to drop that of deleted ones.
+func NewProductHandler(products repository.ProductRepository, categories repository.CategoryRepository, imgs *images.Store, prices *pricing.Service, stock *inventory.Service, logger *logrus.Logger) *ProductHandler {
+	return &ProductHandler{products: products, categories: categories, images: imgs, pricing: prices, stock: stock, logger: logger}
+}
+
+// productFromForm reads a product from the text fields of a multipart form.
+// Values that are not numbers where numbers are expected are reported as
+// field errors together with the rule violations. Prices are sent as an
+// amount and a currency, such as "19.99 USD", and the price list as several
+// of them.
+func productFromForm(r *http.Request) (productRequest, validation.Errors) {
+	var req productRequest
+	var errs validation.Errors
+
+	req.SKU = r.FormValue("sku")
+	req.Name = r.FormValue("name")
+	req.Description = r.FormValue("description")
+	req.Category = r.FormValue("category")
+	req.Brand = r.FormValue("brand")
+	req.Gender = model.Gender(r.FormValue("gender"))
+	req.Material = r.FormValue("material")
+	req.CareInstructions = r.FormValue("careInstructions")
+	req.Sizes = formList(r, "sizes")
+	req.Colors = formList(r, "colors")
+	req.Tags = formList(r, "tags")
+	if v := r.FormValue("id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, validation.FieldError{Field: "id", Message: "must be of type integer"})
+		}
+		req.ID = id
 	}
+	if v := r.FormValue("price"); v != "" {
+		price, err := money.Parse(v)
+		if err != nil {
+			errs = append(errs, validation.FieldError{Field: "price", Message: "must be an amount and a currency, such as 19.99 USD"})
+		}
+		req.Price = price
+	}
+	var priceErrs validation.Errors
+	req.Prices, priceErrs = formPrices(r, "prices")
+	errs = append(errs, priceErrs...)
 
-	logger.SetOutput(logFile)
-	logger.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
-	logger.SetLevel(logrus.InfoLevel)
+	for _, fe := range validation.Struct(&req) {
+		if !hasFieldError(errs, fe.Field) {
+			errs = append(errs, fe)
+		}
+	}
+	return req, errs
+}
 
-	logger.WithFields(logrus.Fields{
-		"action": "initialize_logger",
-		"status": "success",
-	}).Info("Logger initialized and writing to logging.txt")
+// formList reads a list field that is either repeated or sent as a single
+// comma-separated value.
+func formList(r *http.Request, key string) []string {
+	var values []string
+	for _, v := range r.Form[key] {
+		values = append(values, strings.Split(v, ",")...)
+	}
+	return values
+}
 
-	client, err = mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
-	if err != nil {
-		logger.WithFields(logrus.Fields{
-			"action": "initialize_mongo_client",
-			"status": "fail",
-			"error":  err,
-		}).Error("Failed to connect to MongoDB")
-		return
+// formPrices reads a price list field of a multipart form, repeated or
+// comma-separated like other lists.
+func formPrices(r *http.Request, key string) ([]money.Money, validation.Errors) {
+	var prices []money.Money
+	var errs validation.Errors
+	for i, v := range formList(r, key) {
+		price, err := money.Parse(v)
+		if err != nil {
+			errs = append(errs, validation.FieldError{Field: fmt.Sprintf("%s[%d]", key, i), Message: "must be an amount and a currency, such as 18.50 EUR"})
+		}
+		prices = append(prices, price)
 	}
+	return prices, errs
+}
 
-	err = client.Ping(context.Background(), nil)
-	if err != nil {
-		logger.WithFields(logrus.Fields{
-			"action": "ping_mongo_client",
-			"status": "fail",
-			"error":  err,
-		}).Error("Failed to ping MongoDB")
-		return
+func hasFieldError(errs validation.Errors, field string) bool {
+	for _, fe := range errs {
+		if fe.Field == field {
+			return true
+		}
 	}
-	productCollection = client.Database("testdb").Collection("products")
+	return false
+}
 
-	logger.WithFields(logrus.Fields{
-		"action": "initialize_mongo_collection",
-		"status": "success",
-	}).Info("MongoDB client and collection initialized successfully")
+// pageRequest reads the paging parameters of a listing. It writes a 400
+// response and returns false if they are invalid.
+func pageRequest(w http.ResponseWriter, r *http.Request, logger *logrus.Logger) (pagination.Request, bool) {
+	page, errs := pagination.Parse(r.URL.Query())
+	if len(errs) > 0 {
+		rejectRequest(w, r, logger, errs)
+		return page, false
+	}
+	return page, true
 }
 
-func InitializeProduct(mongoClient *mongo.Client) {
-	client = mongoClient
-	productCollection = client.Database("storeDB").Collection("products")
-	log.WithFields(logrus.Fields{
-		"action": "initialize",
-		"status": "success",
-	}).Info("Product collection initialized")
+// rejectCursor answers a cursor that does not fit the sort order of the
+// listing, for example because the sort parameter changed.
+func rejectCursor(w http.ResponseWriter, r *http.Request, logger *logrus.Logger) {
+	rejectRequest(w, r, logger, validation.Errors{{Field: "cursor", Message: "does not match the sort order of the listing"}})
 }
 
-func validateProductFields(reqData map[string]interface{}, requiredFields []string) (map[string]string, bool) {
-	for _, field := range requiredFields {
-		if _, exists := reqData[field]; !exists {
-			logger.Warnf("Validation failed: Field '%s' is required", field)
-			return map[string]string{
-				"status":  "fail",
-				"message": fmt.Sprintf("Field '%s' is required", field),
-			}, false
-		}
-	}
-	if id, ok := reqData["id"].(float64); !ok || id <= 0 {
-		logger.Warn("Validation failed: 'id' must be a positive number")
-		return map[string]string{
-			"status":  "fail",
-			"message": "'id' must be a positive number",
-		}, false
-	}
-	if name, ok := reqData["name"].(string); !ok || name == "" {
-		logger.Warn("Validation failed: 'name' must be a non-empty string")
-		return map[string]string{
-			"status":  "fail",
-			"message": "'name' must be a non-empty string",
-		}, false
-	}
-	if price, ok := reqData["price"].(float64); !ok || price <= 0 {
-		logger.Warn("Validation failed: 'price' must be a positive number")
-		return map[string]string{
-			"status":  "fail",
-			"message": "'price' must be a positive number",
-		}, false
-	}
-	return nil, true
-}
-
-func getPaginationParams(r *http.Request) (int, int) {
-	page := r.URL.Query().Get("page")
-	limit := 10
-	skip := 0
-
-	if p, err := strconv.Atoi(page); err == nil && p > 1 {
-		skip = (p - 1) * limit
-	} else {
-		page = "1"
-	}
-	return skip, limit
-}
-func getSortingParams(r *http.Request) (string, int) {
-	sortField := r.URL.Query().Get("sort")
-	var sortOrder int
-	if sortField != "" {
-		sortOrder = 1
-		if sortField[0] == '-' {
-			sortField = sortField[1:]
-			sortOrder = -1
-		}
-	} else {
-		sortField = "price"
-		sortOrder = 1
+// sortRequest reads the sort parameter of a listing, allowing only fields.
+// It writes a 400 response naming the invalid fields and returns false if
+// it is invalid.
+func sortRequest(w http.ResponseWriter, r *http.Request, logger *logrus.Logger, fields []string, defaults []sorting.Key) ([]sorting.Key, bool) {
+	keys, errs := sorting.Parse(r.URL.Query().Get("sort"), fields, defaults)
+	if len(errs) > 0 {
+		rejectRequest(w, r, logger, errs)
+		return nil, false
 	}
-	return sortField, sortOrder
+	return keys, true
 }
 
-func AllProducts(w http.ResponseWriter, r *http.Request) {
-	log.WithFields(logrus.Fields{
+func (h *ProductHandler) AllProducts(w http.ResponseWriter, r *http.Request) {
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "start_all_products",
 	}).Info("Start AllProducts Handler")
 
-	filterName := r.URL.Query().Get("name")
-	filter := bson.M{}
-	if filterName != "" {
-		filter["name"] = bson.M{"$regex": filterName, "$options": "i"}
+	query, categories, ok := h.productFilters(w, r)
+	if !ok {
+		return
 	}
 
-	sortField, sortOrder := getSortingParams(r)
+	query.Sort, ok = sortRequest(w, r, h.logger, repository.ProductSortFields, sorting.Asc("price"))
+	if !ok {
+		return
+	}
 
-	skip, limit := getPaginationParams(r)
+	page, ok := pageRequest(w, r, h.logger)
+	if !ok {
+		return
+	}
+	converter, ok := h.priceConverter(w, r)
+	if !ok {
+		return
+	}
+	// One product more than requested tells whether another page follows.
+	query.Skip, query.Limit, query.Cursor = page.Skip(), page.Limit+1, page.Cursor
 
-	cursor, err := productCollection.Find(
-		context.TODO(),
-		filter,
-		options.Find().SetSort(bson.D{{Key: sortField, Value: sortOrder}}).
-			SetLimit(int64(limit)).
-			SetSkip(int64(skip)),
-	)
+	products, err := h.products.List(r.Context(), query)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		rejectCursor(w, r, h.logger)
+		return
+	}
 	if err != nil {
-		log.WithFields(logrus.Fields{
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "all_products",
 			"status": "fail",
 			"error":  err.Error(),
 		}).Error("Failed to fetch products from database")
-		jsonResponse(w, http.StatusInternalServerError, map[string]string{"status": "fail", "message": "Failed to fetch products from database"})
+		view.RenderError(w, r, view.Internal("Failed to fetch products from database"))
 		return
 	}
-	defer cursor.Close(context.TODO())
-
-	var products model.Products
-	if err = cursor.All(context.TODO(), &products); err != nil {
-		log.WithFields(logrus.Fields{
+	total, err := h.products.Count(r.Context(), query)
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "all_products",
+			"status": "fail",
+			"error":  err.Error(),
+		}).Error("Failed to count products")
+		view.RenderError(w, r, view.Internal("Failed to fetch products from database"))
+		return
+	}
+	facets, err := h.products.Facets(r.Context(), query)
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "all_products",
 			"status": "fail",
 			"error":  err.Error(),
-		}).Error("Error decoding product data")
-		jsonResponse(w, http.StatusInternalServerError, map[string]string{"status": "fail", "message": "Error decoding product data"})
+		}).Error("Failed to count product facets")
+		view.RenderError(w, r, view.Internal("Failed to fetch products from database"))
 		return
 	}
+	// Rolling the counts up to parent categories needs the tree, which the
+	// category filter may already have loaded.
+	if len(facets.Categories) > 0 {
+		if categories == nil {
+			if categories, ok = h.categoryTree(w, r); !ok {
+				return
+			}
+		}
+		facets.Categories = rollUpCategories(facets.Categories, categories)
+	}
 
-	if r.Header.Get("Accept") == "text/html" {
-		view.RenderProducts(w, products)
-	} else {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(products)
+	products, more := pagination.Trim(products, page)
+	meta := productListMeta{
+		Meta: pagination.NewMeta(page, total, more, products, func(p model.Product) []any {
+			return repository.ProductSortValues(p, query)
+		}),
+		Facets: facets,
+	}
+	for i := range products {
+		if !h.convertPrice(w, r, converter, &products[i]) {
+			return
+		}
+	}
+	if !h.setStock(w, r, products) {
+		return
 	}
+	pagination.SetLinks(w, r, meta.Meta)
+	h.setImageURLs(products)
+	view.RenderList(w, r, products, meta)
 
-	log.WithFields(logrus.Fields{
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "all_products",
 		"status": "success",
 		"count":  len(products),
 	}).Info("Fetched products successfully")
 }
 
-func HandleProductPostRequest(w http.ResponseWriter, r *http.Request) {
-	log.WithFields(logrus.Fields{
+// priceConverter reads the currency parameter of a product read. Without
+// one, prices are shown as stored, in the currency of the store. It writes a
+// 400 response and returns false for a currency that is not known or has no
+// exchange rate.
+func (h *ProductHandler) priceConverter(w http.ResponseWriter, r *http.Request) (*pricing.Converter, bool) {
+	currency := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("currency")))
+	if currency == "" {
+		return nil, true
+	}
+	converter, err := h.pricing.Converter(r.Context(), currency)
+	switch {
+	case errors.Is(err, money.ErrUnknownCurrency):
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "currency", Message: err.Error()}})
+	case errors.Is(err, pricing.ErrNoRate):
+		rejectRequest(w, r, h.logger, validation.Errors{{
+			Field:   "currency",
+			Message: "has no exchange rate; see " + APIPrefix + "/exchange-rates for the currencies offered",
+		}})
+	case err != nil:
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action":   "convert_prices",
+			"status":   "fail",
+			"currency": currency,
+			"error":    err.Error(),
+		}).Error("Failed to fetch exchange rate")
+		view.RenderError(w, r, view.Internal("Failed to fetch exchange rate from database"))
+	default:
+		return converter, true
+	}
+	return nil, false
+}
+
+// convertPrice shows p in the currency of converter, unless it is nil. It
+// writes a 500 response and returns false if a price is too large to
+// convert.
+func (h *ProductHandler) convertPrice(w http.ResponseWriter, r *http.Request, converter *pricing.Converter, p *model.Product) bool {
+	if converter == nil {
+		return true
+	}
+	if err := converter.Product(p); err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action":   "convert_prices",
+			"status":   "fail",
+			"id":       p.ID,
+			"currency": converter.Currency(),
+			"error":    err.Error(),
+		}).Error("Failed to convert product prices")
+		view.RenderError(w, r, view.Internal("Failed to convert prices to "+converter.Currency()))
+		return false
+	}
+	return true
+}
+
+// checkPrices rejects a price that is not in the currency of the store and a
+// price list that is in it or repeats a currency. A nil price or prices is
+// not checked. It writes a 400 response and returns false on a problem.
+func (h *ProductHandler) checkPrices(w http.ResponseWriter, r *http.Request, price *money.Money, prices []money.Money) bool {
+	if errs := pricing.CheckPrices(h.pricing.Currency(), price, prices); len(errs) > 0 {
+		rejectRequest(w, r, h.logger, errs)
+		return false
+	}
+	return true
+}
+
+// errServerAssignedID rejects an id sent to create a product.
+var errServerAssignedID = validation.FieldError{
+	Field:   "id",
+	Message: "is assigned by the server; use " + APIPrefix + "/products/import to keep an existing ID",
+}
+
+// errImageNotUploaded rejects an image key sent instead of an uploaded
+// file, which could name the image of another product.
+var errImageNotUploaded = validation.FieldError{
+	Field:   "image",
+	Message: "must be uploaded as a file with a multipart form",
+}
+
+// HandleProductPostRequest creates a product from a JSON body or, with an
+// image, a multipart form. The server allocates its ID.
+func (h *ProductHandler) HandleProductPostRequest(w http.ResponseWriter, r *http.Request) {
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "start_create_product",
 	}).Info("Start HandleProductPostRequest Handler")
 
 	if r.Method != http.MethodPost {
-		log.WithFields(logrus.Fields{
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "method_not_allowed",
 			"status": "fail",
 			"method": r.Method,
 		}).Warn("Only POST methods are allowed!")
-		http.Error(w, "Only POST methods are allowed!", http.StatusMethodNotAllowed)
+		view.RenderError(w, r, view.MethodNotAllowed("POST"))
 		return
 	}
 
-	// Handling file upload (image)
-	err := r.ParseMultipartForm(10 << 20) // Limit file size to 10 MB
-	if err != nil {
-		log.Error("Error parsing multipart form: ", err)
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
-		return
-	}
+	var req productRequest
+	var uploaded *model.Image
 
-	// Get image file
-	file, _, err := r.FormFile("image")
-	if err != nil {
-		log.Error("Error retrieving image: ", err)
-		http.Error(w, "Unable to retrieve image", http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		// Handling file upload (image)
+		if !h.parseMultipartForm(w, r) {
+			return
+		}
 
-	// Generate a unique name for the image
-	imageName := fmt.Sprintf("%d.jpg", time.Now().Unix())
+		var errs validation.Errors
+		req, errs = productFromForm(r)
+		if req.ID != 0 && !hasFieldError(errs, "id") {
+			errs = append(errs, errServerAssignedID)
+		}
+		errs = append(errs, pricing.CheckPrices(h.pricing.Currency(), &req.Price, req.Prices)...)
+		if len(errs) > 0 {
+			rejectRequest(w, r, h.logger, errs)
+			return
+		}
 
-	// Save the image to a directory (e.g., "uploads/")
-	out, err := os.Create("uploads/" + imageName)
-	if err != nil {
-		log.Error("Error saving image: ", err)
-		http.Error(w, "Unable to save image", http.StatusInternalServerError)
-		return
-	}
-	defer out.Close()
+		// Get image file
+		file, _, err := r.FormFile("image")
+		if err != nil {
+			h.logger.WithContext(r.Context()).Error("Error retrieving image: ", err)
+			view.RenderError(w, r, view.BadRequest("Unable to retrieve image"))
+			return
+		}
+		defer file.Close()
 
-	_, err = io.Copy(out, file)
-	if err != nil {
-		log.Error("Error copying file: ", err)
-		http.Error(w, "Unable to save image", http.StatusInternalServerError)
+		var ok bool
+		if uploaded, ok = h.saveImage(w, r, file); !ok {
+			return
+		}
+		req.Image = uploaded.Key
+	} else if !decodeRequest(w, r, h.logger, &req) {
+		return
+	} else if req.ID != 0 {
+		rejectRequest(w, r, h.logger, validation.Errors{errServerAssignedID})
+		return
+	} else if req.Image != "" {
+		rejectRequest(w, r, h.logger, validation.Errors{errImageNotUploaded})
+		return
+	} else if !h.checkPrices(w, r, &req.Price, req.Prices) {
 		return
 	}
 
-	// Create a new product with the image
-	var reqData map[string]interface{}
-	err = json.NewDecoder(r.Body).Decode(&reqData)
-	if err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "invalid_json",
-			"status": "fail",
-			"error":  err.Error(),
-		}).Error("Invalid JSON format")
-		http.Error(w, "Invalid JSON format: "+err.Error(), http.StatusBadRequest)
-		return
+	newProduct := req.product()
+	if uploaded != nil {
+		newProduct.SetImages([]model.Image{*uploaded})
 	}
 
-	if resp, valid := validateProductFields(reqData, []string{"id", "name", "price"}); !valid {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(resp)
+	err := h.products.Create(r.Context(), &newProduct)
+	if err != nil && uploaded != nil {
+		h.removeImage(r, uploaded.Key)
+	}
+	if errors.Is(err, repository.ErrConflict) && newProduct.SKU != "" {
+		h.renderSKUConflict(w, r, newProduct.SKU)
 		return
 	}
-
-	newProduct := model.Product{
-		ID:    int(reqData["id"].(float64)),
-		Name:  reqData["name"].(string),
-		Price: reqData["price"].(float64),
-		Image: imageName, // Add the generated image name to the product
+	if errors.Is(err, repository.ErrConflict) {
+		// Only possible if an import took the allocated ID meanwhile.
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "create_product",
+			"status": "fail",
+			"id":     newProduct.ID,
+		}).Warn("Allocated product ID is already taken")
+		view.RenderError(w, r, view.Conflict(fmt.Sprintf("Product ID %d is already taken, please retry", newProduct.ID)))
+		return
 	}
-
-	_, err = productCollection.InsertOne(context.TODO(), newProduct)
 	if err != nil {
-		log.WithFields(logrus.Fields{
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "create_product",
 			"status": "fail",
 			"error":  err.Error(),
 		}).Error("Failed to create product")
-		jsonResponse(w, http.StatusInternalServerError, map[string]string{"status": "fail", "message": "Failed to create product"})
+		view.RenderError(w, r, view.Internal("Failed to create product"))
 		return
 	}
 
-	response := map[string]string{
-		"status":  "success",
-		"message": "Product data successfully received",
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	h.images.SetURLs(&newProduct)
+	view.Render(w, r, http.StatusOK, newProduct)
 
-	log.WithFields(logrus.Fields{
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "create_product",
 		"status": "success",
 		"id":     newProduct.ID,
@@ -302,293 +430,321 @@ func HandleProductPostRequest(w http.ResponseWriter, r *http.Request) {
 	}).Info("Successfully added new product")
 }
 
-func DeleteProductByID(w http.ResponseWriter, r *http.Request) {
-	log.WithFields(logrus.Fields{
+// parseMultipartForm reads a multipart upload, writing an error response and
+// returning false if it cannot.
+func (h *ProductHandler) parseMultipartForm(w http.ResponseWriter, r *http.Request) bool {
+	err := r.ParseMultipartForm(10 << 20) // Limit file size to 10 MB
+	if err != nil {
+		h.logger.WithContext(r.Context()).Error("Error parsing multipart form: ", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			view.RenderError(w, r, view.RequestError(err))
+			return false
+		}
+		view.RenderError(w, r, view.BadRequest("Unable to parse form"))
+		return false
+	}
+	return true
+}
+
+// saveImage stores an uploaded image with its thumbnails. It writes a 400
+// response and returns false if the file is not a supported image, and a
+// 500 response if it cannot be stored.
+func (h *ProductHandler) saveImage(w http.ResponseWriter, r *http.Request, file io.Reader) (*model.Image, bool) {
+	img, err := h.images.Save(r.Context(), file)
+	var invalid validation.Errors
+	if errors.As(err, &invalid) {
+		rejectRequest(w, r, h.logger, invalid)
+		return nil, false
+	}
+	if err != nil {
+		h.logger.WithContext(r.Context()).Error("Error saving image: ", err)
+		view.RenderError(w, r, view.Internal("Unable to save image"))
+		return nil, false
+	}
+	return &img, true
+}
+
+// setImageURLs fills in the URLs of the gallery images of products.
+func (h *ProductHandler) setImageURLs(products []model.Product) {
+	for i := range products {
+		h.images.SetURLs(&products[i])
+	}
+}
+
+// removeImage deletes the blobs of an image that no product uses any more.
+// Uploads are keyed by their content, so other products, including deleted
+// ones that may be restored, can share them.
+func (h *ProductHandler) removeImage(r *http.Request, name string) {
+	if err := h.images.Release(r.Context(), name, h.products); err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "remove_image",
+			"status": "fail",
+			"image":  name,
+			"error":  err.Error(),
+		}).Warn("Failed to remove replaced image")
+	}
+}
+
+// removeImages deletes the blobs of the images before used but no longer
+// by after.
+func (h *ProductHandler) removeImages(r *http.Request, before, after model.Product) {
+	dropped := []string{before.Image}
+	for _, img := range before.Images {
+		dropped = append(dropped, img.Key)
+	}
+	for _, name := range dropped {
+		if name != "" && name != after.Image && after.ImageIndex(name) < 0 {
+			h.removeImage(r, name)
+		}
+	}
+}
+
+// productIDFromPath reads the {id} wildcard of a /api/v1/products/{id} route.
+// It writes a 400 response and returns false when the id is not a positive
+// integer.
+func productIDFromPath(w http.ResponseWriter, r *http.Request, logger *logrus.Logger) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "validation",
+			"status": "fail",
+			"id":     r.PathValue("id"),
+		}).Warn("Product ID in path must be a positive integer")
+		view.RenderError(w, r, view.BadRequest("Product ID must be a positive integer"))
+		return 0, false
+	}
+	return id, true
+}
+
+// productIDFromBody reads the "id" field of the JSON body sent to the
+// deprecated RPC-style routes.
+func (h *ProductHandler) productIDFromBody(w http.ResponseWriter, r *http.Request) (int, bool) {
+	var req productIDRequest
+	if !decodeRequest(w, r, h.logger, &req) {
+		return 0, false
+	}
+	return req.ID, true
+}
+
+// DeleteProduct handles DELETE /api/v1/products/{id}.
+func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	if id, ok := productIDFromPath(w, r, h.logger); ok {
+		h.deleteProduct(w, r, id)
+	}
+}
+
+func (h *ProductHandler) DeleteProductByID(w http.ResponseWriter, r *http.Request) {
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "start_delete_product",
 	}).Info("Start DeleteProductByID Handler")
 
 	if r.Method != http.MethodDelete {
-		log.WithFields(logrus.Fields{
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "method_not_allowed",
 			"status": "fail",
 			"method": r.Method,
 		}).Warn("Only DELETE methods are allowed!")
-		http.Error(w, "Only DELETE methods are allowed!", http.StatusMethodNotAllowed)
+		view.RenderError(w, r, view.MethodNotAllowed("DELETE"))
 		return
 	}
 
-	var reqData map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&reqData)
-	if err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "invalid_json",
-			"status": "fail",
-			"error":  err.Error(),
-		}).Error("Invalid JSON format")
-		http.Error(w, "Invalid JSON format: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	id, idExists := reqData["id"]
-	if !idExists || id.(float64) <= 0 {
-		log.WithFields(logrus.Fields{
-			"action": "validation",
-			"status": "fail",
-			"field":  "id",
-		}).Warn("Field 'id' is required and must be positive")
-		response := map[string]string{
-			"status":  "fail",
-			"message": "Field 'id' is required and must be positive",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
-		return
+	if id, ok := h.productIDFromBody(w, r); ok {
+		h.deleteProduct(w, r, id)
 	}
+}
 
-	idFloat := int(id.(float64))
-	filter := bson.M{"id": idFloat}
-	deleteResult, err := productCollection.DeleteOne(context.TODO(), filter)
-	if err != nil {
-		log.WithFields(logrus.Fields{
+func (h *ProductHandler) deleteProduct(w http.ResponseWriter, r *http.Request, id int) {
+	err := h.products.Delete(r.Context(), id, actor(r))
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "delete_product",
 			"status": "fail",
 			"error":  err.Error(),
 		}).Error("Failed to delete product from database")
-		http.Error(w, "Failed to delete product from the database", http.StatusInternalServerError)
+		view.RenderError(w, r, view.Internal("Failed to delete product from the database"))
 		return
 	}
 
-	if deleteResult.DeletedCount == 0 {
-		log.WithFields(logrus.Fields{
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "product_not_found",
 			"status": "fail",
-			"id":     idFloat,
+			"id":     id,
 		}).Warn("No product found with the given ID")
-		response := map[string]string{
-			"status":  "fail",
-			"message": fmt.Sprintf("No product found with ID %d", idFloat),
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(response)
+		view.RenderError(w, r, view.NotFound(fmt.Sprintf("No product found with ID %d", id)))
 		return
 	}
 
-	response := map[string]string{
-		"status":  "success",
-		"message": fmt.Sprintf("Product with ID %d successfully deleted", idFloat),
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
-	log.WithFields(logrus.Fields{
+	view.RenderMessage(w, r, http.StatusOK, fmt.Sprintf("Product with ID %d moved to the trash", id))
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "delete_product",
 		"status": "success",
-		"id":     idFloat,
+		"id":     id,
 	}).Info("Successfully deleted product")
 }
 
-func UpdateProductByID(w http.ResponseWriter, r *http.Request) {
-	log.WithFields(logrus.Fields{
-		"action": "start_update_product",
-		"status": "initiated",
-	}).Info("Start: UpdateProductByID Handler")
-
-	if r.Method != http.MethodPut {
-		log.WithFields(logrus.Fields{
-			"action": "method_not_allowed",
-			"status": "fail",
-		}).Warn("Only PUT methods are allowed!")
-		http.Error(w, "Only PUT methods are allowed!", http.StatusMethodNotAllowed)
+// UpdateProduct handles PUT /api/v1/products/{id}. The body replaces every
+// attribute of the product except its image; an "id" in the body is ignored
+// in favour of the path.
+func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
 		return
 	}
 
-	var reqData map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&reqData)
-	if err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "invalid_json",
-			"status": "fail",
-			"error":  err.Error(),
-		}).Error("Invalid JSON format")
-		http.Error(w, "Invalid JSON format: "+err.Error(), http.StatusBadRequest)
+	var req productRequest
+	if err := validation.DecodeJSON(r.Body, &req); err != nil {
+		rejectRequest(w, r, h.logger, err)
 		return
 	}
-
-	if resp, valid := validateProductFields(reqData, []string{"id", "name", "price"}); !valid {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(resp)
-		return
+	req.ID = id
+	if validateRequest(w, r, h.logger, &req) && h.checkPrices(w, r, &req.Price, req.Prices) {
+		h.updateProduct(w, r, req)
 	}
+}
 
-	id := int(reqData["id"].(float64))
-	update := bson.M{
-		"$set": bson.M{
-			"name":  reqData["name"].(string),
-			"price": reqData["price"].(float64),
-		},
+func (h *ProductHandler) updateProduct(w http.ResponseWriter, r *http.Request, req productRequest) {
+	id := req.ID
+	err := h.products.Update(r.Context(), id, req.update())
+	if errors.Is(err, repository.ErrConflict) {
+		h.renderSKUConflict(w, r, req.SKU)
+		return
 	}
-
-	filter := bson.M{"id": id}
-	result, err := productCollection.UpdateOne(context.TODO(), filter, update)
-	if err != nil {
-		log.WithFields(logrus.Fields{
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "update_product",
 			"status": "fail",
 			"error":  err.Error(),
 		}).Error("Failed to update product")
-		http.Error(w, "Failed to update product", http.StatusInternalServerError)
+		view.RenderError(w, r, view.Internal("Failed to update product"))
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		log.WithFields(logrus.Fields{
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "product_not_found",
 			"status": "fail",
 			"id":     id,
 		}).Warn("No product found with the given ID")
-		http.Error(w, "No product found with the given ID", http.StatusNotFound)
+		view.RenderError(w, r, view.NotFound("No product found with the given ID"))
 		return
 	}
 
-	response := map[string]string{
-		"status":  "success",
-		"message": fmt.Sprintf("Product with ID %d successfully updated", id),
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
-	log.WithFields(logrus.Fields{
+	view.RenderMessage(w, r, http.StatusOK, fmt.Sprintf("Product with ID %d successfully updated", id))
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "update_product",
 		"status": "success",
 		"id":     id,
 	}).Info("Successfully updated product")
 }
 
-func GetProductByID(w http.ResponseWriter, r *http.Request) {
-	log.WithFields(logrus.Fields{
+// renderSKUConflict answers a create or update that would give a product
+// the SKU of another one.
+func (h *ProductHandler) renderSKUConflict(w http.ResponseWriter, r *http.Request, sku string) {
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "save_product",
+		"status": "fail",
+		"sku":    sku,
+	}).Warn("Product SKU is already taken")
+	view.RenderError(w, r, view.Conflict(fmt.Sprintf("SKU %s is already used by another product, possibly a deleted one", sku)))
+}
+
+// GetProduct handles GET /api/v1/products/{id}.
+func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
+	if id, ok := productIDFromPath(w, r, h.logger); ok {
+		h.getProduct(w, r, id)
+	}
+}
+
+func (h *ProductHandler) GetProductByID(w http.ResponseWriter, r *http.Request) {
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "start_get_product",
 		"status": "initiated",
 	}).Info("Start: GetProductByID Handler")
 
-	var reqData map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&reqData)
-	if err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "invalid_json",
-			"status": "fail",
-			"error":  err.Error(),
-		}).Error("Invalid JSON format")
-		http.Error(w, "Invalid JSON format: "+err.Error(), http.StatusBadRequest)
-		return
+	if id, ok := h.productIDFromBody(w, r); ok {
+		h.getProduct(w, r, id)
 	}
+}
 
-	id, idExists := reqData["id"]
-	if !idExists || id.(float64) <= 0 {
-		log.WithFields(logrus.Fields{
-			"action": "validation",
-			"status": "fail",
-			"error":  "'id' must be positive",
-		}).Warn("Validation failed")
-		response := map[string]string{
-			"status":  "fail",
-			"message": "Field 'id' is required and must be positive",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+func (h *ProductHandler) getProduct(w http.ResponseWriter, r *http.Request, id int) {
+	converter, ok := h.priceConverter(w, r)
+	if !ok {
 		return
 	}
-
-	idFloat := int(id.(float64))
-	filter := bson.M{"id": idFloat}
-	var product model.Product
-	err = productCollection.FindOne(context.TODO(), filter).Decode(&product)
+	product, err := h.products.FindByID(r.Context(), id)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.WithFields(logrus.Fields{
+		if errors.Is(err, repository.ErrNotFound) {
+			h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 				"action": "product_not_found",
 				"status": "fail",
-				"id":     idFloat,
+				"id":     id,
 			}).Warn("No product found with the given ID")
-			http.Error(w, fmt.Sprintf("No product found with ID %d", idFloat), http.StatusNotFound)
+			view.RenderError(w, r, view.NotFound(fmt.Sprintf("No product found with ID %d", id)))
 			return
 		}
-		log.WithFields(logrus.Fields{
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "fetch_product",
 			"status": "fail",
 			"error":  err.Error(),
 		}).Error("Error fetching product")
-		http.Error(w, "Error fetching product from the database", http.StatusInternalServerError)
+		view.RenderError(w, r, view.Internal("Error fetching product from the database"))
 		return
 	}
 
-	view.RenderProducts(w, product)
-	log.WithFields(logrus.Fields{
+	if !h.convertPrice(w, r, converter, product) {
+		return
+	}
+	products := []model.Product{*product}
+	if !h.setStock(w, r, products) {
+		return
+	}
+	product = &products[0]
+	h.images.SetURLs(product)
+	view.RenderProducts(w, r, product)
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "fetch_product",
 		"status": "success",
-		"id":     idFloat,
+		"id":     id,
 	}).Info("Successfully fetched product")
 }
 
-func GetProductByName(w http.ResponseWriter, r *http.Request) {
-	var reqData map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&reqData)
-	if err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "invalid_json",
-			"status": "fail",
-			"error":  err.Error(),
-		}).Error("Invalid JSON format")
-		http.Error(w, "Invalid JSON format: "+err.Error(), http.StatusBadRequest)
+// GetProductByName returns every product whose name contains the requested
+// name, ignoring case.
+func (h *ProductHandler) GetProductByName(w http.ResponseWriter, r *http.Request) {
+	var req productNameRequest
+	if !decodeRequest(w, r, h.logger, &req) {
 		return
 	}
+	name := req.Name
 
-	name, nameExists := reqData["name"]
-	if !nameExists || name == "" {
-		log.WithFields(logrus.Fields{
-			"action": "validation",
-			"status": "fail",
-			"error":  "'name' is required and must be non-empty",
-		}).Warn("Validation failed")
-		response := map[string]string{
-			"status":  "fail",
-			"message": "Field 'name' is required and must be non-empty",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
-		return
-	}
-
-	filter := bson.M{"name": bson.M{"$regex": name.(string), "$options": "i"}}
-	var product model.Product
-	err = productCollection.FindOne(context.TODO(), filter).Decode(&product)
+	products, err := h.products.List(r.Context(), repository.ProductQuery{Name: name, Sort: sorting.Asc("name")})
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.WithFields(logrus.Fields{
-				"action": "product_not_found",
-				"status": "fail",
-				"name":   name,
-			}).Warn("No product found with the given name")
-			http.Error(w, fmt.Sprintf("No product found with name %s", name), http.StatusNotFound)
-			return
-		}
-		log.WithFields(logrus.Fields{
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "fetch_product",
 			"status": "fail",
 			"error":  err.Error(),
 		}).Error("Error fetching product")
-		http.Error(w, "Error fetching product from the database", http.StatusInternalServerError)
+		view.RenderError(w, r, view.Internal("Error fetching product from the database"))
+		return
+	}
+	if len(products) == 0 {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "product_not_found",
+			"status": "fail",
+			"name":   name,
+		}).Warn("No product found with the given name")
+		view.RenderError(w, r, view.NotFound(fmt.Sprintf("No product found with name %s", name)))
 		return
 	}
 
-	view.RenderProducts(w, product)
-	log.WithFields(logrus.Fields{
+	h.setImageURLs(products)
+	view.RenderProducts(w, r, products)
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "fetch_product",
 		"status": "success",
 		"name":   name,
-	}).Info("Successfully fetched product")
+		"count":  len(products),
+	}).Info("Successfully fetched products")
 }
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"store/catalog"
+	"store/model"
+	"store/pagination"
+	"store/repository"
+	"store/view"
+
+	"github.com/sirupsen/logrus"
+)
+
+// productListMeta is the metadata of a product listing.
+type productListMeta struct {
+	pagination.Meta
+	Facets *repository.ProductFacets `json:"facets"`
+}
+
+// productFilters reads the filters of a product listing from the query
+// string, as described by catalog.Filters, and expands the category into the
+// categories below it. The category tree is only loaded for that, and is
+// returned, or nil without a category filter. It writes the error response
+// and returns false for invalid values or an unknown category.
+func (h *ProductHandler) productFilters(w http.ResponseWriter, r *http.Request) (repository.ProductQuery, model.Categories, bool) {
+	q, slug, errs := catalog.Filters(r.URL.Query())
+	if len(errs) > 0 {
+		rejectRequest(w, r, h.logger, errs)
+		return q, nil, false
+	}
+
+	var categories model.Categories
+	if slug != "" {
+		var ok bool
+		if categories, ok = h.categoryTree(w, r); !ok {
+			return q, nil, false
+		}
+		q.Categories = categories.Descendants(slug)
+		if q.Categories == nil {
+			h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+				"action":   "all_products",
+				"status":   "fail",
+				"category": slug,
+			}).Warn("No category found")
+			view.RenderError(w, r, view.NotFound(fmt.Sprintf("No category found with slug %s", slug)))
+			return q, nil, false
+		}
+	}
+	return q, categories, true
+}
+
+// categoryTree loads every category. It writes a 500 response and returns
+// false if they cannot be read.
+func (h *ProductHandler) categoryTree(w http.ResponseWriter, r *http.Request) (model.Categories, bool) {
+	categories, err := h.categories.List(r.Context())
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "list_categories",
+			"status": "fail",
+			"error":  err.Error(),
+		}).Error("Failed to fetch categories from database")
+		view.RenderError(w, r, view.Internal("Failed to fetch categories from database"))
+		return nil, false
+	}
+	return categories, true
+}
+
+// rollUpCategories adds the products of every category to the counts of its
+// ancestors, so that the count of a category matches what filtering by it
+// returns. Values that are not known categories are kept as they are.
+func rollUpCategories(counts []repository.FacetCount, categories model.Categories) []repository.FacetCount {
+	bySlug := map[string]int{}
+	for _, c := range counts {
+		bySlug[c.Value] = c.Count
+	}
+
+	rolled := []repository.FacetCount{}
+	for _, c := range categories {
+		n := 0
+		for _, slug := range categories.Descendants(c.Slug) {
+			n += bySlug[slug]
+		}
+		if n > 0 {
+			rolled = append(rolled, repository.FacetCount{Value: c.Slug, Count: n})
+		}
+	}
+	for _, c := range counts {
+		if !slices.ContainsFunc(categories, func(cat model.Category) bool { return cat.Slug == c.Value }) {
+			rolled = append(rolled, c)
+		}
+	}
+
+	slices.SortFunc(rolled, func(a, b repository.FacetCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Value, b.Value))
+	})
+	return rolled
+}
@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"store/model"
+	"store/money"
+	"store/repository"
+	"store/validation"
+	"store/view"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PatchProduct handles PATCH /api/v1/products/{id}. Only the fields sent are
+// changed and null clears an optional field. Sent as a multipart form, the
+// patch can also replace the image, whose old file is then deleted. An image
+// key that is sent must name an image of the gallery. An "id"
+// in the body is ignored in favour of the path. The updated product is
+// returned.
+func (h *ProductHandler) PatchProduct(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+	if req, image, ok := h.patchRequest(w, r); ok {
+		h.patchProduct(w, r, id, req, image)
+	}
+}
+
+// UpdateProductByID serves the deprecated update route, which patches the
+// product whose ID is sent in the body like PatchProduct.
+func (h *ProductHandler) UpdateProductByID(w http.ResponseWriter, r *http.Request) {
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "start_update_product",
+		"status": "initiated",
+	}).Info("Start: UpdateProductByID Handler")
+
+	if r.Method != http.MethodPut {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "method_not_allowed",
+			"status": "fail",
+		}).Warn("Only PUT methods are allowed!")
+		view.RenderError(w, r, view.MethodNotAllowed("PUT"))
+		return
+	}
+
+	req, image, ok := h.patchRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.ID <= 0 {
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "id", Message: "is required"}})
+		return
+	}
+	h.patchProduct(w, r, req.ID, req, image)
+}
+
+// patchRequest reads a patch from a JSON body or a multipart form. image is
+// the replacement image uploaded with a form, if any.
+func (h *ProductHandler) patchRequest(w http.ResponseWriter, r *http.Request) (req productPatchRequest, image *multipart.FileHeader, ok bool) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := validation.DecodeJSON(r.Body, &req); err != nil {
+			rejectRequest(w, r, h.logger, err)
+			return req, nil, false
+		}
+		return req, nil, true
+	}
+
+	if !h.parseMultipartForm(w, r) {
+		return req, nil, false
+	}
+	req, errs := productPatchFromForm(r)
+	if len(errs) > 0 {
+		rejectRequest(w, r, h.logger, errs)
+		return req, nil, false
+	}
+	if files := r.MultipartForm.File["image"]; len(files) > 0 {
+		image = files[0]
+	}
+	return req, image, true
+}
+
+// productPatchFromForm reads a patch from the text fields of a multipart
+// form. A form cannot send null, so an empty value clears an optional field.
+func productPatchFromForm(r *http.Request) (productPatchRequest, validation.Errors) {
+	var req productPatchRequest
+	var errs validation.Errors
+
+	text := func(n *nullable[string], key string) {
+		if _, ok := r.PostForm[key]; ok {
+			*n = nullable[string]{Set: true, Value: r.PostForm.Get(key)}
+		}
+	}
+	list := func(n *nullable[[]string], key string) {
+		if _, ok := r.PostForm[key]; ok {
+			*n = nullable[[]string]{Set: true, Value: formList(r, key)}
+		}
+	}
+	text(&req.SKU, "sku")
+	text(&req.Name, "name")
+	text(&req.Image, "image")
+	text(&req.Description, "description")
+	text(&req.Category, "category")
+	text(&req.Brand, "brand")
+	text(&req.Material, "material")
+	text(&req.CareInstructions, "careInstructions")
+	list(&req.Sizes, "sizes")
+	list(&req.Colors, "colors")
+	list(&req.Tags, "tags")
+	if _, ok := r.PostForm["gender"]; ok {
+		req.Gender = nullable[model.Gender]{Set: true, Value: model.Gender(r.PostForm.Get("gender"))}
+	}
+	if _, ok := r.PostForm["price"]; ok {
+		price, err := money.Parse(r.PostForm.Get("price"))
+		if err != nil {
+			errs = append(errs, validation.FieldError{Field: "price", Message: "must be an amount and a currency, such as 19.99 USD"})
+		}
+		req.Price = nullable[money.Money]{Set: true, Value: price}
+	}
+	if _, ok := r.PostForm["prices"]; ok {
+		prices, priceErrs := formPrices(r, "prices")
+		errs = append(errs, priceErrs...)
+		req.Prices = nullable[[]money.Money]{Set: true, Value: prices}
+	}
+	if v := r.PostForm.Get("id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, validation.FieldError{Field: "id", Message: "must be of type integer"})
+		}
+		req.ID = id
+	}
+	return req, errs
+}
+
+func (h *ProductHandler) patchProduct(w http.ResponseWriter, r *http.Request, id int, req productPatchRequest, image *multipart.FileHeader) {
+	product, err := h.products.FindByID(r.Context(), id)
+	if err != nil {
+		h.renderPatchError(w, r, id, err)
+		return
+	}
+	patched, errs := req.apply(productRequestOf(*product))
+	if len(errs) > 0 {
+		rejectRequest(w, r, h.logger, errs)
+		return
+	}
+	var price *money.Money
+	var prices []money.Money
+	if req.Price.Set {
+		price = &patched.Price
+	}
+	if req.Prices.Set {
+		prices = patched.Prices
+	}
+	if !h.checkPrices(w, r, price, prices) {
+		return
+	}
+
+	// Changes of the cover of a product with a gallery change the gallery.
+	var gallery *[]model.Image
+	var uploaded *model.Image
+	if image != nil {
+		file, err := image.Open()
+		if err != nil {
+			h.logger.WithContext(r.Context()).Error("Error retrieving image: ", err)
+			view.RenderError(w, r, view.BadRequest("Unable to retrieve image"))
+			return
+		}
+		var ok bool
+		uploaded, ok = h.saveImage(w, r, file)
+		file.Close()
+		if !ok {
+			return
+		}
+		images := withCover(product.Images, *uploaded)
+		gallery = &images
+	} else if req.Image.Set && len(product.Images) > 0 {
+		images, ok := coverFirst(product.Images, patched.Image)
+		if !ok {
+			rejectRequest(w, r, h.logger, validation.Errors{{
+				Field:   "image",
+				Message: "must name an image of the gallery, or be empty to remove the cover from it",
+			}})
+			return
+		}
+		gallery = &images
+	} else if req.Image.Set && patched.Image != "" && patched.Image != product.Image {
+		// Without a gallery, the image can only be uploaded or removed.
+		rejectRequest(w, r, h.logger, validation.Errors{errImageNotUploaded})
+		return
+	}
+	if gallery != nil {
+		after := model.Product{}
+		after.SetImages(*gallery)
+		patched.Image = after.Image
+		req.Image = nullable[string]{Set: true, Value: after.Image}
+	}
+
+	u := req.update(patched)
+	u.Images = gallery
+	if u != (repository.ProductUpdate{}) {
+		if err := h.products.Update(r.Context(), id, u); err != nil {
+			if uploaded != nil {
+				h.removeImage(r, uploaded.Key)
+			}
+			if errors.Is(err, repository.ErrConflict) {
+				h.renderSKUConflict(w, r, patched.SKU)
+				return
+			}
+			h.renderPatchError(w, r, id, err)
+			return
+		}
+	}
+
+	updated, err := h.products.FindByID(r.Context(), id)
+	if err != nil {
+		h.renderPatchError(w, r, id, err)
+		return
+	}
+	h.removeImages(r, *product, *updated)
+	product = updated
+	h.images.SetURLs(product)
+	view.Render(w, r, http.StatusOK, product)
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "update_product",
+		"status": "success",
+		"id":     id,
+	}).Info("Successfully updated product")
+}
+
+func (h *ProductHandler) renderPatchError(w http.ResponseWriter, r *http.Request, id int, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "product_not_found",
+			"status": "fail",
+			"id":     id,
+		}).Warn("No product found with the given ID")
+		view.RenderError(w, r, view.NotFound(fmt.Sprintf("No product found with ID %d", id)))
+		return
+	}
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "update_product",
+		"status": "fail",
+		"error":  err.Error(),
+	}).Error("Failed to update product")
+	view.RenderError(w, r, view.Internal("Failed to update product"))
+}
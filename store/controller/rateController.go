@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"store/model"
+	"store/money"
+	"store/pricing"
+	"store/repository"
+	"store/validation"
+	"store/view"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExchangeRateHandler serves the exchange rates that convert product prices
+// to the currencies clients ask for.
+type ExchangeRateHandler struct {
+	pricing *pricing.Service
+	logger  *logrus.Logger
+}
+
+func NewExchangeRateHandler(prices *pricing.Service, logger *logrus.Logger) *ExchangeRateHandler {
+	return &ExchangeRateHandler{pricing: prices, logger: logger}
+}
+
+// exchangeRates is the body of GET /api/v1/exchange-rates: the currency of
+// the store and what one unit of it is worth in the other currencies.
+type exchangeRates struct {
+	Currency string               `json:"currency"`
+	Rates    []model.ExchangeRate `json:"rates"`
+}
+
+// AllExchangeRates handles GET /api/v1/exchange-rates.
+func (h *ExchangeRateHandler) AllExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.pricing.Rates(r.Context())
+	if err != nil {
+		h.renderRateError(w, r, "all_exchange_rates", "", err)
+		return
+	}
+	view.Render(w, r, http.StatusOK, exchangeRates{Currency: h.pricing.Currency(), Rates: rates})
+}
+
+// SetExchangeRate handles PUT /api/v1/admin/exchange-rates/{currency},
+// creating or replacing the rate of the currency.
+func (h *ExchangeRateHandler) SetExchangeRate(w http.ResponseWriter, r *http.Request) {
+	currency := strings.ToUpper(r.PathValue("currency"))
+
+	var req exchangeRateRequest
+	if !decodeRequest(w, r, h.logger, &req) {
+		return
+	}
+	rate, err := h.pricing.SetRate(r.Context(), currency, req.Rate)
+	if err != nil {
+		h.renderRateError(w, r, "set_exchange_rate", currency, err)
+		return
+	}
+
+	view.Render(w, r, http.StatusOK, rate)
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action":   "set_exchange_rate",
+		"status":   "success",
+		"currency": currency,
+		"rate":     rate.Rate.String(),
+		"actor":    actor(r),
+	}).Info("Exchange rate set")
+}
+
+// DeleteExchangeRate handles DELETE /api/v1/admin/exchange-rates/{currency}.
+// Clients can no longer ask for prices in the currency, except those of
+// products listing their own price in it.
+func (h *ExchangeRateHandler) DeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	currency := strings.ToUpper(r.PathValue("currency"))
+
+	if err := h.pricing.DeleteRate(r.Context(), currency); err != nil {
+		h.renderRateError(w, r, "delete_exchange_rate", currency, err)
+		return
+	}
+
+	view.RenderMessage(w, r, http.StatusOK, fmt.Sprintf("Exchange rate of %s deleted", currency))
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action":   "delete_exchange_rate",
+		"status":   "success",
+		"currency": currency,
+		"actor":    actor(r),
+	}).Info("Exchange rate deleted")
+}
+
+func (h *ExchangeRateHandler) renderRateError(w http.ResponseWriter, r *http.Request, action string, currency string, err error) {
+	entry := h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action":   action,
+		"status":   "fail",
+		"currency": currency,
+	})
+
+	switch {
+	case errors.Is(err, money.ErrUnknownCurrency):
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "currency", Message: err.Error()}})
+	case errors.Is(err, pricing.ErrStoreCurrency):
+		rejectRequest(w, r, h.logger, validation.Errors{{
+			Field:   "currency",
+			Message: "is the currency of the store, whose rate is always 1",
+		}})
+	case errors.Is(err, pricing.ErrInvalidRate):
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "rate", Message: "must be greater than 0"}})
+	case errors.Is(err, repository.ErrNotFound):
+		entry.Warn("No exchange rate found")
+		view.RenderError(w, r, view.NotFound(fmt.Sprintf("No exchange rate found for %s", currency)))
+	default:
+		entry.WithField("error", err.Error()).Error("Failed to access exchange rates")
+		view.RenderError(w, r, view.Internal("Failed to access exchange rates"))
+	}
+}
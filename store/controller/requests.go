@@ -0,0 +1,329 @@
+package controller
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"store/catalog"
+	"store/model"
+	"store/money"
+	"store/repository"
+	"store/validation"
+	"store/view"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Request bodies accepted by the handlers. The validate tags are enforced by
+// decodeRequest; see the validation package for the available rules.
+
+// productRequest describes a product. It is a catalog.Row, so that the API
+// and bulk imports accept the same fields under the same rules, except that
+// the API does not require a SKU. ID is allocated by the server on create
+// and only sent to update through the deprecated routes or to import.
+type productRequest catalog.Row
+
+// product builds the product described by req with its lists normalised.
+func (req productRequest) product() model.Product {
+	return catalog.Row(req).Product()
+}
+
+// update replaces every attribute of a product with the values in req. The
+// image is only changed through an upload.
+func (req productRequest) update() repository.ProductUpdate {
+	p := req.product()
+	return repository.ProductUpdate{
+		SKU:              &p.SKU,
+		Name:             &p.Name,
+		Price:            &p.Price,
+		Prices:           &p.Prices,
+		Description:      &p.Description,
+		Category:         &p.Category,
+		Brand:            &p.Brand,
+		Gender:           &p.Gender,
+		Sizes:            &p.Sizes,
+		Colors:           &p.Colors,
+		Material:         &p.Material,
+		CareInstructions: &p.CareInstructions,
+		Tags:             &p.Tags,
+	}
+}
+
+// nullable is a field of a partial update. Set reports whether the field was
+// sent at all and Null whether it was sent as null.
+type nullable[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (n *nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &n.Value)
+}
+
+// patch copies the value of n into *dst if n was sent. A null clears *dst.
+func patch[T any](dst *T, n nullable[T]) {
+	if n.Set {
+		*dst = n.Value
+	}
+}
+
+// productPatchRequest changes only the fields of a product that are sent.
+// null clears an optional field; name and price cannot be cleared. ID is
+// only read by the deprecated update route.
+type productPatchRequest struct {
+	ID     int                     `json:"id"`
+	SKU    nullable[string]        `json:"sku"`
+	Name   nullable[string]        `json:"name"`
+	Price  nullable[money.Money]   `json:"price"`
+	Prices nullable[[]money.Money] `json:"prices"`
+	Image  nullable[string]        `json:"image"`
+
+	Description      nullable[string]       `json:"description"`
+	Category         nullable[string]       `json:"category"`
+	Brand            nullable[string]       `json:"brand"`
+	Gender           nullable[model.Gender] `json:"gender"`
+	Sizes            nullable[[]string]     `json:"sizes"`
+	Colors           nullable[[]string]     `json:"colors"`
+	Material         nullable[string]       `json:"material"`
+	CareInstructions nullable[string]       `json:"careInstructions"`
+	Tags             nullable[[]string]     `json:"tags"`
+}
+
+// apply changes the fields of current that req sends and validates them
+// with the rules of a whole product. Fields that are not sent are not
+// checked, so products stored before a rule existed can still be patched.
+func (req productPatchRequest) apply(current productRequest) (productRequest, validation.Errors) {
+	var errs validation.Errors
+	if req.Name.Null {
+		errs = append(errs, validation.FieldError{Field: "name", Message: "cannot be cleared"})
+	}
+	if req.Price.Null {
+		errs = append(errs, validation.FieldError{Field: "price", Message: "cannot be cleared"})
+	}
+
+	patch(&current.SKU, req.SKU)
+	patch(&current.Name, req.Name)
+	patch(&current.Price, req.Price)
+	patch(&current.Prices, req.Prices)
+	patch(&current.Image, req.Image)
+	patch(&current.Description, req.Description)
+	patch(&current.Category, req.Category)
+	patch(&current.Brand, req.Brand)
+	patch(&current.Gender, req.Gender)
+	patch(&current.Sizes, req.Sizes)
+	patch(&current.Colors, req.Colors)
+	patch(&current.Material, req.Material)
+	patch(&current.CareInstructions, req.CareInstructions)
+	patch(&current.Tags, req.Tags)
+
+	sent := map[string]bool{
+		"sku":              req.SKU.Set,
+		"name":             req.Name.Set,
+		"price":            req.Price.Set,
+		"prices":           req.Prices.Set,
+		"image":            req.Image.Set,
+		"description":      req.Description.Set,
+		"category":         req.Category.Set,
+		"brand":            req.Brand.Set,
+		"gender":           req.Gender.Set,
+		"sizes":            req.Sizes.Set,
+		"colors":           req.Colors.Set,
+		"material":         req.Material.Set,
+		"careInstructions": req.CareInstructions.Set,
+		"tags":             req.Tags.Set,
+	}
+	for _, fe := range validation.Struct(&current) {
+		field, _, _ := strings.Cut(fe.Field, "[")
+		if sent[field] && !hasFieldError(errs, fe.Field) {
+			errs = append(errs, fe)
+		}
+	}
+	return current, errs
+}
+
+// update returns the changes of req, taking the normalised values from
+// patched, the product req was applied to.
+func (req productPatchRequest) update(patched productRequest) repository.ProductUpdate {
+	p := patched.product()
+	var u repository.ProductUpdate
+	if req.SKU.Set {
+		u.SKU = &p.SKU
+	}
+	if req.Name.Set {
+		u.Name = &p.Name
+	}
+	if req.Price.Set {
+		u.Price = &p.Price
+	}
+	if req.Prices.Set {
+		u.Prices = &p.Prices
+	}
+	if req.Image.Set {
+		u.Image = &p.Image
+	}
+	if req.Description.Set {
+		u.Description = &p.Description
+	}
+	if req.Category.Set {
+		u.Category = &p.Category
+	}
+	if req.Brand.Set {
+		u.Brand = &p.Brand
+	}
+	if req.Gender.Set {
+		u.Gender = &p.Gender
+	}
+	if req.Sizes.Set {
+		u.Sizes = &p.Sizes
+	}
+	if req.Colors.Set {
+		u.Colors = &p.Colors
+	}
+	if req.Material.Set {
+		u.Material = &p.Material
+	}
+	if req.CareInstructions.Set {
+		u.CareInstructions = &p.CareInstructions
+	}
+	if req.Tags.Set {
+		u.Tags = &p.Tags
+	}
+	return u
+}
+
+// productRequestOf describes p as a request, for applying a patch to it.
+func productRequestOf(p model.Product) productRequest {
+	return productRequest(catalog.RowOf(p))
+}
+
+type productImportRequest struct {
+	Products []productRequest `json:"products" validate:"required,max=1000"`
+}
+
+// imageOrderRequest lists the keys of the images of a product gallery in
+// their new order.
+type imageOrderRequest struct {
+	Keys []string `json:"keys" validate:"max=20,dive,required,max=255"`
+}
+
+type variantRequest struct {
+	SKU   string       `json:"sku" validate:"max=64"`
+	Size  string       `json:"size" validate:"required,max=20"`
+	Color string       `json:"color" validate:"required,max=40"`
+	Price *money.Money `json:"price" validate:"gt=0"`
+	Image string       `json:"image" validate:"max=255"`
+}
+
+// exchangeRateRequest sets how much one unit of the currency of the store
+// is worth in another currency.
+type exchangeRateRequest struct {
+	Rate money.Decimal `json:"rate" validate:"required,gt=0"`
+}
+
+type categoryRequest struct {
+	Slug     string `json:"slug" validate:"max=64"`
+	Name     string `json:"name" validate:"required,max=100"`
+	Parent   string `json:"parent" validate:"max=64"`
+	Position int    `json:"position" validate:"gte=0,lte=10000"`
+}
+
+type stockAdjustmentRequest struct {
+	SKU    string `json:"sku" validate:"max=64"`
+	Delta  int    `json:"delta" validate:"required,gte=-1000000,lte=1000000"`
+	Reason string `json:"reason" validate:"required,max=200"`
+}
+
+type stockQuantityRequest struct {
+	SKU      string `json:"sku" validate:"max=64"`
+	Quantity int    `json:"quantity" validate:"required,gt=0,lte=1000000"`
+}
+
+type productIDRequest struct {
+	ID int `json:"id" validate:"required,gt=0"`
+}
+
+type productNameRequest struct {
+	Name string `json:"name" validate:"required,max=200"`
+}
+
+type userCreateRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=6,max=128"`
+	Username string `json:"username" validate:"required,min=3,max=50"`
+}
+
+type userUpdateRequest struct {
+	Email    string  `json:"email" validate:"required,email"`
+	Username *string `json:"username,omitempty" validate:"min=3,max=50"`
+	Password *string `json:"password,omitempty" validate:"min=6,max=128"`
+}
+
+type userEmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type usernameRequest struct {
+	Username string `json:"username" validate:"required,max=50"`
+}
+
+type promotionalEmailRequest struct {
+	To      string `json:"to" validate:"required,email"`
+	Subject string `json:"subject" validate:"required,max=200"`
+	Body    string `json:"body" validate:"required,max=10000"`
+}
+
+type loginRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type signupRequest struct {
+	Name            string `json:"name" validate:"required,min=3,max=50"`
+	Email           string `json:"email" validate:"required,email"`
+	Password        string `json:"password" validate:"required,min=6,max=128"`
+	ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=Password"`
+}
+
+// isJSON reports whether r carries a JSON body rather than form values.
+func isJSON(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// decodeRequest strictly decodes the JSON body of r into dst and validates
+// it. On failure it logs the reason, writes the error envelope and returns
+// false.
+func decodeRequest(w http.ResponseWriter, r *http.Request, logger *logrus.Logger, dst interface{}) bool {
+	if err := validation.DecodeAndValidate(r.Body, dst); err != nil {
+		rejectRequest(w, r, logger, err)
+		return false
+	}
+	return true
+}
+
+// validateRequest validates a request that was not read from a JSON body,
+// such as one built from form values.
+func validateRequest(w http.ResponseWriter, r *http.Request, logger *logrus.Logger, req interface{}) bool {
+	if errs := validation.Struct(req); len(errs) > 0 {
+		rejectRequest(w, r, logger, errs)
+		return false
+	}
+	return true
+}
+
+func rejectRequest(w http.ResponseWriter, r *http.Request, logger *logrus.Logger, err error) {
+	logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "validation",
+		"status": "fail",
+		"path":   r.URL.Path,
+		"error":  err.Error(),
+	}).Warn("Validation failed")
+	view.RenderError(w, r, view.RequestError(err))
+}
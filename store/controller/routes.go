@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"net/http"
+
+	"store/middleware"
+)
+
+// APIPrefix is the path prefix of the current version of the REST API.
+const APIPrefix = "/api/v1"
+
+// Handlers groups the handler types whose routes are registered together.
+// Every route is bounded by Limits, except for those accepting file uploads,
+// which use UploadLimits instead.
+type Handlers struct {
+	Products   *ProductHandler
+	Inventory  *InventoryHandler
+	Categories *CategoryHandler
+	Users      *UserHandler
+	Auth       *AuthHandler
+	Email      *EmailHandler
+	Trash      *TrashHandler
+	Rates      *ExchangeRateHandler
+
+	Limits       middleware.Limits
+	UploadLimits middleware.Limits
+}
+
+// Register adds the versioned REST routes and the deprecated RPC-style
+// aliases to mux.
+func (hs Handlers) Register(mux *http.ServeMux) {
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, middleware.Limit(hs.Limits)(h))
+	}
+	upload := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, middleware.Limit(hs.UploadLimits)(h))
+	}
+	// The timeout buffers whole responses, so streamed ones go without it
+	// and end when the client goes away.
+	stream := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, middleware.Limit(middleware.Limits{MaxBodyBytes: hs.Limits.MaxBodyBytes})(h))
+	}
+
+	handle("GET "+APIPrefix+"/products", hs.Products.AllProducts)
+	upload("POST "+APIPrefix+"/products", hs.Products.HandleProductPostRequest)
+	handle("GET "+APIPrefix+"/products/search", hs.Products.SearchProducts)
+	upload("POST "+APIPrefix+"/products/import", hs.Products.ImportProducts)
+	stream("GET "+APIPrefix+"/products/export", hs.Products.ExportProducts)
+	handle("GET "+APIPrefix+"/products/{id}", hs.Products.GetProduct)
+	handle("PUT "+APIPrefix+"/products/{id}", hs.Products.UpdateProduct)
+	upload("PATCH "+APIPrefix+"/products/{id}", hs.Products.PatchProduct)
+	handle("DELETE "+APIPrefix+"/products/{id}", hs.Products.DeleteProduct)
+
+	upload("POST "+APIPrefix+"/products/{id}/images", hs.Products.AddProductImages)
+	handle("PUT "+APIPrefix+"/products/{id}/images", hs.Products.ReorderProductImages)
+	handle("DELETE "+APIPrefix+"/products/{id}/images/{key...}", hs.Products.DeleteProductImage)
+
+	handle("GET "+APIPrefix+"/products/{id}/variants", hs.Products.ListVariants)
+	handle("POST "+APIPrefix+"/products/{id}/variants", hs.Products.CreateVariant)
+	handle("GET "+APIPrefix+"/products/{id}/variants/{sku}", hs.Products.GetVariant)
+	handle("PUT "+APIPrefix+"/products/{id}/variants/{sku}", hs.Products.UpdateVariant)
+	handle("DELETE "+APIPrefix+"/products/{id}/variants/{sku}", hs.Products.DeleteVariant)
+
+	handle("GET "+APIPrefix+"/products/{id}/inventory", hs.Inventory.GetInventory)
+	handle("GET "+APIPrefix+"/products/{id}/inventory/history", hs.Inventory.InventoryHistory)
+	handle("POST "+APIPrefix+"/products/{id}/inventory/adjustments", hs.Inventory.AdjustInventory)
+	handle("POST "+APIPrefix+"/products/{id}/inventory/reservations", hs.Inventory.ReserveInventory)
+	handle("POST "+APIPrefix+"/products/{id}/inventory/releases", hs.Inventory.ReleaseInventory)
+	handle("POST "+APIPrefix+"/products/{id}/inventory/commits", hs.Inventory.CommitInventory)
+
+	handle("GET "+APIPrefix+"/categories", hs.Categories.AllCategories)
+	handle("POST "+APIPrefix+"/categories", hs.Categories.CreateCategory)
+	handle("GET "+APIPrefix+"/categories/{slug}", hs.Categories.GetCategory)
+	handle("PUT "+APIPrefix+"/categories/{slug}", hs.Categories.UpdateCategory)
+	handle("DELETE "+APIPrefix+"/categories/{slug}", hs.Categories.DeleteCategory)
+
+	handle("GET "+APIPrefix+"/users", hs.Users.AllUsers)
+	handle("POST "+APIPrefix+"/users", hs.Users.HandleUserPostRequest)
+	handle("GET "+APIPrefix+"/users/{id}", hs.Users.GetUser)
+	handle("PUT "+APIPrefix+"/users/{id}", hs.Users.UpdateUser)
+	handle("DELETE "+APIPrefix+"/users/{id}", hs.Users.DeleteUser)
+
+	handle("GET "+APIPrefix+"/admin/trash/products", hs.Trash.DeletedProducts)
+	handle("POST "+APIPrefix+"/admin/trash/products/{id}/restore", hs.Trash.RestoreProduct)
+	handle("GET "+APIPrefix+"/admin/trash/users", hs.Trash.DeletedUsers)
+	handle("POST "+APIPrefix+"/admin/trash/users/{id}/restore", hs.Trash.RestoreUser)
+
+	handle("GET "+APIPrefix+"/exchange-rates", hs.Rates.AllExchangeRates)
+	handle("PUT "+APIPrefix+"/admin/exchange-rates/{currency}", hs.Rates.SetExchangeRate)
+	handle("DELETE "+APIPrefix+"/admin/exchange-rates/{currency}", hs.Rates.DeleteExchangeRate)
+
+	handle("POST "+APIPrefix+"/emails", hs.Email.SendPromotionalEmail)
+
+	handle("POST "+APIPrefix+"/auth/signup", hs.Auth.SignUp)
+	handle("POST "+APIPrefix+"/auth/login", hs.Auth.Login)
+
+	handle("/allProducts", deprecated(APIPrefix+"/products", hs.Products.AllProducts))
+	upload("/postProduct", deprecated(APIPrefix+"/products", hs.Products.HandleProductPostRequest))
+	handle("/getProductByID", deprecated(APIPrefix+"/products/{id}", hs.Products.GetProductByID))
+	handle("/getProductByName", deprecated(APIPrefix+"/products/search?q=", hs.Products.GetProductByName))
+	upload("/updateProductById", deprecated(APIPrefix+"/products/{id}", hs.Products.UpdateProductByID))
+	handle("/deleteProductById", deprecated(APIPrefix+"/products/{id}", hs.Products.DeleteProductByID))
+
+	handle("/allUsers", deprecated(APIPrefix+"/users", hs.Users.AllUsers))
+	handle("/postUser", deprecated(APIPrefix+"/users", hs.Users.HandleUserPostRequest))
+	handle("/getUserEmail", deprecated(APIPrefix+"/users/{id}", hs.Users.GetUserByEmail))
+	handle("/getUsername", deprecated(APIPrefix+"/users?username=", hs.Users.GetUserByUsername))
+	handle("/updateUserByEmail", deprecated(APIPrefix+"/users/{id}", hs.Users.UpdateUserByEmail))
+	handle("/deleteUserByEmail", deprecated(APIPrefix+"/users/{id}", hs.Users.DeleteUserByEmail))
+
+	handle("/sendEmail", deprecated(APIPrefix+"/emails", hs.Email.SendPromotionalEmail))
+
+	handle("/signup", hs.Auth.SignUp)
+	handle("/login", hs.Auth.Login)
+}
+
+// deprecated marks a legacy route with a Deprecation header and a Link to the
+// route that replaces it, then serves it with the original handler.
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+		next(w, r)
+	}
+}
@@ -0,0 +1,1172 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"store/blob"
+	"store/config"
+	"store/images"
+	"store/inventory"
+	"store/model"
+	"store/money"
+	"store/pricing"
+	"store/repository"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+func newTestMux() *http.ServeMux {
+	logger := logrus.New()
+	users := repository.NewMemoryUserRepository()
+	products := repository.NewMemoryProductRepository()
+	categories := repository.NewMemoryCategoryRepository()
+	stock := inventory.NewService(repository.NewMemoryInventoryRepository(), products, nil, config.Default().Inventory, logger)
+	prices := testPricing()
+	mux := http.NewServeMux()
+	Handlers{
+		Products:   NewProductHandler(products, categories, images.NewStore(blob.NewFileStore("uploads", "/uploads")), prices, stock, logger),
+		Inventory:  NewInventoryHandler(products, stock, logger),
+		Categories: NewCategoryHandler(categories, logger),
+		Users:      NewUserHandler(users, rate.NewLimiter(rate.Inf, 1), logger),
+		Auth:       NewAuthHandler(users, nil, logger),
+		Email:      NewEmailHandler(nil, logger),
+		Trash:      NewTrashHandler(products, users, logger),
+		Rates:      NewExchangeRateHandler(prices, logger),
+	}.Register(mux)
+	return mux
+}
+
+// testPricing returns a pricing service for a store selling in USD, with
+// no exchange rates yet.
+func testPricing() *pricing.Service {
+	return pricing.NewService(repository.NewMemoryExchangeRateRepository(), config.PricingConfig{Currency: "USD"})
+}
+
+// testStock returns an inventory service for products that sends no
+// alerts.
+func testStock(products repository.ProductRepository) *inventory.Service {
+	return inventory.NewService(repository.NewMemoryInventoryRepository(), products, nil, config.Default().Inventory, logrus.New())
+}
+
+func usd(cents int64) money.Money {
+	return money.Money{Amount: cents, Currency: "USD"}
+}
+
+// importProducts stores products with the IDs they are given.
+func importProducts(t *testing.T, mux *http.ServeMux, products ...string) {
+	t.Helper()
+	body := `{"products": [` + strings.Join(products, ", ") + `]}`
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/products/import", strings.NewReader(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("import products: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestVersionedProductRoutes(t *testing.T) {
+	mux := newTestMux()
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"POST", "/api/v1/products", `{"name": "Shirt", "price": {"amount": "25", "currency": "USD"}}`, http.StatusOK},
+		{"GET", "/api/v1/products/1", "", http.StatusOK},
+		{"PUT", "/api/v1/products/1", `{"name": "Shirt", "price": {"amount": "20", "currency": "USD"}}`, http.StatusOK},
+		{"GET", "/api/v1/products/abc", "", http.StatusBadRequest},
+		{"PATCH", "/api/v1/products/1", `{"price": {"amount": "22", "currency": "USD"}}`, http.StatusOK},
+		{"POST", "/api/v1/products/1", "", http.StatusMethodNotAllowed},
+		{"DELETE", "/api/v1/products/1", "", http.StatusOK},
+		{"GET", "/api/v1/products/1", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: expected status %v, got %v", tt.method, tt.path, tt.status, rr.Code)
+		}
+	}
+}
+
+func TestLegacyRoutesAreDeprecated(t *testing.T) {
+	mux := newTestMux()
+
+	req := httptest.NewRequest("GET", "/allProducts", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %v, got %v", http.StatusOK, rr.Code)
+	}
+	if rr.Header().Get("Deprecation") != "true" {
+		t.Errorf("Expected Deprecation header, got %q", rr.Header().Get("Deprecation"))
+	}
+	if rr.Header().Get("Link") != `</api/v1/products>; rel="successor-version"` {
+		t.Errorf("Unexpected Link header %q", rr.Header().Get("Link"))
+	}
+}
+
+func TestRequestValidationErrors(t *testing.T) {
+	mux := newTestMux()
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"/api/v1/products", `{"id": "7", "name": "Shirt", "price": {"amount": "25", "currency": "USD"}}`, http.StatusBadRequest, `"VALIDATION_FAILED"`},
+		{"/api/v1/products", `{"id": 7, "name": "Shirt", "price": {"amount": "25", "currency": "USD"}, "admin": true}`, http.StatusBadRequest, `"VALIDATION_FAILED"`},
+		{"/api/v1/products", `{"id": 7,`, http.StatusBadRequest, `"INVALID_JSON"`},
+		{"/api/v1/products", `{"id": 7, "name": "Shirt", "price": {"amount": "25", "currency": "USD"}}`, http.StatusBadRequest, `"field":"id"`},
+		{"/api/v1/users", `{"email": "nope", "password": "123", "username": "al"}`, http.StatusBadRequest, `"VALIDATION_FAILED"`},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: expected status %v, got %v", tt.path, tt.body, tt.status, rr.Code)
+		}
+		if !bytes.Contains(rr.Body.Bytes(), []byte(tt.code)) {
+			t.Errorf("%s %s: expected %s in %s", tt.path, tt.body, tt.code, rr.Body.String())
+		}
+	}
+}
+
+func TestProductAttributes(t *testing.T) {
+	mux := newTestMux()
+
+	body := `{"name": "Linen Shirt", "price": {"amount": "49.9", "currency": "USD"}, "description": "Relaxed fit",
+		"category": "shirts", "brand": "Northwind", "gender": "women",
+		"sizes": ["S", "M", " M ", "L"], "colors": ["white", "sand"],
+		"material": "100% linen", "careInstructions": "Machine wash cold", "tags": ["summer"]}`
+	req := httptest.NewRequest("POST", "/api/v1/products", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("create: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/1", nil))
+	var resp struct {
+		Data model.Product `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	got := resp.Data
+	if got.Gender != model.GenderWomen || got.Brand != "Northwind" || got.CareInstructions != "Machine wash cold" {
+		t.Errorf("attributes not returned: %+v", got)
+	}
+	if len(got.Sizes) != 3 || got.Sizes[2] != "L" {
+		t.Errorf("expected sizes to be trimmed and de-duplicated, got %v", got.Sizes)
+	}
+
+	// Products created with only the original fields get defaults.
+	req = httptest.NewRequest("POST", "/api/v1/products", bytes.NewBufferString(`{"name": "Cap", "price": {"amount": "9", "currency": "USD"}}`))
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/2", nil))
+	if !bytes.Contains(rr.Body.Bytes(), []byte(`"gender":"unisex"`)) || !bytes.Contains(rr.Body.Bytes(), []byte(`"sizes":[]`)) {
+		t.Errorf("expected default attributes, got %s", rr.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/api/v1/products", bytes.NewBufferString(`{"name": "Cap", "price": {"amount": "9", "currency": "USD"}, "image": "products/other.png"}`))
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"field":"image"`) {
+		t.Errorf("expected 400 for an image key sent instead of a file, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/api/v1/products", bytes.NewBufferString(`{"name": "Cap", "price": {"amount": "9", "currency": "USD"}, "gender": "dogs"}`))
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest || !bytes.Contains(rr.Body.Bytes(), []byte(`"field":"gender"`)) {
+		t.Errorf("expected gender to be rejected, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestProductVariants(t *testing.T) {
+	mux := newTestMux()
+	importProducts(t, mux, `{"id": 12, "name": "Basic Tee", "price": {"amount": "20", "currency": "USD"}}`)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"POST", "/api/v1/products/12/variants", `{"size": "M", "color": "Navy Blue"}`, http.StatusCreated},
+		{"POST", "/api/v1/products/12/variants", `{"sku": "TEE-L-BLK", "size": "L", "color": "black", "price": {"amount": "22.5", "currency": "USD"}}`, http.StatusCreated},
+		{"POST", "/api/v1/products/12/variants", `{"size": "M", "color": "Navy Blue"}`, http.StatusConflict},
+		{"POST", "/api/v1/products/12/variants", `{"sku": "TEE-L-BLK", "size": "S", "color": "black"}`, http.StatusConflict},
+		{"POST", "/api/v1/products/12/variants", `{"sku": "bad sku", "size": "S", "color": "black"}`, http.StatusBadRequest},
+		{"POST", "/api/v1/products/99/variants", `{"size": "S", "color": "black"}`, http.StatusNotFound},
+		{"POST", "/api/v1/products/12/variants", `{"size": "S", "color": "black", "image": "products/other.png"}`, http.StatusBadRequest},
+		{"GET", "/api/v1/products/12/variants/12-M-NAVY-BLUE", "", http.StatusOK},
+		{"PUT", "/api/v1/products/12/variants/TEE-L-BLK", `{"size": "L", "color": "black", "image": "products/other.png"}`, http.StatusBadRequest},
+		{"PUT", "/api/v1/products/12/variants/TEE-L-BLK", `{"size": "M", "color": "Navy Blue"}`, http.StatusConflict},
+		{"PUT", "/api/v1/products/12/variants/TEE-L-BLK", `{"size": "XL", "color": "black"}`, http.StatusOK},
+		{"PUT", "/api/v1/products/12/variants/NOPE", `{"size": "XL", "color": "black"}`, http.StatusNotFound},
+		{"DELETE", "/api/v1/products/12/variants/12-M-NAVY-BLUE", "", http.StatusOK},
+		{"GET", "/api/v1/products/12/variants/12-M-NAVY-BLUE", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body)))
+		if rr.Code != tt.status {
+			t.Errorf("%s %s %s: expected status %d, got %d: %s", tt.method, tt.path, tt.body, tt.status, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products?name=Basic", nil))
+	var resp struct {
+		Data []model.Product `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || len(resp.Data) != 1 {
+		t.Fatalf("expected one product, got %s", rr.Body.String())
+	}
+	product := resp.Data[0]
+	if len(product.Variants) != 1 || product.Variants[0].SKU != "TEE-L-BLK" {
+		t.Errorf("expected the remaining variant in the listing, got %+v", product.Variants)
+	}
+	if product.PriceOf(product.Variants[0]) != usd(2000) {
+		t.Errorf("expected the replaced variant to fall back to the product price, got %v", product.PriceOf(product.Variants[0]))
+	}
+	if len(product.Sizes) != 3 || len(product.Colors) != 2 {
+		t.Errorf("expected variant sizes and colors on the product, got %v %v", product.Sizes, product.Colors)
+	}
+}
+
+func TestProductInventory(t *testing.T) {
+	mux := newTestMux()
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"POST", "/api/v1/products/import", `{"products": [{"id": 30, "name": "Mug", "price": {"amount": "8", "currency": "USD"}}]}`, http.StatusCreated},
+		{"POST", "/api/v1/products/import", `{"products": [{"id": 31, "name": "Tee", "price": {"amount": "20", "currency": "USD"}}]}`, http.StatusCreated},
+		{"POST", "/api/v1/products/31/variants", `{"sku": "TEE-M", "size": "M", "color": "red"}`, http.StatusCreated},
+
+		{"POST", "/api/v1/products/30/inventory/reservations", `{"quantity": 1}`, http.StatusNotFound},
+		{"POST", "/api/v1/products/30/inventory/adjustments", `{"delta": 5, "reason": "delivery"}`, http.StatusOK},
+		{"POST", "/api/v1/products/30/inventory/adjustments", `{"delta": 5}`, http.StatusBadRequest},
+		{"POST", "/api/v1/products/30/inventory/adjustments", `{"sku": "TEE-M", "delta": 5, "reason": "delivery"}`, http.StatusBadRequest},
+		{"POST", "/api/v1/products/30/inventory/reservations", `{"quantity": 0}`, http.StatusBadRequest},
+		{"POST", "/api/v1/products/30/inventory/reservations", `{"quantity": 4}`, http.StatusOK},
+		{"POST", "/api/v1/products/30/inventory/reservations", `{"quantity": 2}`, http.StatusConflict},
+		{"POST", "/api/v1/products/30/inventory/commits", `{"quantity": 3}`, http.StatusOK},
+		{"POST", "/api/v1/products/30/inventory/releases", `{"quantity": 1}`, http.StatusOK},
+		{"POST", "/api/v1/products/30/inventory/releases", `{"quantity": 1}`, http.StatusConflict},
+
+		{"POST", "/api/v1/products/31/inventory/adjustments", `{"delta": 2, "reason": "delivery"}`, http.StatusBadRequest},
+		{"POST", "/api/v1/products/31/inventory/adjustments", `{"sku": "TEE-XL", "delta": 2, "reason": "delivery"}`, http.StatusNotFound},
+		{"POST", "/api/v1/products/31/inventory/adjustments", `{"sku": "TEE-M", "delta": 2, "reason": "delivery"}`, http.StatusOK},
+		{"GET", "/api/v1/products/99/inventory", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body)))
+		if rr.Code != tt.status {
+			t.Errorf("%s %s %s: expected status %d, got %d: %s", tt.method, tt.path, tt.body, tt.status, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/30/inventory", nil))
+	var levels struct {
+		Data []model.StockLevel `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &levels); err != nil || len(levels.Data) != 1 {
+		t.Fatalf("expected one stock level, got %s", rr.Body.String())
+	}
+	if l := levels.Data[0]; l.OnHand != 2 || l.Reserved != 0 || l.Available != 2 {
+		t.Errorf("expected 2 on hand and available, got %+v", l)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/30/inventory/history", nil))
+	var history struct {
+		Data []model.StockAdjustment `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil || len(history.Data) != 1 || history.Data[0].Reason != "delivery" {
+		t.Errorf("expected the delivery in the history, got %s", rr.Body.String())
+	}
+}
+
+func TestVariantStock(t *testing.T) {
+	mux := newTestMux()
+	send := func(method, path, body string, status int) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		if rr.Code != status {
+			t.Fatalf("%s %s %s: expected status %d, got %d: %s", method, path, body, status, rr.Code, rr.Body.String())
+		}
+	}
+	get := func() model.Product {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/32", nil))
+		var resp struct {
+			Data model.Product `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	send("POST", "/api/v1/products/import", `{"products": [{"id": 32, "name": "Tee", "price": {"amount": "20", "currency": "USD"}}]}`, http.StatusCreated)
+	send("POST", "/api/v1/products/32/inventory/adjustments", `{"delta": 4, "reason": "delivery"}`, http.StatusOK)
+	send("POST", "/api/v1/products/32/variants", `{"sku": "TEE-S", "size": "S", "color": "red"}`, http.StatusCreated)
+	if get().InStock {
+		t.Error("expected the stock of the product itself not to count once it has variants")
+	}
+
+	send("POST", "/api/v1/products/32/inventory/adjustments", `{"sku": "TEE-S", "delta": 3, "reason": "delivery"}`, http.StatusOK)
+	if p := get(); !p.InStock || len(p.Variants) != 1 || p.Variants[0].Stock != 3 {
+		t.Errorf("expected the variant with 3 units in stock, got %+v", p)
+	}
+
+	send("DELETE", "/api/v1/products/32/variants/TEE-S", "", http.StatusOK)
+	if !get().InStock {
+		t.Error("expected the stock of the product itself to count again once it has no variants")
+	}
+	send("POST", "/api/v1/products/32/variants", `{"sku": "TEE-S", "size": "S", "color": "red"}`, http.StatusCreated)
+	if p := get(); p.InStock || p.Variants[0].Stock != 0 {
+		t.Errorf("expected a variant created again to start without stock, got %+v", p)
+	}
+}
+
+func TestCategoryTree(t *testing.T) {
+	mux := newTestMux()
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"POST", "/api/v1/categories", `{"name": "Men", "position": 1}`, http.StatusCreated},
+		{"POST", "/api/v1/categories", `{"name": "Women", "position": 2}`, http.StatusCreated},
+		{"POST", "/api/v1/categories", `{"name": "Kids", "position": 3}`, http.StatusCreated},
+		{"POST", "/api/v1/categories", `{"name": "Men's Jeans", "parent": "men"}`, http.StatusCreated},
+		{"POST", "/api/v1/categories", `{"slug": "slim-jeans", "name": "Slim", "parent": "men-s-jeans"}`, http.StatusCreated},
+		{"POST", "/api/v1/categories", `{"name": "Men"}`, http.StatusConflict},
+		{"POST", "/api/v1/categories", `{"name": "Hats", "parent": "nope"}`, http.StatusBadRequest},
+		{"POST", "/api/v1/categories", `{"slug": "Bad Slug", "name": "Hats"}`, http.StatusBadRequest},
+		{"POST", "/api/v1/categories", `{"name": "Шапки"}`, http.StatusBadRequest},
+		{"PUT", "/api/v1/categories/men", `{"name": "Men", "parent": "slim-jeans"}`, http.StatusBadRequest},
+		{"PUT", "/api/v1/categories/nope", `{"name": "Nope"}`, http.StatusNotFound},
+		{"PUT", "/api/v1/categories/kids", `{"name": "For Children", "position": 3}`, http.StatusOK},
+		{"DELETE", "/api/v1/categories/men", "", http.StatusConflict},
+
+		{"POST", "/api/v1/products/import", `{"products": [{"id": 40, "name": "Slim Jeans", "price": {"amount": "50", "currency": "USD"}, "category": "slim-jeans"}]}`, http.StatusCreated},
+		{"POST", "/api/v1/products/import", `{"products": [{"id": 41, "name": "Polo", "price": {"amount": "30", "currency": "USD"}, "category": "men"}]}`, http.StatusCreated},
+		{"POST", "/api/v1/products/import", `{"products": [{"id": 42, "name": "Dress", "price": {"amount": "60", "currency": "USD"}, "category": "women"}]}`, http.StatusCreated},
+		{"GET", "/api/v1/products?category=nope", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body)))
+		if rr.Code != tt.status {
+			t.Errorf("%s %s %s: expected status %d, got %d: %s", tt.method, tt.path, tt.body, tt.status, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/categories", nil))
+	var tree struct {
+		Data []model.CategoryNode `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &tree); err != nil || len(tree.Data) != 3 {
+		t.Fatalf("expected three top-level categories, got %s", rr.Body.String())
+	}
+	if tree.Data[0].Slug != "men" || tree.Data[2].Name != "For Children" {
+		t.Errorf("expected categories ordered by position, got %+v", tree.Data)
+	}
+	if men := tree.Data[0]; len(men.Children) != 1 || len(men.Children[0].Children) != 1 {
+		t.Errorf("expected men > men-s-jeans > slim-jeans, got %+v", men)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products?category=men", nil))
+	var resp struct {
+		Data []model.Product `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || len(resp.Data) != 2 {
+		t.Errorf("expected the products of men and its subcategories, got %s", rr.Body.String())
+	}
+}
+
+func TestProductSearch(t *testing.T) {
+	mux := newTestMux()
+	importProducts(t, mux,
+		`{"id": 50, "name": "Denim Jacket", "price": {"amount": "80", "currency": "USD"}, "description": "A blue denim jacket.", "tags": ["outerwear"]}`,
+		`{"id": 51, "name": "Slim Jeans", "price": {"amount": "50", "currency": "USD"}, "description": "Stretch denim (98% cotton).", "tags": ["denim", "jeans"]}`,
+		`{"id": 52, "name": "Cotton Tee (2-pack)", "price": {"amount": "20", "currency": "USD"}, "description": "Plain <b>white</b> tees."}`,
+	)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/search?q=denim", nil))
+	var resp struct {
+		Data []struct {
+			ID         int     `json:"id"`
+			Score      float64 `json:"score"`
+			Highlights struct {
+				Name        string   `json:"name"`
+				Description string   `json:"description"`
+				Tags        []string `json:"tags"`
+			} `json:"highlights"`
+		} `json:"data"`
+		Meta struct {
+			Total int `json:"total"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || len(resp.Data) != 2 || resp.Meta.Total != 2 {
+		t.Fatalf("expected two hits, got %s", rr.Body.String())
+	}
+	if resp.Data[0].ID != 50 || resp.Data[0].Score <= resp.Data[1].Score {
+		t.Errorf("expected the match in the name to rank first, got %+v", resp.Data)
+	}
+	if h := resp.Data[0].Highlights; h.Name != "<mark>Denim</mark> Jacket" || h.Description != "A blue <mark>denim</mark> jacket." {
+		t.Errorf("unexpected highlights %+v", h)
+	}
+	if h := resp.Data[1].Highlights; h.Name != "" || len(h.Tags) != 1 || h.Tags[0] != "<mark>denim</mark>" {
+		t.Errorf("unexpected highlights %+v", h)
+	}
+
+	for _, tt := range []struct {
+		path   string
+		status int
+	}{
+		{"/api/v1/products/search?q=%22.*%22", http.StatusBadRequest},
+		{"/api/v1/products/search?q=(2-pack", http.StatusOK},
+		{"/api/v1/products?name=(2-pack)", http.StatusOK},
+	} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if rr.Code != tt.status {
+			t.Errorf("GET %s: expected status %d, got %d: %s", tt.path, tt.status, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products?name=(2-pack)", nil))
+	var listed struct {
+		Data []model.Product `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &listed); err != nil || len(listed.Data) != 1 || listed.Data[0].ID != 52 {
+		t.Errorf("expected the name filter to match literally, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/getProductByName", bytes.NewBufferString(`{"name": "j"}`)))
+	if err := json.Unmarshal(rr.Body.Bytes(), &listed); err != nil || len(listed.Data) != 2 {
+		t.Errorf("expected every product whose name contains j, got %s", rr.Body.String())
+	}
+}
+
+func TestProductFacets(t *testing.T) {
+	mux := newTestMux()
+	for _, tt := range []struct{ path, body string }{
+		{"/api/v1/categories", `{"name": "Men"}`},
+		{"/api/v1/categories", `{"name": "Jeans", "parent": "men"}`},
+		{"/api/v1/products/import", `{"products": [{"id": 60, "name": "Slim Jeans", "price": {"amount": "60", "currency": "USD"}, "category": "jeans", "brand": "Levi's", "sizes": ["30", "32"], "colors": ["blue"]}]}`},
+		{"/api/v1/products/import", `{"products": [{"id": 61, "name": "Wide Jeans", "price": {"amount": "40", "currency": "USD"}, "category": "jeans", "brand": "Lee", "sizes": ["32"], "colors": ["black"]}]}`},
+		{"/api/v1/products/import", `{"products": [{"id": 62, "name": "Oxford Shirt", "price": {"amount": "30", "currency": "USD"}, "category": "men", "brand": "Lee", "sizes": ["M"], "colors": ["blue"]}]}`},
+		{"/api/v1/products/61/inventory/adjustments", `{"delta": 3, "reason": "delivery"}`},
+	} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body)))
+		if rr.Code >= 300 {
+			t.Fatalf("POST %s: %d %s", tt.path, rr.Code, rr.Body.String())
+		}
+	}
+
+	type listing struct {
+		Data []model.Product `json:"data"`
+		Meta struct {
+			Facets repository.ProductFacets `json:"facets"`
+		} `json:"meta"`
+	}
+	get := func(path string) listing {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		var resp listing
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", path, rr.Code, rr.Body.String())
+		}
+		return resp
+	}
+
+	resp := get("/api/v1/products?color=blue&brand=Lee,Levi%27s&maxPrice=50")
+	if len(resp.Data) != 1 || resp.Data[0].ID != 62 {
+		t.Errorf("expected only the shirt, got %+v", resp.Data)
+	}
+	facets := resp.Meta.Facets
+	// Each dimension is counted without its own filter.
+	if want := []repository.FacetCount{{Value: "black", Count: 1}, {Value: "blue", Count: 1}}; !slices.Equal(facets.Colors, want) {
+		t.Errorf("expected colors %v, got %v", want, facets.Colors)
+	}
+	if len(facets.Price) != 2 || facets.Price[0].Min != 25 || facets.Price[1].Min != 50 || facets.Price[1].Count != 1 {
+		t.Errorf("expected blue products in two price ranges, got %+v", facets.Price)
+	}
+	if want := []repository.FacetCount{{Value: "men", Count: 1}}; !slices.Equal(facets.Categories, want) {
+		t.Errorf("expected categories %v, got %v", want, facets.Categories)
+	}
+
+	resp = get("/api/v1/products?inStock=true")
+	if len(resp.Data) != 1 || resp.Data[0].ID != 61 || !resp.Data[0].InStock {
+		t.Errorf("expected only the product in stock, got %+v", resp.Data)
+	}
+	if c := resp.Meta.Facets.Categories; !slices.Equal(c, []repository.FacetCount{{Value: "jeans", Count: 1}, {Value: "men", Count: 1}}) {
+		t.Errorf("expected category counts rolled up to the parent, got %v", c)
+	}
+	if resp.Meta.Facets.InStock != 1 {
+		t.Errorf("expected one product in stock, got %d", resp.Meta.Facets.InStock)
+	}
+
+	for _, path := range []string{"/api/v1/products?minPrice=cheap", "/api/v1/products?minPrice=50&maxPrice=10", "/api/v1/products?inStock=maybe"} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected status 400, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestKeysetPagination(t *testing.T) {
+	mux := newTestMux()
+	// Two products share each price, so paging must break ties by ID.
+	var products []string
+	for id := 70; id < 77; id++ {
+		products = append(products, fmt.Sprintf(`{"id": %d, "name": "Item %d", "price": {"amount": "%d", "currency": "USD"}}`, id, id, 10+id/2))
+	}
+	importProducts(t, mux, products...)
+
+	type page struct {
+		Data []model.Product `json:"data"`
+		Meta struct {
+			Total      int    `json:"total"`
+			NextCursor string `json:"nextCursor"`
+			PrevCursor string `json:"prevCursor"`
+		} `json:"meta"`
+	}
+	get := func(path string) (page, http.Header) {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		var p page
+		if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", path, rr.Code, rr.Body.String())
+		}
+		return p, rr.Header()
+	}
+	ids := func(p page) []int {
+		var ids []int
+		for _, product := range p.Data {
+			ids = append(ids, product.ID)
+		}
+		return ids
+	}
+
+	first, header := get("/api/v1/products?sort=-price&limit=3")
+	if !slices.Equal(ids(first), []int{76, 74, 75}) || first.Meta.Total != 7 || first.Meta.PrevCursor != "" {
+		t.Fatalf("unexpected first page %v %+v", ids(first), first.Meta)
+	}
+	if link := header.Get("Link"); !strings.Contains(link, "cursor="+first.Meta.NextCursor) {
+		t.Errorf("expected a next link with the cursor, got %q", link)
+	}
+
+	second, _ := get("/api/v1/products?sort=-price&limit=3&cursor=" + first.Meta.NextCursor)
+	if !slices.Equal(ids(second), []int{72, 73, 70}) {
+		t.Errorf("unexpected second page %v", ids(second))
+	}
+	last, _ := get("/api/v1/products?sort=-price&limit=3&cursor=" + second.Meta.NextCursor)
+	if !slices.Equal(ids(last), []int{71}) || last.Meta.NextCursor != "" {
+		t.Errorf("unexpected last page %v %+v", ids(last), last.Meta)
+	}
+	back, _ := get("/api/v1/products?sort=-price&limit=3&cursor=" + second.Meta.PrevCursor)
+	if !slices.Equal(ids(back), ids(first)) || back.Meta.PrevCursor != "" {
+		t.Errorf("expected the previous page to be the first one, got %v %+v", ids(back), back.Meta)
+	}
+
+	legacy, _ := get("/api/v1/products?sort=-price&limit=3&page=2")
+	if !slices.Equal(ids(legacy), ids(second)) {
+		t.Errorf("expected page 2 to match the second page, got %v", ids(legacy))
+	}
+
+	for _, path := range []string{
+		"/api/v1/products?limit=-1",
+		"/api/v1/products?cursor=garbage",
+		"/api/v1/products?sort=name&cursor=" + second.Meta.PrevCursor,
+	} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected status 400, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestUserPagination(t *testing.T) {
+	mux := newTestMux()
+	for _, name := range []string{"carol", "alice", "bob"} {
+		body := fmt.Sprintf(`{"email": "%s@example.com", "password": "secret1", "username": "%s"}`, name, name)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/users", bytes.NewBufferString(body)))
+		if rr.Code >= 300 {
+			t.Fatalf("create user: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/users", strings.NewReader(`{"email": "Alice@example.com", "password": "secret1", "username": "alice2"}`)))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a taken email, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/users?limit=2", nil))
+	var resp struct {
+		Data []model.User `json:"data"`
+		Meta struct {
+			Total      int    `json:"total"`
+			NextCursor string `json:"nextCursor"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || len(resp.Data) != 2 || resp.Meta.Total != 3 {
+		t.Fatalf("expected two of three users, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/users?limit=2&cursor="+resp.Meta.NextCursor, nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || len(resp.Data) != 1 || resp.Data[0].Username != "carol" {
+		t.Errorf("expected carol on the second page, got %s", rr.Body.String())
+	}
+}
+
+func TestMultiFieldSort(t *testing.T) {
+	mux := newTestMux()
+	importProducts(t, mux,
+		`{"id": 80, "name": "Coat", "price": {"amount": "90", "currency": "USD"}}`,
+		`{"id": 81, "name": "Belt", "price": {"amount": "20", "currency": "USD"}}`,
+		`{"id": 82, "name": "Anorak", "price": {"amount": "90", "currency": "USD"}}`,
+		`{"id": 83, "name": "Belt", "price": {"amount": "20", "currency": "USD"}}`,
+	)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products?sort=-price,name", nil))
+	var resp struct {
+		Data []model.Product `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("list products: %d %s", rr.Code, rr.Body.String())
+	}
+	var ids []int
+	for _, p := range resp.Data {
+		ids = append(ids, p.ID)
+	}
+	// Equal prices are ordered by name and equal names by ID.
+	if !slices.Equal(ids, []int{82, 80, 81, 83}) {
+		t.Errorf("unexpected order %v", ids)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products?sort=-price,password", nil))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `cannot sort by \"password\"`) {
+		t.Errorf("expected 400 naming the field, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/users?sort=price", nil))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `cannot sort by \"price\"`) {
+		t.Errorf("expected users not to be sortable by price, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestServerAssignedProductIDs(t *testing.T) {
+	mux := newTestMux()
+	importProducts(t, mux, `{"id": 9, "name": "Old Shirt", "price": {"amount": "25", "currency": "USD"}}`)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/products", strings.NewReader(`{"name": "New Shirt", "price": {"amount": "30", "currency": "USD"}}`)))
+	var resp struct {
+		Data model.Product `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.Data.ID != 10 {
+		t.Errorf("expected the next ID after the imported one, got %s", rr.Body.String())
+	}
+
+	for _, tt := range []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{`{"products": [{"id": 9, "name": "Shirt", "price": {"amount": "25", "currency": "USD"}}]}`, http.StatusConflict, "9"},
+		{`{"products": [{"id": 20, "name": "A", "price": {"amount": "5", "currency": "USD"}}, {"id": 10, "name": "B", "price": {"amount": "5", "currency": "USD"}}]}`, http.StatusConflict, "10"},
+		{`{"products": [{"name": "Shirt", "price": {"amount": "25", "currency": "USD"}}]}`, http.StatusBadRequest, `"products[0].id"`},
+		{`{"products": [{"id": 21, "name": "A", "price": {"amount": "5", "currency": "USD"}}, {"id": 21, "name": "B", "price": {"amount": "5", "currency": "USD"}}]}`, http.StatusBadRequest, `"products[1].id"`},
+		{`{"products": [{"id": 22, "name": "A", "price": {"amount": "0", "currency": "USD"}}]}`, http.StatusBadRequest, `"products[0].price"`},
+		{`{"products": [{"id": 23, "sku": "A-1", "name": "A", "price": {"amount": "5", "currency": "USD"}}, {"id": 24, "sku": "A-1", "name": "B", "price": {"amount": "5", "currency": "USD"}}]}`, http.StatusBadRequest, `"products[1].sku"`},
+		{`{"products": [{"id": 25, "name": "A", "price": {"amount": "5", "currency": "USD"}, "image": "products/other.png"}]}`, http.StatusBadRequest, `"products[0].image"`},
+	} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/products/import", strings.NewReader(tt.body)))
+		if rr.Code != tt.status || !strings.Contains(rr.Body.String(), tt.want) {
+			t.Errorf("%s: expected %d with %s, got %d %s", tt.body, tt.status, tt.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Nothing is imported when one of the IDs is taken.
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/20", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected product 20 not to be imported, got %d", rr.Code)
+	}
+
+	// Nor when the ID belongs to a product in the trash, which only the
+	// repository sees.
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api/v1/products/10", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/products/import", strings.NewReader(
+		`{"products": [{"id": 26, "name": "A", "price": {"amount": "5", "currency": "USD"}}, {"id": 10, "name": "B", "price": {"amount": "5", "currency": "USD"}}]}`)))
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "nothing was imported") {
+		t.Errorf("expected 409 for an ID in the trash, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/26", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected product 26 not to be imported, got %d", rr.Code)
+	}
+}
+
+func TestPatchProduct(t *testing.T) {
+	dir := t.TempDir()
+	products := repository.NewMemoryProductRepository()
+	h := NewProductHandler(products, repository.NewMemoryCategoryRepository(), images.NewStore(blob.NewFileStore(dir, "/uploads")), testPricing(), testStock(products), logrus.New())
+	old := model.Product{ID: 4, Name: "Parka", Price: usd(12000), Image: "old.jpg", Brand: "North", Tags: []string{"winter"}}
+	if err := products.Import(context.Background(), &old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "old.jpg"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(contentType string, body io.Reader) (*httptest.ResponseRecorder, model.Product) {
+		req := httptest.NewRequest("PATCH", "/api/v1/products/4", body)
+		req.Header.Set("Content-Type", contentType)
+		req.SetPathValue("id", "4")
+		rr := httptest.NewRecorder()
+		h.PatchProduct(rr, req)
+		var resp struct {
+			Data model.Product `json:"data"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp.Data
+	}
+
+	rr, got := patch("application/json", strings.NewReader(`{"price": {"amount": "99.5", "currency": "USD"}, "brand": null, "tags": [" snow ", "snow"]}`))
+	if rr.Code != http.StatusOK || got.Price != usd(9950) || got.Brand != "" || !slices.Equal(got.Tags, []string{"snow"}) || got.Name != "Parka" {
+		t.Fatalf("unexpected patch result %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr, _ = patch("application/json", strings.NewReader(`{"name": null, "price": {"amount": "-1", "currency": "USD"}, "gender": "dogs"}`))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+	for _, field := range []string{`"field":"name"`, `"field":"price"`, `"field":"gender"`} {
+		if !strings.Contains(rr.Body.String(), field) {
+			t.Errorf("expected %s in %s", field, rr.Body.String())
+		}
+	}
+
+	// A key sent without a gallery could name the image of another product.
+	rr, _ = patch("application/json", strings.NewReader(`{"image": "products/0123456789abcdef0123456789abcdef.png"}`))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"field":"image"`) {
+		t.Errorf("expected 400 for an image key that is not in the gallery, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr, got = patch("application/json", strings.NewReader(`{"image": "old.jpg"}`)); rr.Code != http.StatusOK || got.Image != "old.jpg" {
+		t.Errorf("expected the current image to be accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("material", "Nylon")
+	part, _ := form.CreateFormFile("image", "new.png")
+	newImage := testPNG(t, 8, 4)
+	part.Write(newImage)
+	form.Close()
+	rr, got = patch(form.FormDataContentType(), &body)
+	if rr.Code != http.StatusOK || got.Material != "Nylon" || got.Image == "old.jpg" || got.Price != usd(9950) {
+		t.Fatalf("unexpected multipart patch result %d %s", rr.Code, rr.Body.String())
+	}
+	if len(got.Images) != 1 || got.Images[0].Key != got.Image || got.Images[0].Width != 8 {
+		t.Errorf("expected the upload to become the cover of the gallery, got %+v", got.Images)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.jpg")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the old image to be deleted, got %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(got.Image))); err != nil || !bytes.Equal(data, newImage) {
+		t.Errorf("expected the new image to be stored, got %q %v", data, err)
+	}
+
+	uploaded := got.Image
+	rr, got = patch("application/json", strings.NewReader(`{"image": null}`))
+	if rr.Code != http.StatusOK || got.Image != "" {
+		t.Errorf("expected the image to be cleared, got %d %s", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(uploaded))); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the cleared image to be deleted, got %v", err)
+	}
+}
+
+// testPNG encodes an opaque w×h PNG image.
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProductGallery(t *testing.T) {
+	dir := t.TempDir()
+	products := repository.NewMemoryProductRepository()
+	mux := http.NewServeMux()
+	Handlers{Products: NewProductHandler(products, repository.NewMemoryCategoryRepository(), images.NewStore(blob.NewFileStore(dir, "/uploads")), testPricing(), testStock(products), logrus.New())}.Register(mux)
+	importProducts(t, mux, `{"id": 1, "name": "Shirt", "price": {"amount": "25", "currency": "USD"}}`, `{"id": 2, "name": "Jeans", "price": {"amount": "40", "currency": "USD"}}`)
+
+	upload := func(id int, position string, files ...[]byte) (*httptest.ResponseRecorder, model.Product) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		if position != "" {
+			form.WriteField("position", position)
+		}
+		for i, data := range files {
+			part, _ := form.CreateFormFile("image", fmt.Sprintf("%d.png", i))
+			part.Write(data)
+		}
+		form.Close()
+		req := httptest.NewRequest("POST", fmt.Sprintf("/api/v1/products/%d/images", id), &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		var resp struct {
+			Data model.Product `json:"data"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp.Data
+	}
+	keys := func(p model.Product) []string {
+		var keys []string
+		for _, img := range p.Images {
+			keys = append(keys, img.Key)
+		}
+		return keys
+	}
+
+	rr, _ := upload(1, "", []byte("GIF89a not really"))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "JPEG, PNG or WebP") {
+		t.Fatalf("expected 400 for an unsupported file, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	a, b, c := testPNG(t, 2, 2), testPNG(t, 3, 3), testPNG(t, 4, 4)
+	rr, got := upload(1, "", a, b)
+	if rr.Code != http.StatusOK || len(got.Images) != 2 || got.Image != got.Images[0].Key {
+		t.Fatalf("add images: %d %s", rr.Code, rr.Body.String())
+	}
+	first, second := got.Images[0].Key, got.Images[1].Key
+	if !strings.HasPrefix(first, "products/") || got.Images[0].URL != "/uploads/"+first || got.ImageURL != got.Images[0].URL {
+		t.Errorf("expected a storage key and its URL for the cover too, got %+v %q", got.Images[0], got.ImageURL)
+	}
+	if _, got = upload(1, "0", c); len(got.Images) != 3 || got.Images[1].Key != first || got.Image != got.Images[0].Key {
+		t.Fatalf("expected the image to become the cover, got %v", keys(got))
+	}
+	third := got.Image
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/products/1/variants", strings.NewReader(`{"size": "M", "color": "red", "image": "`+third+`"}`)))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected a variant to take an image of the gallery, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/api/v1/products/1/images", strings.NewReader(`{"keys": ["`+second+`", "`+first+`"]}`))
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 when an image is left out, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("PUT", "/api/v1/products/1/images", strings.NewReader(`{"keys": ["`+second+`", "`+first+`", "`+third+`"]}`))
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"image":"`+second+`"`) {
+		t.Fatalf("reorder: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Product 2 shares the first image, so deleting it from product 1 keeps
+	// the file.
+	if rr, _ = upload(2, "", a); rr.Code != http.StatusOK {
+		t.Fatalf("add shared image: %d %s", rr.Code, rr.Body.String())
+	}
+	for _, file := range []string{first, second} {
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api/v1/products/1/images/"+file, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("delete image: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+	if !strings.Contains(rr.Body.String(), `"image":"`+third+`"`) {
+		t.Errorf("expected the remaining image to be the cover, got %s", rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(first))); err != nil {
+		t.Errorf("expected the shared image to be kept, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(second))); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the unused image to be deleted, got %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api/v1/products/1/images/"+second, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an image not in the gallery, got %d", rr.Code)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	mux := newTestMux()
+	importProducts(t, mux, `{"id": 1, "name": "Shirt", "price": {"amount": "25", "currency": "USD"}}`, `{"id": 2, "name": "Jeans", "price": {"amount": "40", "currency": "USD"}}`)
+
+	req := httptest.NewRequest("DELETE", "/api/v1/products/1", nil)
+	req.Header.Set("X-Actor", "jane")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("delete product: %d %s", rr.Code, rr.Body.String())
+	}
+
+	for _, path := range []string{"/api/v1/products/1", "/api/v1/products?name=shirt"} {
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusNotFound && strings.Contains(rr.Body.String(), "Shirt") {
+			t.Errorf("GET %s: expected the deleted product to be hidden, got %d %s", path, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/admin/trash/products", nil))
+	var trash struct {
+		Data []model.Product `json:"data"`
+		Meta struct {
+			Total int `json:"total"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &trash); err != nil || trash.Meta.Total != 1 || len(trash.Data) != 1 {
+		t.Fatalf("expected one product in the trash, got %d %s", rr.Code, rr.Body.String())
+	}
+	if p := trash.Data[0]; p.ID != 1 || p.DeletedBy != "jane" || p.DeletedAt == nil {
+		t.Errorf("expected product 1 deleted by jane, got %+v", p)
+	}
+
+	for _, tt := range []struct {
+		path   string
+		status int
+	}{
+		{"/api/v1/admin/trash/products/1/restore", http.StatusOK},
+		{"/api/v1/admin/trash/products/1/restore", http.StatusNotFound},
+		{"/api/v1/admin/trash/products/2/restore", http.StatusNotFound},
+		{"/api/v1/admin/trash/products/x/restore", http.StatusBadRequest},
+	} {
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("POST", tt.path, nil))
+		if rr.Code != tt.status {
+			t.Errorf("POST %s: expected %d, got %d %s", tt.path, tt.status, rr.Code, rr.Body.String())
+		}
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/1", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the restored product to be found, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/users",
+		strings.NewReader(`{"email": "shopper@example.com", "password": "secret1", "username": "shopper"}`)))
+	if rr.Code >= 300 {
+		t.Fatalf("create user: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api/v1/users/shopper@example.com", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("delete user: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/admin/trash/users", nil))
+	if !strings.Contains(rr.Body.String(), `"deletedBy":"anonymous"`) {
+		t.Errorf("expected the user to be deleted anonymously, got %s", rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/admin/trash/users/shopper@example.com/restore", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("restore user: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestBulkImportAndExport(t *testing.T) {
+	mux := newTestMux()
+	csv := "sku,name,price,brand\nTEE-1,Tee,20 USD,Acme\nJEANS-1,Jeans,45 USD,Denimco\nBAD-1,Bad,-1 USD,Acme\n"
+
+	importCSV := func(query string) (int, string) {
+		req := httptest.NewRequest("POST", "/api/v1/products/import"+query, strings.NewReader(csv))
+		req.Header.Set("Content-Type", "text/csv")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr.Code, rr.Body.String()
+	}
+	if code, body := importCSV("?dryRun=true"); code != http.StatusOK || !strings.Contains(body, `"created":2`) || !strings.Contains(body, `"price: must be greater than 0"`) {
+		t.Fatalf("dry run: %d %s", code, body)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products", nil))
+	if strings.Contains(rr.Body.String(), "TEE-1") {
+		t.Fatalf("expected the dry run not to create products, got %s", rr.Body.String())
+	}
+
+	if code, body := importCSV(""); code != http.StatusOK || !strings.Contains(body, `"failed":1`) {
+		t.Fatalf("import: %d %s", code, body)
+	}
+	if code, body := importCSV(""); code != http.StatusOK || !strings.Contains(body, `"updated":2`) {
+		t.Errorf("expected the second import to update by SKU, got %d %s", code, body)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/export?format=jsonl&brand=Acme", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/jsonl" {
+		t.Fatalf("export: %d %v %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	if lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"sku":"TEE-1"`) {
+		t.Errorf("expected only the Acme product, got %q", lines)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/export?format=xml", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", rr.Code)
+	}
+}
+
+func TestExchangeRatesAndCurrencies(t *testing.T) {
+	mux := newTestMux()
+	importProducts(t, mux,
+		`{"id": 1, "name": "Shirt", "price": {"amount": "25", "currency": "USD"}, "prices": [{"amount": "19", "currency": "GBP"}]}`,
+		`{"id": 2, "name": "Jeans", "price": {"amount": "40", "currency": "USD"}}`)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		contains           string
+	}{
+		{"PUT", "/api/v1/admin/exchange-rates/eur", `{"rate": "0.925"}`, http.StatusOK, `"rate":"0.925"`},
+		{"PUT", "/api/v1/admin/exchange-rates/GBP", `{"rate": 0.8}`, http.StatusOK, `"currency":"GBP"`},
+		{"PUT", "/api/v1/admin/exchange-rates/USD", `{"rate": "1"}`, http.StatusBadRequest, "currency of the store"},
+		{"PUT", "/api/v1/admin/exchange-rates/XXX", `{"rate": "1"}`, http.StatusBadRequest, "ISO 4217"},
+		{"PUT", "/api/v1/admin/exchange-rates/JPY", `{"rate": "0"}`, http.StatusBadRequest, `"field":"rate"`},
+		{"PUT", "/api/v1/admin/exchange-rates/JPY", `{"rate": "cheap"}`, http.StatusBadRequest, "decimal number"},
+		{"GET", "/api/v1/exchange-rates", "", http.StatusOK, `"currency":"USD","rates":[{"currency":"EUR"`},
+		{"GET", "/api/v1/products?sort=id&currency=EUR", "", http.StatusOK, `"price":{"amount":"23.13","currency":"EUR"}`},
+		{"GET", "/api/v1/products?sort=id&currency=EUR", "", http.StatusOK, `"price":{"amount":"37.00","currency":"EUR"}`},
+		{"GET", "/api/v1/products/1?currency=gbp", "", http.StatusOK, `"price":{"amount":"19.00","currency":"GBP"}`},
+		{"GET", "/api/v1/products/2?currency=GBP", "", http.StatusOK, `"price":{"amount":"32.00","currency":"GBP"}`},
+		{"GET", "/api/v1/products/2?currency=USD", "", http.StatusOK, `"price":{"amount":"40.00","currency":"USD"}`},
+		{"GET", "/api/v1/products?currency=JPY", "", http.StatusBadRequest, "has no exchange rate"},
+		{"GET", "/api/v1/products?currency=XXX", "", http.StatusBadRequest, `"field":"currency"`},
+		{"POST", "/api/v1/products", `{"name": "Cap", "price": {"amount": "9", "currency": "EUR"}}`, http.StatusBadRequest, "the currency of the store"},
+		{"POST", "/api/v1/products", `{"name": "Cap", "price": {"amount": "9", "currency": "USD"}, "prices": [{"amount": "8", "currency": "EUR"}, {"amount": "7", "currency": "EUR"}]}`, http.StatusBadRequest, `"field":"prices[1]"`},
+		{"DELETE", "/api/v1/admin/exchange-rates/EUR", "", http.StatusOK, "deleted"},
+		{"DELETE", "/api/v1/admin/exchange-rates/EUR", "", http.StatusNotFound, "EUR"},
+		{"GET", "/api/v1/products?currency=EUR", "", http.StatusBadRequest, "has no exchange rate"},
+	}
+	for _, tt := range tests {
+		rr := do(tt.method, tt.path, tt.body)
+		if rr.Code != tt.status || !strings.Contains(rr.Body.String(), tt.contains) {
+			t.Errorf("%s %s %s: expected %d with %s, got %d %s", tt.method, tt.path, tt.body, tt.status, tt.contains, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Prices are stored in the currency of the store whatever clients see.
+	rr := do("GET", "/api/v1/products/2", "")
+	if !strings.Contains(rr.Body.String(), `"price":{"amount":"40.00","currency":"USD"}`) {
+		t.Errorf("expected the stored price, got %s", rr.Body.String())
+	}
+}
+
+// countingCategories counts how often the category tree is loaded.
+type countingCategories struct {
+	repository.CategoryRepository
+	lists int
+}
+
+func (c *countingCategories) List(ctx context.Context) (model.Categories, error) {
+	c.lists++
+	return c.CategoryRepository.List(ctx)
+}
+
+func TestProductListingLoadsCategoriesOnlyWhenNeeded(t *testing.T) {
+	categories := &countingCategories{CategoryRepository: repository.NewMemoryCategoryRepository()}
+	categories.Create(context.Background(), &model.Category{Slug: "men", Name: "Men"})
+	products := repository.NewMemoryProductRepository()
+	mux := http.NewServeMux()
+	Handlers{Products: NewProductHandler(products, categories, images.NewStore(blob.NewFileStore("uploads", "/uploads")), testPricing(), testStock(products), logrus.New())}.Register(mux)
+	importProducts(t, mux, `{"id": 1, "name": "Shirt", "price": {"amount": "25", "currency": "USD"}}`)
+
+	for path, lists := range map[string]int{
+		"/api/v1/products":              0,
+		"/api/v1/products?category=men": 1,
+		"/api/v1/products/export":       0,
+	} {
+		categories.lists = 0
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK || categories.lists != lists {
+			t.Errorf("GET %s: expected %d loads of the category tree, got %d (status %d)", path, lists, categories.lists, rr.Code)
+		}
+	}
+}
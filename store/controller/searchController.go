@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"net/http"
+	"store/pagination"
+	"store/repository"
+	"store/search"
+	"store/validation"
+	"store/view"
+
+	"github.com/sirupsen/logrus"
+)
+
+// snippetWidth is about how many characters of a description are returned
+// around its first match.
+const snippetWidth = 160
+
+// productSearchResult is a search hit with its matches highlighted.
+type productSearchResult struct {
+	repository.ProductHit
+	Highlights productHighlights `json:"highlights"`
+}
+
+// productHighlights holds the matching fields of a product, HTML-escaped and
+// with the matching words wrapped in <mark> tags. Fields without a match are
+// left out.
+type productHighlights struct {
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+type searchMeta struct {
+	pagination.Meta
+	Query string   `json:"query"`
+	Terms []string `json:"terms"`
+}
+
+func highlightProduct(hit repository.ProductHit, terms []string) productSearchResult {
+	result := productSearchResult{ProductHit: hit}
+	if name, ok := search.Highlight(hit.Name, terms); ok {
+		result.Highlights.Name = name
+	}
+	if snippet, ok := search.Snippet(hit.Description, terms, snippetWidth); ok {
+		result.Highlights.Description = snippet
+	}
+	for _, tag := range hit.Tags {
+		if tag, ok := search.Highlight(tag, terms); ok {
+			result.Highlights.Tags = append(result.Highlights.Tags, tag)
+		}
+	}
+	return result
+}
+
+// SearchProducts handles GET /api/v1/products/search?q=. It matches the
+// words of q against product names, descriptions and tags and returns the
+// best matches first, paginated with the page parameter.
+func (h *ProductHandler) SearchProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "q", Message: "must contain at least one letter or digit"}})
+		return
+	}
+
+	// Results are ranked by relevance, which cursors cannot address, so
+	// search is always paged by page number.
+	page, ok := pageRequest(w, r, h.logger)
+	if !ok {
+		return
+	}
+	if page.Cursor != nil {
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "cursor", Message: "is not supported by search; use page"}})
+		return
+	}
+	page.Page = max(page.Page, 1)
+	converter, ok := h.priceConverter(w, r)
+	if !ok {
+		return
+	}
+
+	hits, total, err := h.products.Search(r.Context(), repository.SearchQuery{Terms: terms, Skip: page.Skip(), Limit: page.Limit})
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "search_products",
+			"status": "fail",
+			"query":  query,
+			"error":  err.Error(),
+		}).Error("Failed to search products")
+		view.RenderError(w, r, view.Internal("Failed to search products"))
+		return
+	}
+
+	results := make([]productSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		if !h.convertPrice(w, r, converter, &hit.Product) {
+			return
+		}
+		h.images.SetURLs(&hit.Product)
+		results = append(results, highlightProduct(hit, terms))
+	}
+	meta := searchMeta{
+		Meta:  pagination.NewMeta(page, total, false, hits, nil),
+		Query: query,
+		Terms: terms,
+	}
+	pagination.SetLinks(w, r, meta.Meta)
+	view.RenderList(w, r, results, meta)
+
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "search_products",
+		"status": "success",
+		"query":  query,
+		"count":  len(results),
+		"total":  total,
+	}).Info("Searched products successfully")
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"store/money"
+	"store/validation"
+	"testing"
+)
+
+func TestValidateProductFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      productRequest
+		expected []string
+		valid    bool
+	}{
+		{
+			name: "Valid data",
+			req: productRequest{
+				ID:    1,
+				Name:  "Product1",
+				Price: money.Money{Amount: 1050, Currency: "USD"},
+			},
+			expected: nil,
+			valid:    true,
+		},
+		{
+			name: "Invalid id",
+			req: productRequest{
+				ID:    -1,
+				Name:  "Product1",
+				Price: money.Money{Amount: 1050, Currency: "USD"},
+			},
+			expected: []string{"id"},
+			valid:    false,
+		},
+		{
+			name:     "Missing fields",
+			req:      productRequest{},
+			expected: []string{"name", "price"},
+			valid:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validation.Struct(&tt.req)
+			if valid := len(errs) == 0; valid != tt.valid {
+				t.Errorf("expected valid = %v, got %v (%v)", tt.valid, valid, errs)
+			}
+			if len(errs) != len(tt.expected) {
+				t.Fatalf("expected %d field errors, got %v", len(tt.expected), errs)
+			}
+			for i, field := range tt.expected {
+				if errs[i].Field != field {
+					t.Errorf("expected error on %q, got %q", field, errs[i].Field)
+				}
+			}
+		})
+	}
+}
@@ -1,73 +1,43 @@
 package controller
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"store/model"
+	"store/pagination"
+	"store/repository"
+	"store/sorting"
+	"store/validation"
 	"store/view"
-	"strconv"
 	"strings"
 
 	"github.com/sirupsen/logrus"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/time/rate"
 )
 
-var userCollection *mongo.Collection
-var limiter = rate.NewLimiter(1, 3)
-
-var log = logrus.New()
-
-func init() {
-	logFile, err := os.OpenFile("logging.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		fmt.Printf("Failed to open log file: %v\n", err)
-		return
-	}
-
-	log.SetOutput(logFile)
-
-	log.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
-	log.SetLevel(logrus.InfoLevel)
-
-	log.WithFields(logrus.Fields{
-		"action": "initialize_logger",
-		"status": "success",
-	}).Info("Logger initialized and writing to logging.txt")
+// UserHandler serves the user management endpoints.
+type UserHandler struct {
+	users   repository.UserRepository
+	limiter *rate.Limiter
+	logger  *logrus.Logger
 }
 
-func InitializeUser(mongoClient *mongo.Client) {
-	userCollection = mongoClient.Database("storeDB").Collection("users")
-	log.WithFields(logrus.Fields{
-		"action": "initialize",
-		"status": "success",
-	}).Info("User collection initialized")
+func NewUserHandler(users repository.UserRepository, limiter *rate.Limiter, logger *logrus.Logger) *UserHandler {
+	return &UserHandler{users: users, limiter: limiter, logger: logger}
 }
 
-func jsonResponse(w http.ResponseWriter, statusCode int, response interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(response)
-}
-
-func AllUsers(w http.ResponseWriter, r *http.Request) {
-	if !limiter.Allow() {
-		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-		log.WithFields(logrus.Fields{
+func (h *UserHandler) AllUsers(w http.ResponseWriter, r *http.Request) {
+	if !h.limiter.Allow() {
+		view.RenderError(w, r, view.RateLimited())
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "rate_limit_exceeded",
 			"status": "fail",
 		}).Warn("Rate limit exceeded")
 		return
 	}
 
-	log.WithFields(logrus.Fields{
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "fetch_users",
 		"status": "start",
 	}).Info("Fetching all users")
@@ -75,103 +45,78 @@ func AllUsers(w http.ResponseWriter, r *http.Request) {
 	// filter
 	filterEmail := r.URL.Query().Get("email")
 	filterUsername := r.URL.Query().Get("username")
-	filter := bson.M{}
-
-	if filterEmail != "" {
-		filter["email"] = bson.M{"$regex": filterEmail, "$options": "i"}
-	}
-	if filterUsername != "" {
-		filter["username"] = bson.M{"$regex": filterUsername, "$options": "i"}
-	}
 
 	// sort
-	sortField := r.URL.Query().Get("sort")
-	var sortOrder int
-	if sortField != "" {
-		sortOrder = 1
-		if sortField[0] == '-' {
-			sortField = sortField[1:]
-			sortOrder = -1
-		}
-	} else {
-		sortField = "username"
-		sortOrder = 1
+	sort, ok := sortRequest(w, r, h.logger, repository.UserSortFields, sorting.Asc("username"))
+	if !ok {
+		return
 	}
 
 	// pagination
-	page := r.URL.Query().Get("page")
-	limit := 10
-	skip := 0
-
-	if p, err := strconv.Atoi(page); err == nil && p > 1 {
-		skip = (p - 1) * limit
-	} else {
-		page = "1"
+	page, ok := pageRequest(w, r, h.logger)
+	if !ok {
+		return
 	}
 
-	cursor, err := userCollection.Find(
-		context.TODO(),
-		filter,
-		options.Find().
-			SetSort(bson.D{{Key: sortField, Value: sortOrder}}).
-			SetLimit(int64(limit)).
-			SetSkip(int64(skip)),
-	)
-
+	query := repository.UserQuery{
+		Email:    filterEmail,
+		Username: filterUsername,
+		Sort:     sort,
+		Skip:     page.Skip(),
+		Limit:    page.Limit + 1,
+		Cursor:   page.Cursor,
+	}
+	users, err := h.users.List(r.Context(), query)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		rejectCursor(w, r, h.logger)
+		return
+	}
 	if err != nil {
-		log.WithFields(logrus.Fields{
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "all_users",
 			"status": "fail",
 			"error":  err.Error(),
 		}).Error("Failed to fetch users from database")
-		jsonResponse(w, http.StatusInternalServerError, map[string]string{"status": "fail", "message": "Failed to fetch users from database"})
+		view.RenderError(w, r, view.Internal("Failed to fetch users from database"))
 		return
 	}
-	defer cursor.Close(context.TODO())
-
-	var users model.Users
-	if err := cursor.All(context.TODO(), &users); err != nil {
-		log.WithFields(logrus.Fields{
+	total, err := h.users.Count(r.Context(), query)
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "all_users",
 			"status": "fail",
 			"error":  err.Error(),
-		}).Error("Error decoding user data")
-		jsonResponse(w, http.StatusInternalServerError, map[string]string{"status": "fail", "message": "Error decoding user data"})
+		}).Error("Failed to count users")
+		view.RenderError(w, r, view.Internal("Failed to fetch users from database"))
 		return
 	}
 
-	view.RenderUsers(w, users)
+	users, more := pagination.Trim(users, page)
+	meta := pagination.NewMeta(page, total, more, users, func(u model.User) []any {
+		return repository.UserSortValues(u, query)
+	})
+	pagination.SetLinks(w, r, meta)
+	view.RenderList(w, r, users, meta)
 
-	log.WithFields(logrus.Fields{
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "all_users",
 		"status": "success",
 		"count":  len(users),
 	}).Info("Fetched users successfully")
 }
 
-func HandleUserPostRequest(w http.ResponseWriter, r *http.Request) {
+func (h *UserHandler) HandleUserPostRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		log.WithFields(logrus.Fields{
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "handle_post_request",
 			"status": "fail",
 		}).Warn("Only POST methods are allowed!")
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"status": "fail", "message": "Only POST methods are allowed!"})
+		view.RenderError(w, r, view.MethodNotAllowed("POST"))
 		return
 	}
 
-	var requestUser struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		Username string `json:"username"`
-	}
-
-	err := json.NewDecoder(r.Body).Decode(&requestUser)
-	if err != nil || requestUser.Email == "" || requestUser.Password == "" || requestUser.Username == "" {
-		log.WithFields(logrus.Fields{
-			"action": "handle_post_request",
-			"status": "fail",
-		}).Warn("Invalid JSON format or missing fields")
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"status": "fail", "message": "Invalid JSON format or missing fields"})
+	var requestUser userCreateRequest
+	if !decodeRequest(w, r, h.logger, &requestUser) {
 		return
 	}
 
@@ -181,109 +126,139 @@ func HandleUserPostRequest(w http.ResponseWriter, r *http.Request) {
 		Username: requestUser.Username,
 	}
 
-	_, err = userCollection.InsertOne(context.TODO(), newUser)
+	err := h.users.Create(r.Context(), &newUser)
+	if errors.Is(err, repository.ErrConflict) {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "handle_post_request",
+			"status": "fail",
+			"email":  requestUser.Email,
+		}).Warn("A user with the email already exists")
+		view.RenderError(w, r, view.Conflict("A user with the provided email already exists"))
+		return
+	}
 	if err != nil {
-		log.WithFields(logrus.Fields{
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "handle_post_request",
 			"status": "fail",
 			"error":  err.Error(),
 		}).Error("Failed to insert user into the database")
-		jsonResponse(w, http.StatusInternalServerError, map[string]string{"status": "fail", "message": "Failed to insert user into the database"})
+		view.RenderError(w, r, view.Internal("Failed to insert user into the database"))
 		return
 	}
 
-	log.WithFields(logrus.Fields{
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action":   "handle_post_request",
 		"status":   "success",
 		"email":    requestUser.Email,
 		"username": requestUser.Username,
 	}).Info("Received user information and inserted into the database")
 
-	jsonResponse(w, http.StatusOK, map[string]string{"status": "success", "message": "User data successfully received"})
+	view.RenderMessage(w, r, http.StatusOK, "User data successfully received")
+}
+
+// userEmailFromPath reads the {id} wildcard of a /api/v1/users/{id} route.
+// Users are identified by their email address.
+func (h *UserHandler) userEmailFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	req := userEmailRequest{Email: strings.TrimSpace(r.PathValue("id"))}
+	if !validateRequest(w, r, h.logger, &req) {
+		return "", false
+	}
+	return req.Email, true
+}
+
+// DeleteUser handles DELETE /api/v1/users/{id}.
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if email, ok := h.userEmailFromPath(w, r); ok {
+		h.deleteUser(w, r, email)
+	}
 }
 
-func DeleteUserByEmail(w http.ResponseWriter, r *http.Request) {
+func (h *UserHandler) DeleteUserByEmail(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		log.WithFields(logrus.Fields{
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "handle_delete_request",
 			"status": "fail",
 		}).Warn("Only DELETE methods are allowed!")
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"status": "fail", "message": "Only DELETE methods are allowed!"})
+		view.RenderError(w, r, view.MethodNotAllowed("DELETE"))
 		return
 	}
 
-	var request struct {
-		Email string `json:"email"`
-	}
-
-	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil || request.Email == "" {
-		log.WithFields(logrus.Fields{
-			"action": "handle_delete_request",
-			"status": "fail",
-		}).Warn("Invalid JSON format or missing email")
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"status": "fail", "message": "Invalid JSON format or missing email"})
+	var request userEmailRequest
+	if !decodeRequest(w, r, h.logger, &request) {
 		return
 	}
 
-	request.Email = strings.TrimSpace(request.Email)
-	filter := bson.M{"email": bson.M{"$regex": request.Email, "$options": "i"}}
-	deleteResult, err := userCollection.DeleteOne(context.TODO(), filter)
-	if err != nil {
-		log.WithFields(logrus.Fields{
+	h.deleteUser(w, r, strings.TrimSpace(request.Email))
+}
+
+func (h *UserHandler) deleteUser(w http.ResponseWriter, r *http.Request, email string) {
+	err := h.users.Delete(r.Context(), email, actor(r))
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "handle_delete_request",
 			"status": "fail",
 			"error":  err.Error(),
 		}).Error("Failed to delete user from database")
-		jsonResponse(w, http.StatusInternalServerError, map[string]string{"status": "fail", "message": "Failed to delete user from database"})
+		view.RenderError(w, r, view.Internal("Failed to delete user from database"))
 		return
 	}
 
-	if deleteResult.DeletedCount == 0 {
-		log.WithFields(logrus.Fields{
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "handle_delete_request",
 			"status": "fail",
 		}).Warn("No user found with the provided email")
-		jsonResponse(w, http.StatusNotFound, map[string]string{"status": "fail", "message": "No user found with the provided email"})
+		view.RenderError(w, r, view.NotFound("No user found with the provided email"))
 		return
 	}
 
-	log.WithFields(logrus.Fields{
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "handle_delete_request",
 		"status": "success",
-		"email":  request.Email,
-	}).Info("User successfully deleted from the database")
+		"email":  email,
+	}).Info("User moved to the trash")
 
-	jsonResponse(w, http.StatusOK, map[string]string{"status": "success", "message": fmt.Sprintf("User with email %s successfully deleted", request.Email)})
+	view.RenderMessage(w, r, http.StatusOK, fmt.Sprintf("User with email %s moved to the trash", email))
 }
 
-func UpdateUserByEmail(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		log.WithFields(logrus.Fields{
-			"action": "handle_put_request",
-			"status": "fail",
-		}).Warn("Only PUT methods are allowed!")
-		jsonResponse(w, http.StatusMethodNotAllowed, map[string]string{"status": "fail", "message": "Only PUT methods are allowed!"})
+// UpdateUser handles PUT /api/v1/users/{id}.
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	email, ok := h.userEmailFromPath(w, r)
+	if !ok {
 		return
 	}
 
-	var request struct {
-		Email    string  `json:"email"`
-		Username *string `json:"username,omitempty"`
-		Password *string `json:"password,omitempty"`
+	var request userUpdateRequest
+	if err := validation.DecodeJSON(r.Body, &request); err != nil {
+		rejectRequest(w, r, h.logger, err)
+		return
+	}
+	request.Email = email
+	if validateRequest(w, r, h.logger, &request) {
+		h.updateUser(w, r, request)
 	}
+}
 
-	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil || request.Email == "" {
-		log.WithFields(logrus.Fields{
+func (h *UserHandler) UpdateUserByEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "handle_put_request",
 			"status": "fail",
-		}).Warn("Invalid JSON format or missing email")
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"status": "fail", "message": "Invalid JSON format or missing email"})
+		}).Warn("Only PUT methods are allowed!")
+		view.RenderError(w, r, view.MethodNotAllowed("PUT"))
 		return
 	}
 
-	updateFields := bson.M{}
+	var request userUpdateRequest
+	if !decodeRequest(w, r, h.logger, &request) {
+		return
+	}
+
+	h.updateUser(w, r, request)
+}
+
+func (h *UserHandler) updateUser(w http.ResponseWriter, r *http.Request, request userUpdateRequest) {
+	updateFields := map[string]interface{}{}
 	if request.Username != nil {
 		updateFields["username"] = *request.Username
 	}
@@ -292,108 +267,123 @@ func UpdateUserByEmail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(updateFields) == 0 {
-		log.WithFields(logrus.Fields{
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "handle_put_request",
 			"status": "fail",
 		}).Warn("No fields to update")
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"status": "fail", "message": "No fields to update"})
+		view.RenderError(w, r, view.BadRequest("No fields to update"))
 		return
 	}
 
-	filter := bson.M{"email": request.Email}
-	update := bson.M{"$set": updateFields}
-	updateResult, err := userCollection.UpdateOne(context.TODO(), filter, update)
-	if err != nil || updateResult.MatchedCount == 0 {
-		log.WithFields(logrus.Fields{
+	err := h.users.Update(r.Context(), request.Email, repository.UserUpdate{
+		Username: request.Username,
+		Password: request.Password,
+	})
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"action": "handle_put_request",
 			"status": "fail",
 			"error":  err.Error(),
 		}).Error("Failed to update user")
-		jsonResponse(w, http.StatusNotFound, map[string]string{"status": "fail", "message": "No user found with the provided email"})
+		view.RenderError(w, r, view.Internal("Failed to update user"))
+		return
+	}
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "handle_put_request",
+			"status": "fail",
+			"email":  request.Email,
+		}).Warn("No user found with the provided email")
+		view.RenderError(w, r, view.NotFound("No user found with the provided email"))
 		return
 	}
 
-	log.WithFields(logrus.Fields{
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action":  "handle_put_request",
 		"status":  "success",
 		"email":   request.Email,
 		"updated": updateFields,
 	}).Info("User successfully updated")
 
-	jsonResponse(w, http.StatusOK, map[string]interface{}{"status": "success", "message": "User updated successfully", "updated": updateFields})
-}
-
-func GetUserByUsername(w http.ResponseWriter, r *http.Request) {
-	var request struct {
-		Username string `json:"username"`
+	user, err := h.users.FindByEmail(r.Context(), request.Email)
+	if err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "handle_put_request",
+			"status": "fail",
+			"error":  err.Error(),
+		}).Error("Error fetching updated user")
+		view.RenderError(w, r, view.Internal("Error fetching user from database"))
+		return
 	}
+	view.RenderUsers(w, r, user)
+}
 
-	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil || request.Username == "" {
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"status": "fail", "message": "Invalid JSON format or missing username"})
+func (h *UserHandler) GetUserByUsername(w http.ResponseWriter, r *http.Request) {
+	var request usernameRequest
+	if !decodeRequest(w, r, h.logger, &request) {
 		return
 	}
 
-	var user model.User
-	err = userCollection.FindOne(context.TODO(), bson.M{"username": request.Username}).Decode(&user)
+	user, err := h.users.FindByUsername(r.Context(), request.Username)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			jsonResponse(w, http.StatusNotFound, map[string]string{"status": "fail", "message": "User not found"})
+		if errors.Is(err, repository.ErrNotFound) {
+			view.RenderError(w, r, view.NotFound("User not found"))
 		} else {
-			jsonResponse(w, http.StatusInternalServerError, map[string]string{"status": "fail", "message": "Error fetching user from database"})
+			view.RenderError(w, r, view.Internal("Error fetching user from database"))
 		}
 		return
 	}
 
-	view.RenderUsers(w, user)
+	view.RenderUsers(w, r, user)
 
-	log.WithFields(logrus.Fields{
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action":   "get_user_by_username",
 		"status":   "success",
 		"username": request.Username,
 	}).Info("User fetched successfully")
 }
 
-func GetUserByEmail(w http.ResponseWriter, r *http.Request) {
-	var request struct {
-		Email string `json:"email"`
+// GetUser handles GET /api/v1/users/{id}.
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	if email, ok := h.userEmailFromPath(w, r); ok {
+		h.getUserByEmail(w, r, email)
 	}
+}
 
-	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil || request.Email == "" {
-		log.WithFields(logrus.Fields{
-			"action": "get_user_by_email",
-			"status": "fail",
-		}).Warn("Invalid JSON format or missing email")
-		jsonResponse(w, http.StatusBadRequest, map[string]string{"status": "fail", "message": "Invalid JSON format or missing email"})
+func (h *UserHandler) GetUserByEmail(w http.ResponseWriter, r *http.Request) {
+	var request userEmailRequest
+	if !decodeRequest(w, r, h.logger, &request) {
 		return
 	}
 
-	var user model.User
-	err = userCollection.FindOne(context.TODO(), bson.M{"email": request.Email}).Decode(&user)
+	h.getUserByEmail(w, r, request.Email)
+}
+
+func (h *UserHandler) getUserByEmail(w http.ResponseWriter, r *http.Request, email string) {
+	user, err := h.users.FindByEmail(r.Context(), email)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.WithFields(logrus.Fields{
+		if errors.Is(err, repository.ErrNotFound) {
+			h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 				"action": "get_user_by_email",
 				"status": "fail",
 			}).Warn("User not found")
-			jsonResponse(w, http.StatusNotFound, map[string]string{"status": "fail", "message": "User not found"})
+			view.RenderError(w, r, view.NotFound("User not found"))
 		} else {
-			log.WithFields(logrus.Fields{
+			h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 				"action": "get_user_by_email",
 				"status": "fail",
 				"error":  err.Error(),
 			}).Error("Error fetching user from database")
-			jsonResponse(w, http.StatusInternalServerError, map[string]string{"status": "fail", "message": "Error fetching user from database"})
+			view.RenderError(w, r, view.Internal("Error fetching user from database"))
 		}
 		return
 	}
 
-	view.RenderUsers(w, user)
+	view.RenderUsers(w, r, user)
 
-	log.WithFields(logrus.Fields{
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"action": "get_user_by_email",
 		"status": "success",
-		"email":  request.Email,
+		"email":  email,
 	}).Info("User fetched successfully")
 }
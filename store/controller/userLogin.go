@@ -1,15 +1,27 @@
 package controller
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"store/email"
+	"store/repository"
+	"store/view"
 
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// AuthHandler обслуживает регистрацию и вход пользователей
+type AuthHandler struct {
+	users  repository.UserRepository
+	mailer email.Mailer
+	logger *logrus.Logger
+}
+
+func NewAuthHandler(users repository.UserRepository, mailer email.Mailer, logger *logrus.Logger) *AuthHandler {
+	return &AuthHandler{users: users, mailer: mailer, logger: logger}
+}
+
 // Функция для проверки пароля
 func checkPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
@@ -17,39 +29,35 @@ func checkPasswordHash(password, hash string) bool {
 }
 
 // Контроллер для авторизации (Login)
-func Login(w http.ResponseWriter, r *http.Request) {
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
-		// Получаем данные из формы
-		email := r.FormValue("email")
-		password := r.FormValue("password")
-
-		// Валидация данных
-		if email == "" || password == "" {
-			http.Error(w, "Email and password are required!", http.StatusBadRequest)
-			return
+		// Получаем данные из JSON или из формы и проверяем их
+		var req loginRequest
+		if isJSON(r) {
+			if !decodeRequest(w, r, h.logger, &req) {
+				return
+			}
+		} else {
+			req = loginRequest{Email: r.FormValue("email"), Password: r.FormValue("password")}
+			if !validateRequest(w, r, h.logger, &req) {
+				return
+			}
 		}
 
 		// Поиск пользователя в базе данных
-		var user User
-		err := userCollection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
+		user, err := h.users.FindByEmail(r.Context(), req.Email)
 		if err != nil {
-			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+			view.RenderError(w, r, view.Unauthorized("Invalid email or password"))
 			return
 		}
 
 		// Проверка пароля
-		if !checkPasswordHash(password, user.Password) {
-			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		if !checkPasswordHash(req.Password, user.Password) {
+			view.RenderError(w, r, view.Unauthorized("Invalid email or password"))
 			return
 		}
 		// Успешный вход
-		response := map[string]string{
-			"status":  "success",
-			"message": fmt.Sprintf("Welcome back, %s!", user.Name),
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(response)
+		view.RenderMessage(w, r, http.StatusOK, fmt.Sprintf("Welcome back, %s!", user.Username))
 		return
 	}
 
@@ -2,20 +2,16 @@ package controller
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
-	"net/smtp"
+	"store/model"
+	"store/repository"
+	"store/view"
 
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// User модель для хранения информации о пользователе
-type User struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
-
 // Функция хеширования пароля
 func hashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -26,79 +22,83 @@ func hashPassword(password string) (string, error) {
 }
 
 // Функция для отправки email
-func sendConfirmationEmail(email string) error {
-	from := "abylaymoldakhmet@gmail.com"
-	password := "byub ifbs izua qezn"
-	to := email
+func (h *AuthHandler) sendConfirmationEmail(ctx context.Context, email string) error {
 	subject := "Account Creation Confirmation"
 	body := "Your account has been successfully created. Please log in to access your account."
 
-	msg := "From: " + from + "\n" +
-		"To: " + to + "\n" +
-		"Subject: " + subject + "\n\n" +
-		body
-
-	auth := smtp.PlainAuth("", from, password, "smtp.gmail.com")
-	err := smtp.SendMail("smtp.gmail.com:587", auth, from, []string{to}, []byte(msg))
+	err := h.mailer.SendEmail(email, subject, body)
 	if err != nil {
-		log.Println("Error sending email:", err)
+		h.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"action": "send_confirmation_email",
+			"status": "fail",
+			"error":  err.Error(),
+		}).Error("Error sending email")
 		return err
 	}
 	return nil
 }
 
-// Сохранение пользователя в MongoDB
-func saveUserToDB(user User) error {
-	// Используем уже существующую коллекцию UserCollection
-	_, err := userCollection.InsertOne(context.TODO(), user)
-	return err
+// Сохранение пользователя в хранилище
+func (h *AuthHandler) saveUserToDB(ctx context.Context, user model.User) error {
+	return h.users.Create(ctx, &user)
 }
 
 // Контроллер для обработки регистрации
-func SignUp(w http.ResponseWriter, r *http.Request) {
+func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
-		// Получаем данные из формы
-		name := r.FormValue("name")
-		email := r.FormValue("email")
-		password := r.FormValue("password")
-		confirmPassword := r.FormValue("confirm_password")
-
-		// Валидация: пароли должны совпадать
-		if password != confirmPassword {
-			http.Error(w, "Passwords do not match!", http.StatusBadRequest)
-			return
+		// Получаем данные из JSON или из формы и проверяем их,
+		// в том числе совпадение паролей
+		var req signupRequest
+		if isJSON(r) {
+			if !decodeRequest(w, r, h.logger, &req) {
+				return
+			}
+		} else {
+			req = signupRequest{
+				Name:            r.FormValue("name"),
+				Email:           r.FormValue("email"),
+				Password:        r.FormValue("password"),
+				ConfirmPassword: r.FormValue("confirm_password"),
+			}
+			if !validateRequest(w, r, h.logger, &req) {
+				return
+			}
 		}
 
 		// Хешируем пароль
-		hashedPassword, err := hashPassword(password)
+		hashedPassword, err := hashPassword(req.Password)
 		if err != nil {
-			http.Error(w, "Error hashing password", http.StatusInternalServerError)
+			view.RenderError(w, r, view.Internal("Error hashing password"))
 			return
 		}
 
 		// Создаем нового пользователя
-		user := User{
-			Name:     name,
-			Email:    email,
+		user := model.User{
+			Username: req.Name,
+			Email:    req.Email,
 			Password: hashedPassword,
 		}
 
 		// Сохраняем пользователя в базе данных
-		err = saveUserToDB(user)
+		err = h.saveUserToDB(r.Context(), user)
+		if errors.Is(err, repository.ErrConflict) {
+			view.RenderError(w, r, view.Conflict("A user with the provided email already exists"))
+			return
+		}
 		if err != nil {
-			http.Error(w, "Error saving user to database", http.StatusInternalServerError)
+			view.RenderError(w, r, view.Internal("Error saving user to database"))
 			return
 		}
 
 		// Отправляем email с подтверждением
-		err = sendConfirmationEmail(email)
+		err = h.sendConfirmationEmail(r.Context(), req.Email)
 		if err != nil {
-			http.Error(w, "Error sending confirmation email", http.StatusInternalServerError)
+			view.RenderError(w, r, view.Internal("Error sending confirmation email"))
 			return
 		}
 
 		// Уведомляем пользователя об успешной регистрации
-		fmt.Fprintf(w, "Registration successful! Please check your email to verify your account.")
+		view.RenderMessage(w, r, http.StatusCreated, "Registration successful! Please check your email to verify your account.")
 		return
 	}
 
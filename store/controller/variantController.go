@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"store/model"
+	"store/pricing"
+	"store/repository"
+	"store/validation"
+	"store/view"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// skuPattern keeps SKUs safe to use as a path segment.
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+var nonSKUChars = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// generateSKU derives a SKU from the product ID, size and color, for example
+// 12-XL-NAVY-BLUE.
+func generateSKU(productID int, size, color string) string {
+	part := func(s string) string {
+		return strings.Trim(nonSKUChars.ReplaceAllString(strings.ToUpper(s), "-"), "-")
+	}
+	return fmt.Sprintf("%d-%s-%s", productID, part(size), part(color))
+}
+
+// variantFromRequest validates req and builds the variant it describes,
+// generating a SKU when none was sent.
+func (h *ProductHandler) variantFromRequest(w http.ResponseWriter, r *http.Request, productID int, req variantRequest) (model.Variant, bool) {
+	req.Size = strings.TrimSpace(req.Size)
+	req.Color = strings.TrimSpace(req.Color)
+	req.SKU = strings.TrimSpace(req.SKU)
+
+	errs := validation.Struct(&req)
+	if !hasFieldError(errs, "price") {
+		errs = append(errs, pricing.CheckPrices(h.pricing.Currency(), req.Price, nil)...)
+	}
+	if req.SKU != "" && !skuPattern.MatchString(req.SKU) && !hasFieldError(errs, "sku") {
+		errs = append(errs, validation.FieldError{Field: "sku", Message: "may only contain letters, digits, '.', '_' and '-'"})
+	}
+	if len(errs) > 0 {
+		rejectRequest(w, r, h.logger, errs)
+		return model.Variant{}, false
+	}
+
+	if req.SKU == "" {
+		req.SKU = generateSKU(productID, req.Size, req.Color)
+	}
+	return model.Variant{
+		SKU:   req.SKU,
+		Size:  req.Size,
+		Color: req.Color,
+		Price: req.Price,
+		Image: req.Image,
+	}, true
+}
+
+// checkVariantImage rejects the image of v unless it is in the gallery of
+// the product or is the image the variant already has, as for the image of
+// the product itself. It writes the response and returns false on failure.
+func (h *ProductHandler) checkVariantImage(w http.ResponseWriter, r *http.Request, action string, id int, v model.Variant) bool {
+	if v.Image == "" {
+		return true
+	}
+	product, err := h.products.FindByID(r.Context(), id)
+	if err != nil {
+		h.renderVariantError(w, r, action, id, v.SKU, err)
+		return false
+	}
+	if product.ImageIndex(v.Image) >= 0 {
+		return true
+	}
+	if current, ok := product.Variant(v.SKU); ok && current.Image == v.Image {
+		return true
+	}
+	rejectRequest(w, r, h.logger, validation.Errors{errImageNotUploaded})
+	return false
+}
+
+// ListVariants handles GET /api/v1/products/{id}/variants.
+func (h *ProductHandler) ListVariants(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	product, err := h.products.FindByID(r.Context(), id)
+	if err != nil {
+		h.renderVariantError(w, r, "list_variants", id, "", err)
+		return
+	}
+	products := []model.Product{*product}
+	if !h.setStock(w, r, products) {
+		return
+	}
+	view.Render(w, r, http.StatusOK, products[0].Variants)
+}
+
+// GetVariant handles GET /api/v1/products/{id}/variants/{sku}.
+func (h *ProductHandler) GetVariant(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+	sku := r.PathValue("sku")
+
+	product, err := h.products.FindByID(r.Context(), id)
+	if err != nil {
+		h.renderVariantError(w, r, "get_variant", id, sku, err)
+		return
+	}
+	variant, ok := product.Variant(sku)
+	if !ok {
+		h.renderVariantError(w, r, "get_variant", id, sku, repository.ErrNotFound)
+		return
+	}
+	stocked, ok := h.variantStock(w, r, id, *variant)
+	if !ok {
+		return
+	}
+	view.Render(w, r, http.StatusOK, stocked)
+}
+
+// CreateVariant handles POST /api/v1/products/{id}/variants.
+func (h *ProductHandler) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	var req variantRequest
+	if err := validation.DecodeJSON(r.Body, &req); err != nil {
+		rejectRequest(w, r, h.logger, err)
+		return
+	}
+	variant, ok := h.variantFromRequest(w, r, id, req)
+	if !ok || !h.checkVariantImage(w, r, "create_variant", id, variant) {
+		return
+	}
+
+	if err := h.products.AddVariant(r.Context(), id, variant); err != nil {
+		h.renderVariantError(w, r, "create_variant", id, variant.SKU, err)
+		return
+	}
+	// The stock of the product itself is not sold once it has variants.
+	h.stock.UpdateInStock(r.Context(), id)
+
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "create_variant",
+		"status": "success",
+		"id":     id,
+		"sku":    variant.SKU,
+	}).Info("Successfully added product variant")
+	view.Render(w, r, http.StatusCreated, variant)
+}
+
+// UpdateVariant handles PUT /api/v1/products/{id}/variants/{sku}. The body
+// replaces the variant; its SKU cannot be changed.
+func (h *ProductHandler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+	sku := r.PathValue("sku")
+
+	var req variantRequest
+	if err := validation.DecodeJSON(r.Body, &req); err != nil {
+		rejectRequest(w, r, h.logger, err)
+		return
+	}
+	if req.SKU != "" && req.SKU != sku {
+		rejectRequest(w, r, h.logger, validation.Errors{{Field: "sku", Message: "must match the SKU in the path"}})
+		return
+	}
+	req.SKU = sku
+	variant, ok := h.variantFromRequest(w, r, id, req)
+	if !ok || !h.checkVariantImage(w, r, "update_variant", id, variant) {
+		return
+	}
+
+	if err := h.products.ReplaceVariant(r.Context(), id, variant); err != nil {
+		h.renderVariantError(w, r, "update_variant", id, sku, err)
+		return
+	}
+	variant, ok = h.variantStock(w, r, id, variant)
+	if !ok {
+		return
+	}
+
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "update_variant",
+		"status": "success",
+		"id":     id,
+		"sku":    sku,
+	}).Info("Successfully updated product variant")
+	view.Render(w, r, http.StatusOK, variant)
+}
+
+// DeleteVariant handles DELETE /api/v1/products/{id}/variants/{sku}.
+func (h *ProductHandler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	id, ok := productIDFromPath(w, r, h.logger)
+	if !ok {
+		return
+	}
+	sku := r.PathValue("sku")
+
+	if err := h.products.DeleteVariant(r.Context(), id, sku); err != nil {
+		h.renderVariantError(w, r, "delete_variant", id, sku, err)
+		return
+	}
+	if err := h.stock.RemoveSKU(r.Context(), id, sku); err != nil {
+		// The variant is gone, so the request has succeeded; its stock only
+		// comes back if a variant is created again with the same SKU.
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "remove_variant_stock",
+			"status": "fail",
+			"id":     id,
+			"sku":    sku,
+			"error":  err.Error(),
+		}).Error("Failed to remove the stock of the deleted variant")
+	}
+
+	h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": "delete_variant",
+		"status": "success",
+		"id":     id,
+		"sku":    sku,
+	}).Info("Successfully deleted product variant")
+	view.RenderMessage(w, r, http.StatusOK, fmt.Sprintf("Variant %s of product %d successfully deleted", sku, id))
+}
+
+// setStock fills in the stock of the variants of products. It writes a 500
+// response and returns false if the inventory cannot be read.
+func (h *ProductHandler) setStock(w http.ResponseWriter, r *http.Request, products []model.Product) bool {
+	if err := h.stock.SetStock(r.Context(), products); err != nil {
+		h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"action": "fetch_stock",
+			"status": "fail",
+			"error":  err.Error(),
+		}).Error("Error fetching stock levels")
+		view.RenderError(w, r, view.Internal("Error fetching stock levels from the database"))
+		return false
+	}
+	return true
+}
+
+// variantStock returns variant of product id with its stock filled in.
+func (h *ProductHandler) variantStock(w http.ResponseWriter, r *http.Request, id int, variant model.Variant) (model.Variant, bool) {
+	products := []model.Product{{ID: id, Variants: []model.Variant{variant}}}
+	if !h.setStock(w, r, products) {
+		return model.Variant{}, false
+	}
+	return products[0].Variants[0], true
+}
+
+func (h *ProductHandler) renderVariantError(w http.ResponseWriter, r *http.Request, action string, id int, sku string, err error) {
+	entry := h.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"action": action,
+		"status": "fail",
+		"id":     id,
+		"sku":    sku,
+	})
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		entry.Warn("No product or variant found")
+		if sku == "" {
+			view.RenderError(w, r, view.NotFound(fmt.Sprintf("No product found with ID %d", id)))
+		} else {
+			view.RenderError(w, r, view.NotFound(fmt.Sprintf("No variant %s found for product %d", sku, id)))
+		}
+	case errors.Is(err, repository.ErrConflict):
+		entry.Warn("Variant conflicts with an existing one")
+		view.RenderError(w, r, view.Conflict("A variant with this SKU, or in the same size and color, already exists"))
+	default:
+		entry.WithField("error", err.Error()).Error("Failed to access product variants")
+		view.RenderError(w, r, view.Internal("Failed to access product variants"))
+	}
+}
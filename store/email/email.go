@@ -1,12 +1,16 @@
 package email
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
-	"net/http"
+	"net"
+	"net/smtp"
 	"regexp"
+	"strconv"
 
+	"store/config"
+
+	"github.com/sirupsen/logrus"
 	"gopkg.in/gomail.v2"
 )
 
@@ -15,13 +19,32 @@ func isValidEmail(email string) bool {
 	return re.MatchString(email)
 }
 
-func SendEmail(from string, password string, to string, subject string, body string, attachment string) error {
+// Mailer sends a single plain-text message.
+type Mailer interface {
+	SendEmail(to string, subject string, body string) error
+}
+
+// Sender delivers mail through the SMTP server described by its config.
+type Sender struct {
+	cfg    config.SMTPConfig
+	logger *logrus.Logger
+}
+
+func NewSender(cfg config.SMTPConfig, logger *logrus.Logger) *Sender {
+	return &Sender{cfg: cfg, logger: logger}
+}
+
+func (s *Sender) SendEmail(to string, subject string, body string) error {
 	if !isValidEmail(to) {
 		return fmt.Errorf("Invalid email format for recipient: %s", to)
 	}
 
-	if from == "" || password == "" {
-		log.Println("Email address or password is not set.")
+	from := s.cfg.Sender()
+	if from == "" || s.cfg.Password == "" {
+		s.logger.WithFields(logrus.Fields{
+			"action": "send_email",
+			"status": "fail",
+		}).Error("Email address or password is not set")
 		return fmt.Errorf("email address or password not set")
 	}
 
@@ -31,67 +54,44 @@ func SendEmail(from string, password string, to string, subject string, body str
 	m.SetHeader("Subject", subject)
 	m.SetBody("text/plain", body)
 
-	if attachment != "" {
-		m.Attach(attachment)
-	}
-
-	d := gomail.NewDialer("smtp.gmail.com", 587, from, password)
+	d := gomail.NewDialer(s.cfg.Host, s.cfg.Port, s.cfg.Username, s.cfg.Password)
 
 	if err := d.DialAndSend(m); err != nil {
-		log.Printf("Failed to send email to %s: %s", to, err)
+		s.logger.WithFields(logrus.Fields{
+			"action": "send_email",
+			"status": "fail",
+			"to":     to,
+			"error":  err.Error(),
+		}).Error("Failed to send email")
 		return err
 	}
 
-	log.Printf("Email successfully sent to %s", to)
+	s.logger.WithFields(logrus.Fields{
+		"action": "send_email",
+		"status": "success",
+		"to":     to,
+	}).Info("Email successfully sent")
 	return nil
 }
 
-func HandleEmailRequest(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST methods are allowed!", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var emailData map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&emailData)
+// Ping checks that the SMTP server accepts connections and greets the client,
+// without authenticating or sending anything.
+func (s *Sender) Ping(ctx context.Context) error {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
 	if err != nil {
-		http.Error(w, "Invalid JSON format: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	to, ok := emailData["to"].(string)
-	if !ok || to == "" {
-		http.Error(w, "Recipient email is required", http.StatusBadRequest)
-		return
-	}
-
-	subject, ok := emailData["subject"].(string)
-	if !ok || subject == "" {
-		http.Error(w, "Subject is required", http.StatusBadRequest)
-		return
+		return err
 	}
-
-	body, ok := emailData["body"].(string)
-	if !ok || body == "" {
-		http.Error(w, "Body is required", http.StatusBadRequest)
-		return
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
 	}
 
-	attachment, _ := emailData["attachment"].(string)
-
-	from := "ibragimtop1@gmail.com"
-	password := "emlx wxgk ajik qiyl"
-	err = SendEmail(from, password, to, subject, body, attachment)
+	c, err := smtp.NewClient(conn, s.cfg.Host)
 	if err != nil {
-		http.Error(w, "Failed to send email: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	response := map[string]string{
-		"status":  "success",
-		"message": "Email sent successfully!",
+		conn.Close()
+		return err
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	defer c.Close()
+	return c.Quit()
 }
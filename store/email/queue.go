@@ -0,0 +1,95 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrQueueFull is returned when a message cannot be queued without
+	// blocking the caller.
+	ErrQueueFull = errors.New("email queue is full")
+	// ErrQueueClosed is returned for messages queued after Close.
+	ErrQueueClosed = errors.New("email queue is closed")
+)
+
+type message struct {
+	to, subject, body string
+}
+
+// Queue is a Mailer that sends messages in the background, so that requests
+// do not wait on the SMTP server. Delivery failures are logged rather than
+// returned to the caller.
+type Queue struct {
+	mailer Mailer
+	logger *logrus.Logger
+	jobs   chan message
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewQueue starts a worker that delivers queued messages through mailer,
+// buffering up to size of them.
+func NewQueue(mailer Mailer, size int, logger *logrus.Logger) *Queue {
+	q := &Queue{
+		mailer: mailer,
+		logger: logger,
+		jobs:   make(chan message, size),
+		done:   make(chan struct{}),
+	}
+	go q.work()
+	return q
+}
+
+// SendEmail queues a message for delivery.
+func (q *Queue) SendEmail(to string, subject string, body string) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.jobs <- message{to: to, subject: subject, body: body}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits until the ones already queued have
+// been sent or ctx is done.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) work() {
+	defer close(q.done)
+	for m := range q.jobs {
+		if err := q.mailer.SendEmail(m.to, m.subject, m.body); err != nil {
+			q.logger.WithFields(logrus.Fields{
+				"action": "deliver_queued_email",
+				"status": "fail",
+				"to":     m.to,
+				"error":  err.Error(),
+			}).Error("Failed to deliver queued email")
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (m *recordingMailer) SendEmail(to, subject, body string) error {
+	time.Sleep(time.Millisecond)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, to)
+	return nil
+}
+
+func TestQueueCloseFlushesPendingMessages(t *testing.T) {
+	mailer := &recordingMailer{}
+	q := NewQueue(mailer, 10, logrus.New())
+
+	for _, to := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if err := q.SendEmail(to, "Hi", "Body"); err != nil {
+			t.Fatalf("SendEmail(%s): %v", to, err)
+		}
+	}
+
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(mailer.sent) != 3 {
+		t.Errorf("expected 3 messages delivered before Close returned, got %v", mailer.sent)
+	}
+
+	if err := q.SendEmail("d@example.com", "Hi", "Body"); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("expected ErrQueueClosed after Close, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+// Package health serves the liveness and readiness probes.
+//
+// Liveness only says that the process is serving HTTP. Readiness runs every
+// registered dependency check and reports each one, so that a load balancer
+// stops routing traffic to an instance that cannot reach its dependencies.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds each readiness check when none is configured.
+const DefaultTimeout = 2 * time.Second
+
+// Check reports whether a dependency is usable. It must honour ctx.
+type Check func(ctx context.Context) error
+
+// Status is the state of the service or of a single dependency.
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// Result is the outcome of one dependency check.
+type Result struct {
+	Status     Status `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Report is the body of a readiness response.
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Handler serves /healthz and /readyz.
+type Handler struct {
+	timeout time.Duration
+	checks  []namedCheck
+}
+
+// NewHandler returns a Handler that gives each readiness check at most
+// timeout to complete.
+func NewHandler(timeout time.Duration) *Handler {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Handler{timeout: timeout}
+}
+
+// Add registers a readiness check under name. Checks must be added before the
+// handler starts serving.
+func (h *Handler) Add(name string, check Check) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// Live handles GET /healthz.
+func (h *Handler) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]Status{"status": StatusUp})
+}
+
+// Ready handles GET /readyz. It responds 200 when every check passes and 503
+// otherwise, with the result of each check in both cases.
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.Run(r.Context())
+	status := http.StatusOK
+	if report.Status != StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// Run executes every check concurrently and collects their results.
+func (h *Handler) Run(ctx context.Context) Report {
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(h.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range h.checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(ctx)
+			result := Result{Status: StatusUp, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = result
+			if err != nil {
+				report.Status = StatusDown
+			}
+		}(c)
+	}
+	wg.Wait()
+	return report
+}
+
+// WritableDir returns a check that passes when a file can be created in dir.
+func WritableDir(dir string) Check {
+	return func(ctx context.Context) error {
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return fmt.Errorf("directory %s is not writable: %w", dir, err)
+		}
+		name := f.Name()
+		f.Close()
+		return os.Remove(name)
+	}
+}
+
+// Probe responses are read by orchestrators rather than API clients, so they
+// are plain JSON instead of the view envelope.
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
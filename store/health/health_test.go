@@ -0,0 +1,84 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func serveReady(h *Handler) (*httptest.ResponseRecorder, Report) {
+	rr := httptest.NewRecorder()
+	h.Ready(rr, httptest.NewRequest("GET", "/readyz", nil))
+	var report Report
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	return rr, report
+}
+
+func TestReadyReportsEveryDependency(t *testing.T) {
+	h := NewHandler(time.Second)
+	h.Add("mongo", func(context.Context) error { return nil })
+	h.Add("smtp", func(context.Context) error { return errors.New("connection refused") })
+
+	rr, report := serveReady(h)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", rr.Code)
+	}
+	if report.Status != StatusDown {
+		t.Errorf("expected overall status down, got %q", report.Status)
+	}
+	if got := report.Checks["mongo"]; got.Status != StatusUp {
+		t.Errorf("expected mongo up, got %+v", got)
+	}
+	if got := report.Checks["smtp"]; got.Status != StatusDown || got.Error != "connection refused" {
+		t.Errorf("expected smtp down with error, got %+v", got)
+	}
+}
+
+func TestReadyTimesOutSlowChecks(t *testing.T) {
+	h := NewHandler(10 * time.Millisecond)
+	h.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	rr, report := serveReady(h)
+	if rr.Code != http.StatusServiceUnavailable || report.Checks["slow"].Status != StatusDown {
+		t.Errorf("expected slow check to fail, got %d %+v", rr.Code, report)
+	}
+}
+
+func TestLiveAndReadyWithoutFailures(t *testing.T) {
+	h := NewHandler(0)
+	h.Add("uploadDir", WritableDir(t.TempDir()))
+
+	rr := httptest.NewRecorder()
+	h.Live(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected liveness 200, got %d", rr.Code)
+	}
+
+	if rr, report := serveReady(h); rr.Code != http.StatusOK || report.Status != StatusUp {
+		t.Errorf("expected readiness 200, got %d %+v", rr.Code, report)
+	}
+}
+
+func TestWritableDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := WritableDir(dir)(context.Background()); err != nil {
+		t.Fatalf("expected %s to be writable: %v", dir, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected probe file to be removed, found %d entries", len(entries))
+	}
+
+	if err := WritableDir(filepath.Join(dir, "missing"))(context.Background()); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
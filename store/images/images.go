@@ -0,0 +1,212 @@
+// Package images checks uploaded product images and stores them, with
+// thumbnails, in a blob store under keys derived from their content.
+// Uploading the same image twice therefore yields the same blobs, which
+// products may share.
+package images
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"store/blob"
+	"store/model"
+	"store/validation"
+
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels is the largest image, in pixels, that is decoded. It keeps small
+// files declaring huge dimensions from exhausting memory.
+const MaxPixels = 50_000_000
+
+// ThumbnailSizes are the boxes, in pixels, that thumbnails are fitted in.
+var ThumbnailSizes = []int{160, 480}
+
+// KeyPrefix starts the keys of uploaded images.
+const KeyPrefix = "products/"
+
+// extensions maps the sniffed content types that are accepted to the
+// extension of the stored blob.
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// Store keeps images and their thumbnails in a blob store.
+type Store struct {
+	blobs blob.BlobStore
+}
+
+// NewStore returns a store that keeps its images in blobs.
+func NewStore(blobs blob.BlobStore) *Store {
+	return &Store{blobs: blobs}
+}
+
+// Save reads an image, checks that it is a JPEG, PNG or WebP image that can
+// be decoded, and stores it with a thumbnail for each of ThumbnailSizes.
+// Thumbnails of opaque images are JPEGs and those of the others PNGs; an
+// image already fitting a size is its own thumbnail. Problems with the
+// content are returned as validation.Errors for the "image" field.
+func (s *Store) Save(ctx context.Context, r io.Reader) (model.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return model.Image{}, err
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := extensions[contentType]
+	if !ok {
+		return model.Image{}, invalid("must be a JPEG, PNG or WebP image")
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return model.Image{}, invalid("could not be decoded")
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return model.Image{}, invalid(fmt.Sprintf("must have at most %d pixels", MaxPixels))
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return model.Image{}, invalid("could not be decoded")
+	}
+
+	sum := sha256.Sum256(data)
+	stem := KeyPrefix + hex.EncodeToString(sum[:16])
+	saved := model.Image{Key: stem + ext, Width: cfg.Width, Height: cfg.Height}
+	if err := s.put(ctx, saved.Key, contentType, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
+		return model.Image{}, err
+	}
+
+	for _, size := range ThumbnailSizes {
+		thumb := Fit(src, size)
+		if thumb == src {
+			saved.Thumbnails = append(saved.Thumbnails, model.Thumbnail{Key: saved.Key, Width: cfg.Width, Height: cfg.Height})
+			continue
+		}
+		t := model.Thumbnail{Width: thumb.Bounds().Dx(), Height: thumb.Bounds().Dy()}
+		thumbType, encode := "image/png", func(w io.Writer) error { return png.Encode(w, thumb) }
+		if opaque(thumb) {
+			thumbType, encode = "image/jpeg", func(w io.Writer) error { return jpeg.Encode(w, thumb, &jpeg.Options{Quality: 85}) }
+		}
+		t.Key = thumbnailKey(stem, size, thumbType)
+		if err := s.put(ctx, t.Key, thumbType, encode); err != nil {
+			return model.Image{}, err
+		}
+		saved.Thumbnails = append(saved.Thumbnails, t)
+	}
+	return saved, nil
+}
+
+// opaque reports whether img has no transparent pixels.
+func opaque(img image.Image) bool {
+	o, ok := img.(interface{ Opaque() bool })
+	return ok && o.Opaque()
+}
+
+func invalid(message string) error {
+	return validation.Errors{{Field: "image", Message: message}}
+}
+
+// thumbnailKey returns the key of the thumbnail of the given size and
+// content type of the image whose key starts with stem.
+func thumbnailKey(stem string, size int, contentType string) string {
+	return fmt.Sprintf("%s-%d%s", stem, size, map[string]string{"image/jpeg": ".jpg", "image/png": ".png"}[contentType])
+}
+
+// put stores the content written by content under key, unless a blob is
+// already stored there: keys follow the content, so it is the same.
+func (s *Store) put(ctx context.Context, key, contentType string, content func(io.Writer) error) error {
+	if ok, err := s.blobs.Exists(ctx, key); err != nil || ok {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := content(&buf); err != nil {
+		return err
+	}
+	return s.blobs.Put(ctx, key, &buf, contentType)
+}
+
+// Remove deletes an image and its thumbnails. Keys that do not name a blob,
+// such as the paths of pictures served from elsewhere, are left alone.
+func (s *Store) Remove(ctx context.Context, key string) error {
+	if !blob.ValidKey(key) {
+		return nil
+	}
+	keys := []string{key}
+	if stem := strings.TrimSuffix(key, path.Ext(key)); isHash(path.Base(stem)) {
+		for _, size := range ThumbnailSizes {
+			keys = append(keys, thumbnailKey(stem, size, "image/jpeg"), thumbnailKey(stem, size, "image/png"))
+		}
+	}
+
+	var errs []error
+	for _, k := range keys {
+		if err := s.blobs.Delete(ctx, k); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Users tells whether products use an image. The product repositories are
+// Users.
+type Users interface {
+	ImageUsed(ctx context.Context, key string) (bool, error)
+}
+
+// Release removes an image and its thumbnails once no product in users
+// uses it any more. Uploads are keyed by their content, so other products
+// may share the image.
+func (s *Store) Release(ctx context.Context, key string, users Users) error {
+	used, err := users.ImageUsed(ctx, key)
+	if err != nil || used {
+		return err
+	}
+	return s.Remove(ctx, key)
+}
+
+// isHash reports whether name is derived from the content, as Save does.
+func isHash(name string) bool {
+	_, err := hex.DecodeString(name)
+	return err == nil && len(name) == 2*16
+}
+
+// SetURLs fills in the URLs clients download the images of p from: its
+// cover, its gallery and the images of its variants. Images kept outside
+// the store, which products without a gallery may name, get no URL.
+func (s *Store) SetURLs(p *model.Product) {
+	p.ImageURL = s.url(p.Image)
+	for i := range p.Images {
+		img := &p.Images[i]
+		img.URL = s.blobs.URL(img.Key)
+		for j := range img.Thumbnails {
+			img.Thumbnails[j].URL = s.blobs.URL(img.Thumbnails[j].Key)
+		}
+	}
+	for i := range p.Variants {
+		p.Variants[i].ImageURL = s.url(p.Variants[i].Image)
+	}
+}
+
+// url returns the URL of the image stored under key, or "" if key does not
+// name one.
+func (s *Store) url(key string) string {
+	if !strings.HasPrefix(key, KeyPrefix) || !blob.ValidKey(key) {
+		return ""
+	}
+	return s.blobs.URL(key)
+}
@@ -0,0 +1,156 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"store/blob"
+	"store/model"
+	"store/validation"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSave(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(blob.NewFileStore(dir, "/uploads"))
+	ctx := context.Background()
+
+	src := image.NewNRGBA(image.Rect(0, 0, 1000, 500))
+	for i := range src.Pix {
+		src.Pix[i] = 0xff
+	}
+	data := encodePNG(t, src)
+	img, err := s.Save(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Ext(img.Key) != ".png" || len(path.Base(img.Key)) != 32+4 || path.Dir(img.Key) != "products" || img.Width != 1000 || img.Height != 500 {
+		t.Errorf("unexpected image %+v", img)
+	}
+	if len(img.Thumbnails) != len(ThumbnailSizes) {
+		t.Fatalf("expected %d thumbnails, got %+v", len(ThumbnailSizes), img.Thumbnails)
+	}
+	for i, thumb := range img.Thumbnails {
+		size := ThumbnailSizes[i]
+		if thumb.Width != size || thumb.Height != size/2 || path.Ext(thumb.Key) != ".jpg" {
+			t.Errorf("unexpected thumbnail %+v for size %d", thumb, size)
+		}
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(thumb.Key)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, format, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil || format != "jpeg" || cfg.Width != thumb.Width {
+			t.Errorf("thumbnail %s: %s %+v %v", thumb.Key, format, cfg, err)
+		}
+	}
+
+	again, err := s.Save(ctx, bytes.NewReader(data))
+	if err != nil || again.Key != img.Key {
+		t.Errorf("expected the same content to get the same name, got %+v %v", again, err)
+	}
+
+	p := model.Product{Variants: []model.Variant{{SKU: "TEE-S", Image: img.Key}, {SKU: "TEE-M", Image: "tee.jpg"}}}
+	p.SetImages([]model.Image{img})
+	s.SetURLs(&p)
+	if p.Images[0].URL != "/uploads/"+img.Key || p.Images[0].Thumbnails[0].URL != "/uploads/"+img.Thumbnails[0].Key {
+		t.Errorf("unexpected URLs %+v", p.Images[0])
+	}
+	if p.ImageURL != "/uploads/"+img.Key || p.Variants[0].ImageURL != p.ImageURL || p.Variants[1].ImageURL != "" {
+		t.Errorf("expected the cover and the variant image in the store to get URLs, got %q %+v", p.ImageURL, p.Variants)
+	}
+
+	if err := s.Remove(ctx, img.Key); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "products")); len(entries) != 0 {
+		t.Errorf("expected the image and its thumbnails to be removed, found %v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(img.Key))); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the image to be removed, got %v", err)
+	}
+}
+
+func TestSaveTransparentKeepsPNGThumbnails(t *testing.T) {
+	s := NewStore(blob.NewFileStore(t.TempDir(), "/uploads"))
+	src := image.NewNRGBA(image.Rect(0, 0, 300, 600))
+	src.Set(0, 0, color.NRGBA{R: 0xff, A: 0xff})
+	img, err := s.Save(context.Background(), bytes.NewReader(encodePNG(t, src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	small, large := img.Thumbnails[0], img.Thumbnails[1]
+	if path.Ext(small.Key) != ".png" || small.Width != 80 || small.Height != 160 {
+		t.Errorf("unexpected thumbnail %+v", small)
+	}
+	if large.Width != 240 || large.Height != 480 {
+		t.Errorf("unexpected thumbnail %+v", large)
+	}
+}
+
+func TestSaveSmallImageIsItsOwnThumbnail(t *testing.T) {
+	s := NewStore(blob.NewFileStore(t.TempDir(), "/uploads"))
+	img, err := s.Save(context.Background(), bytes.NewReader(encodePNG(t, image.NewGray(image.Rect(0, 0, 20, 10)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, thumb := range img.Thumbnails {
+		if thumb.Key != img.Key {
+			t.Errorf("expected %s to be its own thumbnail, got %+v", img.Key, thumb)
+		}
+	}
+}
+
+func TestSaveRejectsOtherContent(t *testing.T) {
+	s := NewStore(blob.NewFileStore(t.TempDir(), "/uploads"))
+	png := encodePNG(t, image.NewGray(image.Rect(0, 0, 20, 10)))
+	for name, data := range map[string][]byte{
+		"text":      []byte("not an image"),
+		"gif":       []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"),
+		"truncated": png[:len(png)/2],
+	} {
+		_, err := s.Save(context.Background(), bytes.NewReader(data))
+		var errs validation.Errors
+		if !errors.As(err, &errs) || errs[0].Field != "image" {
+			t.Errorf("%s: expected a validation error, got %v", name, err)
+		}
+	}
+}
+
+func TestFitAveragesPixels(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			if x%2 == 0 {
+				src.Set(x, y, color.RGBA{R: 200, A: 0xff})
+			} else {
+				src.Set(x, y, color.RGBA{B: 100, A: 0xff})
+			}
+		}
+	}
+	dst := Fit(src, 2)
+	if dst.Bounds().Dx() != 2 || dst.Bounds().Dy() != 1 {
+		t.Fatalf("unexpected size %v", dst.Bounds())
+	}
+	if got := dst.At(1, 0).(color.RGBA); got != (color.RGBA{R: 100, B: 50, A: 0xff}) {
+		t.Errorf("expected the average colour, got %v", got)
+	}
+}
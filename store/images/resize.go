@@ -0,0 +1,56 @@
+package images
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Fit scales src down, keeping its aspect ratio, so that neither side is
+// longer than size. It returns src itself if it already fits.
+func Fit(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	if w >= h {
+		w, h = size, max(1, h*size/w)
+	} else {
+		w, h = max(1, w*size/h), size
+	}
+	return resize(src, w, h)
+}
+
+// resize scales src to w×h with a box filter: each pixel is the average of
+// the source pixels it covers. It is only meant for scaling down.
+func resize(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	// Premultiplied RGBA averages correctly across transparent pixels.
+	in := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(in, in.Bounds(), src, b.Min, draw.Src)
+
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := in.Pix[in.PixOffset(x0, sy):in.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			px := out.Pix[out.PixOffset(x, y):]
+			for c := range sum {
+				px[c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,247 @@
+// Package inventory tracks how many units of each product and variant are
+// on hand and reserved, and warns by email when stock runs low.
+//
+// Reserve, Release and Commit implement checkout: units are reserved while an
+// order is open, released if it is abandoned and committed once it is paid.
+// Adjust changes the on-hand count for any other reason, such as a delivery
+// or a stocktake, and records that reason.
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"store/config"
+	"store/email"
+	"store/model"
+	"store/repository"
+	"store/requestid"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidQuantity is returned for quantities that are not positive and
+// for adjustments of zero.
+var ErrInvalidQuantity = errors.New("inventory: quantity must be positive")
+
+// Service applies stock changes and sends low-stock alerts. After every
+// change it updates the InStock flag of the product, which listings filter
+// on.
+type Service struct {
+	repo     repository.InventoryRepository
+	products repository.ProductRepository
+	mailer   email.Mailer
+	cfg      config.InventoryConfig
+	logger   *logrus.Logger
+	now      func() time.Time
+}
+
+// NewService returns a Service that sends its alerts through mailer.
+func NewService(repo repository.InventoryRepository, products repository.ProductRepository, mailer email.Mailer, cfg config.InventoryConfig, logger *logrus.Logger) *Service {
+	return &Service{repo: repo, products: products, mailer: mailer, cfg: cfg, logger: logger, now: time.Now}
+}
+
+// Levels returns the stock levels of a product and its variants.
+func (s *Service) Levels(ctx context.Context, productID int) ([]model.StockLevel, error) {
+	return s.repo.Levels(ctx, productID)
+}
+
+// SetStock fills in the stock of the variants of products, which is what
+// their levels have available.
+func (s *Service) SetStock(ctx context.Context, products []model.Product) error {
+	ids := make([]int, 0, len(products))
+	for _, p := range products {
+		if len(p.Variants) > 0 {
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	levels, err := s.repo.LevelsOf(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	available := make(map[int]map[string]int, len(ids))
+	for _, l := range levels {
+		if available[l.ProductID] == nil {
+			available[l.ProductID] = map[string]int{}
+		}
+		available[l.ProductID][l.SKU] = l.Available
+	}
+	for i := range products {
+		for j := range products[i].Variants {
+			v := &products[i].Variants[j]
+			v.Stock = available[products[i].ID][v.SKU]
+		}
+	}
+	return nil
+}
+
+// RemoveSKU deletes the stock of a SKU that is no longer sold, so that a
+// variant created again with the same SKU starts without stock, and updates
+// the InStock flag of the product.
+func (s *Service) RemoveSKU(ctx context.Context, productID int, sku string) error {
+	if err := s.repo.DeleteLevel(ctx, productID, sku); err != nil {
+		return err
+	}
+	s.UpdateInStock(ctx, productID)
+	return nil
+}
+
+// History returns the adjustments made to a product, or to one of its SKUs,
+// newest first.
+func (s *Service) History(ctx context.Context, productID int, sku string) ([]model.StockAdjustment, error) {
+	return s.repo.Adjustments(ctx, productID, sku)
+}
+
+func (s *Service) Reserve(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	level, err := s.repo.Reserve(ctx, productID, sku, quantity)
+	if err != nil {
+		return nil, err
+	}
+	s.UpdateInStock(ctx, productID)
+	s.checkLowStock(ctx, level, quantity)
+	return level, nil
+}
+
+func (s *Service) Release(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	level, err := s.repo.Release(ctx, productID, sku, quantity)
+	if err != nil {
+		return nil, err
+	}
+	s.UpdateInStock(ctx, productID)
+	return level, nil
+}
+
+func (s *Service) Commit(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	level, err := s.repo.Commit(ctx, productID, sku, quantity)
+	if err != nil {
+		return nil, err
+	}
+	s.UpdateInStock(ctx, productID)
+	return level, nil
+}
+
+// Adjust adds delta to the on-hand count and records the reason.
+func (s *Service) Adjust(ctx context.Context, productID int, sku string, delta int, reason string) (*model.StockLevel, error) {
+	if delta == 0 {
+		return nil, ErrInvalidQuantity
+	}
+	level, err := s.repo.Adjust(ctx, productID, sku, delta)
+	if err != nil {
+		return nil, err
+	}
+
+	adjustment := model.StockAdjustment{
+		ProductID: productID,
+		SKU:       sku,
+		Delta:     delta,
+		Reason:    reason,
+		OnHand:    level.OnHand,
+		RequestID: requestid.FromContext(ctx),
+		At:        s.now().UTC(),
+	}
+	if err := s.repo.AddAdjustment(ctx, adjustment); err != nil {
+		// The stock has already changed, so the caller must not retry; the
+		// missing history entry is only logged.
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"action":     "record_stock_adjustment",
+			"status":     "fail",
+			"product_id": productID,
+			"sku":        sku,
+			"delta":      delta,
+			"error":      err.Error(),
+		}).Error("Failed to record stock adjustment")
+	}
+
+	s.UpdateInStock(ctx, productID)
+	if delta < 0 {
+		s.checkLowStock(ctx, level, -delta)
+	}
+	return level, nil
+}
+
+// UpdateInStock sets the InStock flag of the product from the stock it can
+// sell: that of its variants, or its own if it has none. Levels left over
+// from variants that were deleted, or from before the product had variants,
+// do not count. A failure is only logged: the flag is corrected by the next
+// change.
+func (s *Service) UpdateInStock(ctx context.Context, productID int) {
+	product, err := s.products.FindByID(ctx, productID)
+	var levels []model.StockLevel
+	if err == nil {
+		levels, err = s.repo.Levels(ctx, productID)
+	}
+	if err == nil {
+		inStock := slices.ContainsFunc(levels, func(l model.StockLevel) bool { return l.Available > 0 && sells(product, l.SKU) })
+		err = s.products.Update(ctx, productID, repository.ProductUpdate{InStock: &inStock})
+	}
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"action":     "update_in_stock",
+			"status":     "fail",
+			"product_id": productID,
+			"error":      err.Error(),
+		}).Error("Failed to update the in-stock flag of the product")
+	}
+}
+
+// sells reports whether sku is sold as part of p: one of its variants, or
+// the product itself when it has none.
+func sells(p *model.Product, sku string) bool {
+	if len(p.Variants) == 0 {
+		return sku == ""
+	}
+	return slices.ContainsFunc(p.Variants, func(v model.Variant) bool { return v.SKU == sku })
+}
+
+// checkLowStock sends an alert if taking decrease units from the available
+// count made it cross the threshold. Alerts are sent once per crossing rather
+// than on every change below the threshold.
+func (s *Service) checkLowStock(ctx context.Context, level *model.StockLevel, decrease int) {
+	threshold := s.cfg.LowStockThreshold
+	before := level.Available + decrease
+	if before <= threshold || level.Available > threshold {
+		return
+	}
+
+	entry := s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"action":     "low_stock_alert",
+		"product_id": level.ProductID,
+		"sku":        level.SKU,
+		"available":  level.Available,
+		"threshold":  threshold,
+	})
+	if s.cfg.AlertEmail == "" || s.mailer == nil {
+		entry.WithField("status", "skipped").Warn("Stock is low; no alert address is configured")
+		return
+	}
+
+	item := fmt.Sprintf("product %d", level.ProductID)
+	if level.SKU != "" {
+		item = fmt.Sprintf("SKU %s of product %d", level.SKU, level.ProductID)
+	}
+	subject := fmt.Sprintf("Low stock: %s", item)
+	body := fmt.Sprintf("Only %d units of %s are available (on hand %d, reserved %d). The alert threshold is %d.",
+		level.Available, item, level.OnHand, level.Reserved, threshold)
+
+	if err := s.mailer.SendEmail(s.cfg.AlertEmail, subject, body); err != nil {
+		entry.WithFields(logrus.Fields{"status": "fail", "error": err.Error()}).Error("Failed to send low-stock alert")
+		return
+	}
+	entry.WithField("status", "success").Info("Low-stock alert sent")
+}
@@ -0,0 +1,121 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"store/config"
+	"store/model"
+	"store/money"
+	"store/repository"
+	"store/requestid"
+
+	"github.com/sirupsen/logrus"
+)
+
+type recordingMailer struct {
+	subjects []string
+}
+
+func (m *recordingMailer) SendEmail(to, subject, body string) error {
+	m.subjects = append(m.subjects, subject)
+	return nil
+}
+
+func TestReserveReleaseCommit(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repository.NewMemoryInventoryRepository(), repository.NewMemoryProductRepository(), nil, config.InventoryConfig{}, logrus.New())
+
+	if _, err := s.Reserve(ctx, 1, "", 1); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound before any stock exists, got %v", err)
+	}
+	if _, err := s.Adjust(ctx, 1, "", 10, "delivery"); err != nil {
+		t.Fatalf("Adjust: %v", err)
+	}
+	if _, err := s.Reserve(ctx, 1, "", 4); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if _, err := s.Reserve(ctx, 1, "", 7); !errors.Is(err, repository.ErrInsufficientStock) {
+		t.Fatalf("expected ErrInsufficientStock when reserving more than is available, got %v", err)
+	}
+	if _, err := s.Release(ctx, 1, "", 1); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	level, err := s.Commit(ctx, 1, "", 3)
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if level.OnHand != 7 || level.Reserved != 0 || level.Available != 7 {
+		t.Errorf("expected 7 on hand and available with nothing reserved, got %+v", level)
+	}
+	if _, err := s.Adjust(ctx, 1, "", -8, "stocktake"); !errors.Is(err, repository.ErrInsufficientStock) {
+		t.Errorf("expected ErrInsufficientStock when removing more than is available, got %v", err)
+	}
+}
+
+func TestAdjustRecordsHistory(t *testing.T) {
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	s := NewService(repository.NewMemoryInventoryRepository(), repository.NewMemoryProductRepository(), nil, config.InventoryConfig{}, logrus.New())
+
+	s.Adjust(ctx, 1, "1-M-RED", 5, "delivery")
+	s.Adjust(ctx, 1, "1-M-RED", -2, "damaged")
+	s.Adjust(ctx, 1, "1-L-RED", 3, "delivery")
+
+	history, err := s.History(ctx, 1, "1-M-RED")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(history) != 2 || history[0].Reason != "damaged" || history[0].OnHand != 3 || history[0].RequestID != "req-1" {
+		t.Errorf("expected the newest adjustment first with its reason and request ID, got %+v", history)
+	}
+}
+
+func TestLowStockAlertIsSentOncePerCrossing(t *testing.T) {
+	ctx := context.Background()
+	mailer := &recordingMailer{}
+	cfg := config.InventoryConfig{LowStockThreshold: 3, AlertEmail: "stock@example.com"}
+	s := NewService(repository.NewMemoryInventoryRepository(), repository.NewMemoryProductRepository(), mailer, cfg, logrus.New())
+
+	s.Adjust(ctx, 1, "", 6, "delivery")
+	s.Reserve(ctx, 1, "", 2) // 4 available
+	s.Reserve(ctx, 1, "", 1) // 3 available: crosses the threshold
+	s.Reserve(ctx, 1, "", 1) // 2 available: already below
+	if len(mailer.subjects) != 1 {
+		t.Fatalf("expected one alert, got %v", mailer.subjects)
+	}
+
+	s.Adjust(ctx, 1, "", 5, "delivery") // 7 available
+	s.Adjust(ctx, 1, "", -4, "damaged") // 3 available: crosses again
+	if len(mailer.subjects) != 2 {
+		t.Errorf("expected a second alert after restocking, got %v", mailer.subjects)
+	}
+}
+
+func TestInStockFollowsAvailability(t *testing.T) {
+	ctx := context.Background()
+	products := repository.NewMemoryProductRepository()
+	products.Import(ctx, &model.Product{ID: 1, Name: "Tee", Price: money.Money{Amount: 1000, Currency: "USD"}})
+	s := NewService(repository.NewMemoryInventoryRepository(), products, nil, config.InventoryConfig{}, logrus.New())
+
+	inStock := func() bool {
+		p, err := products.FindByID(ctx, 1)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		return p.InStock
+	}
+
+	s.Adjust(ctx, 1, "", 2, "delivery")
+	if !inStock() {
+		t.Error("expected the product to be in stock after a delivery")
+	}
+	s.Reserve(ctx, 1, "", 2)
+	if inStock() {
+		t.Error("expected the product to be out of stock once every unit is reserved")
+	}
+	s.Release(ctx, 1, "", 1)
+	if !inStock() {
+		t.Error("expected the product to be back in stock after a release")
+	}
+}
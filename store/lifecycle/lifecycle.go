@@ -0,0 +1,136 @@
+// Package lifecycle runs the HTTP server until the process is asked to stop
+// and then shuts everything down in order: the server stops accepting
+// connections and drains in-flight requests, then every registered shutdown
+// hook runs, all within a single deadline.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Manager owns the server lifecycle.
+type Manager struct {
+	timeout time.Duration
+	logger  *logrus.Logger
+	hooks   []hook
+}
+
+// New returns a Manager that allows timeout for draining requests and running
+// the shutdown hooks together.
+func New(timeout time.Duration, logger *logrus.Logger) *Manager {
+	return &Manager{timeout: timeout, logger: logger}
+}
+
+// OnShutdown registers fn to run after the server has stopped. Hooks run one
+// at a time in the order they were registered, so background workers that
+// still need a resource should be registered before the resource itself.
+func (m *Manager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	m.hooks = append(m.hooks, hook{name: name, fn: fn})
+}
+
+// Run listens on srv.Addr and serves until ctx is cancelled or the process
+// receives SIGINT or SIGTERM, then shuts down. It returns nil after a clean
+// shutdown. If it cannot listen, the hooks still run, so that what was
+// started before it is released.
+func (m *Manager) Run(ctx context.Context, srv *http.Server) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		hookCtx, cancel := context.WithTimeout(context.Background(), m.timeout)
+		defer cancel()
+		return errors.Join(fmt.Errorf("listen: %w", err), m.runHooks(hookCtx))
+	}
+	return m.Serve(ctx, srv, ln)
+}
+
+// Serve is like Run but accepts connections on ln.
+func (m *Manager) Serve(ctx context.Context, srv *http.Server, ln net.Listener) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	m.logger.WithFields(logrus.Fields{
+		"action": "start_server",
+		"status": "success",
+		"addr":   ln.Addr().String(),
+	}).Info("Server is running")
+
+	select {
+	case err := <-serveErr:
+		// The server stopped on its own, so there is nothing to drain, but
+		// the hooks still release what main acquired.
+		return errors.Join(err, m.runHooks(context.Background()))
+	case <-ctx.Done():
+	}
+	// Restore the default signal behaviour so that a second signal kills a
+	// shutdown that hangs.
+	stop()
+
+	m.logger.WithFields(logrus.Fields{
+		"action": "shutdown",
+		"status": "start",
+	}).Info("Server is shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("drain requests: %w", err))
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
+	errs = append(errs, m.runHooks(shutdownCtx))
+
+	err := errors.Join(errs...)
+	status := "success"
+	if err != nil {
+		status = "fail"
+	}
+	m.logger.WithFields(logrus.Fields{
+		"action": "shutdown",
+		"status": status,
+	}).Info("Server exited")
+	return err
+}
+
+func (m *Manager) runHooks(ctx context.Context) error {
+	var errs []error
+	for _, h := range m.hooks {
+		if err := h.fn(ctx); err != nil {
+			m.logger.WithFields(logrus.Fields{
+				"action": "shutdown_hook",
+				"status": "fail",
+				"hook":   h.name,
+				"error":  err.Error(),
+			}).Error("Shutdown hook failed")
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		m.logger.WithFields(logrus.Fields{
+			"action": "shutdown_hook",
+			"status": "success",
+			"hook":   h.name,
+		}).Info("Shutdown hook completed")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package lifecycle
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestServeDrainsRequestsThenRunsHooks(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("done"))
+	})}
+
+	var order []string
+	m := New(time.Second, logrus.New())
+	m.OnShutdown("first", func(context.Context) error {
+		order = append(order, "first")
+		return nil
+	})
+	m.OnShutdown("second", func(context.Context) error {
+		order = append(order, "second")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- m.Serve(ctx, srv, ln) }()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	cancel()
+
+	if got := <-body; got != "done" {
+		t.Errorf("expected in-flight request to complete, got %q", got)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("expected hooks to run in registration order, got %v", order)
+	}
+}
+
+func TestServeReportsHookErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(time.Second, logrus.New())
+	m.OnShutdown("mongo", func(context.Context) error { return io.ErrClosedPipe })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Serve(ctx, &http.Server{}, ln); err == nil {
+		t.Fatal("expected the hook error to be returned")
+	}
+}
+
+func TestRunRunsHooksWhenListenFails(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	ran := false
+	m := New(time.Second, logrus.New())
+	m.OnShutdown("queue", func(context.Context) error {
+		ran = true
+		return nil
+	})
+
+	err = m.Run(context.Background(), &http.Server{Addr: taken.Addr().String()})
+	if err == nil {
+		t.Fatal("expected listening on an address in use to fail")
+	}
+	if !ran {
+		t.Error("expected the hooks to run after the listen failure")
+	}
+}
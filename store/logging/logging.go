@@ -0,0 +1,121 @@
+// Package logging builds the single logrus logger shared by every package
+// and carries request-scoped fields through contexts.
+//
+// Code serving a request logs through logger.WithContext(ctx); the hook
+// installed by New then adds the request ID and any fields attached to ctx
+// with WithFields, so every entry can be traced back to its request.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"store/config"
+	"store/requestid"
+
+	"github.com/sirupsen/logrus"
+)
+
+// New returns a logger configured by cfg. The returned io.Closer releases
+// the log file, if any, and should be closed when the logger is no longer
+// used.
+func New(cfg config.LogConfig) (*logrus.Logger, io.Closer, error) {
+	logger := logrus.New()
+
+	switch cfg.Format {
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	case "text", "":
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	default:
+		return nil, nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	level, err := logrus.ParseLevel(strings.ToLower(cfg.Level))
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.SetLevel(level)
+
+	var writers []io.Writer
+	var closer io.Closer = nopCloser{}
+	for _, out := range cfg.Outputs {
+		switch out {
+		case "stdout":
+			writers = append(writers, os.Stdout)
+		case "stderr":
+			writers = append(writers, os.Stderr)
+		case "file":
+			f, err := OpenRotatingFile(cfg.File.Path, int64(cfg.File.MaxSizeMB)<<20, cfg.File.RotateEvery, cfg.File.MaxBackups)
+			if err != nil {
+				return nil, nil, err
+			}
+			writers = append(writers, f)
+			closer = f
+		default:
+			return nil, nil, fmt.Errorf("unknown log output %q", out)
+		}
+	}
+	switch len(writers) {
+	case 0:
+		logger.SetOutput(os.Stdout)
+	case 1:
+		logger.SetOutput(writers[0])
+	default:
+		logger.SetOutput(io.MultiWriter(writers...))
+	}
+
+	logger.AddHook(ContextHook{})
+	return logger, closer, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx carrying fields in addition to any fields
+// it already carries. Entries logged with that context include them.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	merged := make(logrus.Fields, len(fields))
+	for k, v := range FieldsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// FieldsFromContext returns the fields attached to ctx with WithFields.
+func FieldsFromContext(ctx context.Context) logrus.Fields {
+	fields, _ := ctx.Value(fieldsKey{}).(logrus.Fields)
+	return fields
+}
+
+// ContextHook adds the request ID and the fields carried by an entry's
+// context to the entry. Fields set explicitly on the entry take precedence.
+type ContextHook struct{}
+
+func (ContextHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (ContextHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	for k, v := range FieldsFromContext(entry.Context) {
+		if _, ok := entry.Data[k]; !ok {
+			entry.Data[k] = v
+		}
+	}
+	if id := requestid.FromContext(entry.Context); id != "" {
+		entry.Data["request_id"] = id
+	}
+	return nil
+}
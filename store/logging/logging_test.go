@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"store/config"
+	"store/requestid"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestNewWritesJSONWithContextFields(t *testing.T) {
+	cfg := config.Default().Log
+	cfg.Format = "json"
+	cfg.Level = "debug"
+	logger, closer, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	ctx = WithFields(ctx, logrus.Fields{"path": "/api/v1/products", "action": "from_context"})
+	logger.WithContext(ctx).WithField("action", "explicit").Debug("hello")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON entry, got %q: %v", buf.String(), err)
+	}
+	if entry["request_id"] != "req-1" || entry["path"] != "/api/v1/products" {
+		t.Errorf("expected context fields in entry, got %v", entry)
+	}
+	if entry["action"] != "explicit" {
+		t.Errorf("expected explicit field to win over context, got %v", entry["action"])
+	}
+}
+
+func TestNewRejectsUnknownLevel(t *testing.T) {
+	cfg := config.Default().Log
+	cfg.Level = "verbose"
+	if _, _, err := New(cfg); err == nil {
+		t.Fatal("expected an error for an unknown level")
+	}
+}
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "store.log")
+	f, err := OpenRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	clock := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	f.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "store-*.log"))
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups to be kept, got %v", backups)
+	}
+	current, _ := os.ReadFile(path)
+	if string(current) != "fourth\n" {
+		t.Errorf("expected only the last line in the current file, got %q", current)
+	}
+	oldest, _ := os.ReadFile(backups[0])
+	if string(oldest) != "second\n" {
+		t.Errorf("expected the oldest kept backup to hold the second line, got %q", oldest)
+	}
+}
+
+func TestRotatingFileRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.log")
+	f, err := OpenRotatingFile(path, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	clock := time.Now()
+	f.now = func() time.Time { return clock }
+	f.openedAt = clock
+
+	f.Write([]byte("today\n"))
+	clock = clock.Add(30 * time.Minute)
+	f.Write([]byte("still today\n"))
+	clock = clock.Add(time.Hour)
+	f.Write([]byte("tomorrow\n"))
+
+	backups, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "store-*.log"))
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 backup, got %v", backups)
+	}
+	old, _ := os.ReadFile(backups[0])
+	if string(old) != "today\nstill today\n" {
+		t.Errorf("unexpected backup contents %q", old)
+	}
+}
@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names rotated files so that they sort chronologically.
+const backupTimeFormat = "20060102T150405.000"
+
+// RotatingFile is an io.WriteCloser that appends to a file and moves it aside
+// once it grows beyond maxBytes or has been open for interval. Rotated files
+// are named after the original with the rotation time inserted before the
+// extension, e.g. store-20240102T150405.000.log.
+type RotatingFile struct {
+	path       string
+	maxBytes   int64
+	interval   time.Duration
+	maxBackups int
+	now        func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// OpenRotatingFile opens path for appending, creating it and its directory if
+// needed. A zero maxBytes or interval disables that trigger and a zero
+// maxBackups keeps every rotated file.
+func OpenRotatingFile(path string, maxBytes int64, interval time.Duration, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:       path,
+		maxBytes:   maxBytes,
+		interval:   interval,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) shouldRotate(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxBytes > 0 && f.size+int64(n) > f.maxBytes {
+		return true
+	}
+	return f.interval > 0 && f.now().Sub(f.openedAt) >= f.interval
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("create log directory: %w", err)
+	}
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat log file: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = f.now()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	ext := filepath.Ext(f.path)
+	backup := strings.TrimSuffix(f.path, ext) + "-" + f.now().Format(backupTimeFormat) + ext
+	if err := os.Rename(f.path, backup); err != nil {
+		return fmt.Errorf("rotate log file: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.prune()
+}
+
+// prune removes the oldest rotated files beyond maxBackups.
+func (f *RotatingFile) prune() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+	ext := filepath.Ext(f.path)
+	backups, err := filepath.Glob(strings.TrimSuffix(f.path, ext) + "-*" + ext)
+	if err != nil {
+		return err
+	}
+	if len(backups) <= f.maxBackups {
+		return nil
+	}
+
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-f.maxBackups] {
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
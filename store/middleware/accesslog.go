@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"store/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AccessLog writes one structured entry per request once it has been served.
+// It also attaches the method and path to the request context, so that every
+// entry logged while serving the request carries them.
+// Server errors are logged at error level and client errors at warn level.
+func AccessLog(logger *logrus.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := record(w)
+			r = r.WithContext(logging.WithFields(r.Context(), logrus.Fields{
+				"method": r.Method,
+				"path":   r.URL.Path,
+			}))
+			next.ServeHTTP(rec, r)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			entry := logger.WithContext(r.Context()).WithFields(logrus.Fields{
+				"action":      "http_request",
+				"status_code": status,
+				"bytes":       rec.bytes,
+				"duration_ms": time.Since(start).Milliseconds(),
+				"remote_addr": r.RemoteAddr,
+				"user_agent":  r.UserAgent(),
+			})
+			switch {
+			case status >= http.StatusInternalServerError:
+				entry.WithField("status", "error").Error("Request served")
+			case status >= http.StatusBadRequest:
+				entry.WithField("status", "fail").Warn("Request served")
+			default:
+				entry.WithField("status", "success").Info("Request served")
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Package middleware provides the http.Handler wrappers every route is served
+// through: request IDs, access logging, panic recovery, timeouts and body
+// size limits.
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// Middleware wraps a handler with additional behaviour.
+type Middleware func(http.Handler) http.Handler
+
+// Chain composes mws into a single Middleware. The first one is the
+// outermost, so it sees the request first and the response last.
+func Chain(mws ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}
+}
+
+// Limits bounds how long a route may run and how large its request body may
+// be. Zero values disable the corresponding limit.
+type Limits struct {
+	Timeout      time.Duration
+	MaxBodyBytes int64
+}
+
+// Limit applies l to a route.
+func Limit(l Limits) Middleware {
+	return Chain(MaxBodyBytes(l.MaxBodyBytes), Timeout(l.Timeout))
+}
+
+// responseRecorder remembers the status code and size of a response so that
+// it can be logged, and whether anything has been written yet.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// record returns w as a *responseRecorder, wrapping it only if an outer
+// middleware has not already done so.
+func record(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *responseRecorder) written() bool {
+	return rec.status != 0
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
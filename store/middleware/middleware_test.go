@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"store/logging"
+	"store/requestid"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func newTestLogger() (*logrus.Logger, *test.Hook) {
+	logger, hook := test.NewNullLogger()
+	logger.AddHook(logging.ContextHook{})
+	return logger, hook
+}
+
+func TestRecoverRendersInternalError(t *testing.T) {
+	logger, hook := newTestLogger()
+	h := Chain(RequestID(), AccessLog(logger), Recover(logger))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", rr.Code)
+	}
+	var body struct {
+		Status    string `json:"status"`
+		RequestID string `json:"requestId"`
+		Error     struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != "error" || body.Error.Code != "INTERNAL_ERROR" {
+		t.Errorf("unexpected envelope %s", rr.Body.String())
+	}
+	if body.RequestID == "" || body.RequestID != rr.Header().Get(requestid.Header) {
+		t.Errorf("expected request ID %q in body, got %q", rr.Header().Get(requestid.Header), body.RequestID)
+	}
+
+	if len(hook.Entries) != 2 {
+		t.Fatalf("expected panic and access log entries, got %d", len(hook.Entries))
+	}
+	for _, e := range hook.Entries {
+		if e.Data["request_id"] != body.RequestID {
+			t.Errorf("%s entry: expected request_id %q, got %v", e.Data["action"], body.RequestID, e.Data["request_id"])
+		}
+	}
+	for _, e := range hook.Entries {
+		if e.Data["path"] != "/" || e.Data["method"] != "GET" {
+			t.Errorf("%s entry: expected method and path from context, got %v", e.Data["action"], e.Data)
+		}
+	}
+	if access := hook.LastEntry(); access.Data["status_code"] != http.StatusInternalServerError {
+		t.Errorf("expected access log status 500, got %v", access.Data["status_code"])
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	var seen string
+	h := RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestid.FromContext(r.Context())
+	}))
+
+	tests := []struct {
+		sent string
+		keep bool
+	}{
+		{"abc-123", true},
+		{"", false},
+		{"bad id\r\n", false},
+		{strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(requestid.Header, tt.sent)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		got := rr.Header().Get(requestid.Header)
+		if got == "" || got != seen {
+			t.Errorf("sent %q: header %q does not match context %q", tt.sent, got, seen)
+		}
+		if (got == tt.sent) != tt.keep {
+			t.Errorf("sent %q: expected keep=%v, got %q", tt.sent, tt.keep, got)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	h := Timeout(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.Write([]byte("too late"))
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), "too late") {
+		t.Errorf("late write leaked into response: %s", rr.Body.String())
+	}
+}
+
+func TestTimeoutPassesResponseThrough(t *testing.T) {
+	h := Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if rr.Code != http.StatusCreated || rr.Body.String() != "created" || rr.Header().Get("X-Test") != "yes" {
+		t.Errorf("unexpected response %d %q %v", rr.Code, rr.Body.String(), rr.Header())
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	h := MaxBodyBytes(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+
+	// Declared length over the limit is rejected before the handler runs.
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/", strings.NewReader("0123456789")))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", rr.Code)
+	}
+
+	// Chunked bodies are cut off while being read.
+	req := httptest.NewRequest("POST", "/", io.NopCloser(bytes.NewReader([]byte("0123456789"))))
+	req.ContentLength = -1
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413 for unknown length, got %d", rr.Code)
+	}
+}
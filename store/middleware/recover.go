@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"store/view"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Recover turns a panicking handler into a 500 error envelope and logs the
+// panic with its stack trace. If the handler had already started writing its
+// response, the response is left as it is.
+func Recover(logger *logrus.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := record(w)
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				logger.WithContext(r.Context()).WithFields(logrus.Fields{
+					"action": "recover_panic",
+					"status": "fail",
+					"panic":  fmt.Sprint(p),
+					"stack":  string(debug.Stack()),
+				}).Error("Recovered from panic while serving request")
+
+				if !rec.written() {
+					view.RenderError(rec, r, view.Internal("Internal server error"))
+				}
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+
+	"store/requestid"
+)
+
+// validRequestID limits client-supplied IDs to a length and character set
+// that is safe to echo in headers and write to logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID stores the request's ID in its context and echoes it in the
+// X-Request-ID response header. A well-formed ID sent by the client is kept
+// so that calls can be traced across services; otherwise a new one is made.
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestid.Header)
+			if !validRequestID.MatchString(id) {
+				id = requestid.New()
+			}
+			w.Header().Set(requestid.Header, id)
+			next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"store/blob"
+	"store/images"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// legacyProduct holds the image of a stored product. Before images were
+// kept in a blob store, a product named its image by the bare name of its
+// file in the upload directory.
+type legacyProduct struct {
+	ID    int    `bson:"id"`
+	Image string `bson:"image"`
+}
+
+// imageMigration copies the files of an upload directory to a blob store
+// and rewrites the products, in the trash or not, that name them.
+type imageMigration struct {
+	dir    string
+	blobs  blob.BlobStore
+	dryRun bool
+	// keys maps the files already looked at to their keys, or to "" if they
+	// are not in the upload directory.
+	keys   map[string]string
+	copied int
+}
+
+// run migrates every product naming a file and returns how many it changed.
+func (m *imageMigration) run(ctx context.Context, products *mongo.Collection) (int, error) {
+	cursor, err := products.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var p legacyProduct
+		if err := cursor.Decode(&p); err != nil {
+			return migrated, err
+		}
+		set, err := m.product(ctx, p)
+		if err != nil {
+			return migrated, fmt.Errorf("product %d: %w", p.ID, err)
+		}
+		if len(set) == 0 {
+			continue
+		}
+		if !m.dryRun {
+			if _, err := products.UpdateOne(ctx, bson.M{"_id": cursor.Current.Lookup("_id")}, bson.M{"$set": set}); err != nil {
+				return migrated, fmt.Errorf("product %d: %w", p.ID, err)
+			}
+		}
+		migrated++
+	}
+	return migrated, cursor.Err()
+}
+
+// product returns the fields of p to set so that it names a key instead of
+// a file, or nothing if it already does.
+func (m *imageMigration) product(ctx context.Context, p legacyProduct) (bson.M, error) {
+	key, err := m.key(ctx, p.Image)
+	if err != nil || key == "" {
+		return nil, err
+	}
+	return bson.M{"image": key}, nil
+}
+
+// key copies the file name of the upload directory to the blob store and
+// returns its key, or "" if name is not such a file.
+func (m *imageMigration) key(ctx context.Context, name string) (string, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return "", nil
+	}
+	if key, ok := m.keys[name]; ok {
+		return key, nil
+	}
+	key := images.KeyPrefix + name
+	info, err := os.Stat(filepath.Join(m.dir, name))
+	if errors.Is(err, os.ErrNotExist) || err == nil && !info.Mode().IsRegular() || !blob.ValidKey(key) {
+		m.keys[name] = ""
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := m.copy(ctx, name, key); err != nil {
+		return "", err
+	}
+	m.keys[name] = key
+	return key, nil
+}
+
+// copy stores the file name under key, unless a blob is already there.
+func (m *imageMigration) copy(ctx context.Context, name, key string) error {
+	if ok, err := m.blobs.Exists(ctx, key); err != nil || ok {
+		return err
+	}
+	m.copied++
+	if m.dryRun {
+		return nil
+	}
+	f, err := os.Open(filepath.Join(m.dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.blobs.Put(ctx, key, f, mime.TypeByExtension(filepath.Ext(name)))
+}
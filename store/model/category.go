@@ -0,0 +1,91 @@
+package model
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Category groups products in the catalog. Categories form a tree through
+// Parent, the slug of the parent category, which is empty for top-level
+// categories. Products refer to their category by slug.
+type Category struct {
+	Slug     string `json:"slug" bson:"slug"`
+	Name     string `json:"name" bson:"name"`
+	Parent   string `json:"parent,omitempty" bson:"parent"`
+	Position int    `json:"position" bson:"position"`
+}
+
+type Categories []Category
+
+// CategoryNode is a category together with its subcategories.
+type CategoryNode struct {
+	Category
+	Children []CategoryNode `json:"children"`
+}
+
+// Tree arranges the categories into trees, ordering siblings by position and
+// then by name. Categories whose parent does not exist become roots.
+func (cs Categories) Tree() []CategoryNode {
+	children := map[string]Categories{}
+	var roots Categories
+	for _, c := range cs {
+		if c.Parent != "" && cs.contains(c.Parent) {
+			children[c.Parent] = append(children[c.Parent], c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+
+	var build func(Categories) []CategoryNode
+	build = func(level Categories) []CategoryNode {
+		slices.SortFunc(level, func(a, b Category) int {
+			return cmp.Or(cmp.Compare(a.Position, b.Position), cmp.Compare(a.Name, b.Name))
+		})
+		nodes := make([]CategoryNode, 0, len(level))
+		for _, c := range level {
+			nodes = append(nodes, CategoryNode{Category: c, Children: build(children[c.Slug])})
+		}
+		return nodes
+	}
+	return build(roots)
+}
+
+// Subtree returns the category with the given slug and its descendants.
+func (cs Categories) Subtree(slug string) (CategoryNode, bool) {
+	var find func([]CategoryNode) (CategoryNode, bool)
+	find = func(nodes []CategoryNode) (CategoryNode, bool) {
+		for _, n := range nodes {
+			if n.Slug == slug {
+				return n, true
+			}
+			if found, ok := find(n.Children); ok {
+				return found, true
+			}
+		}
+		return CategoryNode{}, false
+	}
+	return find(cs.Tree())
+}
+
+// Descendants returns slug followed by the slugs of every category below it.
+// It returns nil if there is no category with that slug.
+func (cs Categories) Descendants(slug string) []string {
+	node, ok := cs.Subtree(slug)
+	if !ok {
+		return nil
+	}
+	var slugs []string
+	var walk func(CategoryNode)
+	walk = func(n CategoryNode) {
+		slugs = append(slugs, n.Slug)
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(node)
+	return slugs
+}
+
+func (cs Categories) contains(slug string) bool {
+	return slices.ContainsFunc(cs, func(c Category) bool { return c.Slug == slug })
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Deletion marks a document that was moved to the trash, recording when and
+// by whom. Both fields are empty for documents that were not deleted.
+type Deletion struct {
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	DeletedBy string     `json:"deletedBy,omitempty" bson:"deletedBy,omitempty"`
+}
+
+// Deleted reports whether the document is in the trash.
+func (d Deletion) Deleted() bool {
+	return d.DeletedAt != nil
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// StockLevel is the inventory of a product, or of one of its variants when
+// SKU is set. Available is always OnHand minus Reserved.
+type StockLevel struct {
+	ProductID int       `json:"productId" bson:"productId"`
+	SKU       string    `json:"sku,omitempty" bson:"sku"`
+	OnHand    int       `json:"onHand" bson:"onHand"`
+	Reserved  int       `json:"reserved" bson:"reserved"`
+	Available int       `json:"available" bson:"available"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// StockAdjustment records a manual change to the on-hand count and why it was
+// made.
+type StockAdjustment struct {
+	ProductID int       `json:"productId" bson:"productId"`
+	SKU       string    `json:"sku,omitempty" bson:"sku"`
+	Delta     int       `json:"delta" bson:"delta"`
+	Reason    string    `json:"reason" bson:"reason"`
+	OnHand    int       `json:"onHand" bson:"onHand"`
+	RequestID string    `json:"requestId,omitempty" bson:"requestId,omitempty"`
+	At        time.Time `json:"at" bson:"at"`
+}
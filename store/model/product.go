@@ -1,10 +1,191 @@
 package model
 
+import (
+	"strings"
+
+	"store/money"
+)
+
+// Gender is the customer group a product is made for.
+type Gender string
+
+const (
+	GenderMen    Gender = "men"
+	GenderWomen  Gender = "women"
+	GenderKids   Gender = "kids"
+	GenderUnisex Gender = "unisex"
+)
+
 type Product struct {
-	ID    int     `json:"id"`
-	Name  string  `json:"name"`
-	Price float64 `json:"price"`
-	Image string  `json:"image,omitempty"`
+	ID int `json:"id" bson:"id"`
+	// SKU is the merchant's own code for the product, unique among products
+	// that have one. Bulk imports match products by it.
+	SKU  string `json:"sku,omitempty" bson:"sku,omitempty"`
+	Name string `json:"name" bson:"name"`
+	// Price is in the currency of the store.
+	Price money.Money `json:"price" bson:"price"`
+	// Prices lists what the product costs in other currencies, at most one
+	// price per currency. Clients asking for a currency not listed get Price
+	// converted at the exchange rate.
+	Prices []money.Money `json:"prices" bson:"prices"`
+	Image  string        `json:"image,omitempty" bson:"image"`
+	// ImageURL is where clients download Image from. Like the URLs of the
+	// gallery it is not stored.
+	ImageURL string `json:"imageUrl,omitempty" bson:"-"`
+
+	Description      string   `json:"description" bson:"description"`
+	Category         string   `json:"category" bson:"category"`
+	Brand            string   `json:"brand" bson:"brand"`
+	Gender           Gender   `json:"gender" bson:"gender"`
+	Sizes            []string `json:"sizes" bson:"sizes"`
+	Colors           []string `json:"colors" bson:"colors"`
+	Material         string   `json:"material" bson:"material"`
+	CareInstructions string   `json:"careInstructions" bson:"careInstructions"`
+	Tags             []string `json:"tags" bson:"tags"`
+
+	// Images is the ordered gallery of uploaded images. Its first image is
+	// the cover, whose key Image holds; products without a gallery may name
+	// any image.
+	Images []Image `json:"images" bson:"images"`
+
+	Variants []Variant `json:"variants" bson:"variants"`
+	// InStock reports whether any unit of the product or of one of its
+	// variants is available. It is kept up to date by the inventory service.
+	InStock bool `json:"inStock" bson:"inStock"`
+
+	Deletion `bson:",inline"`
+}
+
+// Variant is a sellable SKU of a product in one size and color. Price, when
+// set, overrides the product price; Image overrides the product image. Its
+// stock is kept by the inventory service under the same SKU.
+type Variant struct {
+	SKU   string       `json:"sku" bson:"sku"`
+	Size  string       `json:"size" bson:"size"`
+	Color string       `json:"color" bson:"color"`
+	Price *money.Money `json:"price,omitempty" bson:"price,omitempty"`
+	Image string       `json:"image,omitempty" bson:"image,omitempty"`
+	// ImageURL is where clients download Image from; it is not stored.
+	ImageURL string `json:"imageUrl,omitempty" bson:"-"`
+	// Stock is how many units of the variant are available. It is read from
+	// the inventory when products are shown and is not stored either.
+	Stock int `json:"stock" bson:"-"`
+}
+
+// Image is an uploaded image with its thumbnails. Key names its blob in the
+// image store and is derived from the content, so products uploading the
+// same image share its blobs. URL is where clients download it from; it is
+// not stored, because signed URLs expire.
+type Image struct {
+	Key        string      `json:"key" bson:"key"`
+	URL        string      `json:"url,omitempty" bson:"-"`
+	Width      int         `json:"width" bson:"width"`
+	Height     int         `json:"height" bson:"height"`
+	Thumbnails []Thumbnail `json:"thumbnails" bson:"thumbnails"`
+}
+
+// Thumbnail is a smaller copy of an Image.
+type Thumbnail struct {
+	Key    string `json:"key" bson:"key"`
+	URL    string `json:"url,omitempty" bson:"-"`
+	Width  int    `json:"width" bson:"width"`
+	Height int    `json:"height" bson:"height"`
+}
+
+// SetImages replaces the gallery of p and makes its first image the cover.
+func (p *Product) SetImages(images []Image) {
+	p.Images = images
+	p.Image = ""
+	if len(images) > 0 {
+		p.Image = images[0].Key
+	}
+}
+
+// ImageIndex returns the position of the image with the given key in the
+// gallery of p, or -1 if it is not there.
+func (p *Product) ImageIndex(key string) int {
+	for i, img := range p.Images {
+		if img.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Variant returns the variant of p with the given SKU, if there is one.
+func (p *Product) Variant(sku string) (*Variant, bool) {
+	for i := range p.Variants {
+		if p.Variants[i].SKU == sku {
+			return &p.Variants[i], true
+		}
+	}
+	return nil, false
+}
+
+// PriceOf returns the price v sells for: its own price if it overrides the
+// product's, and the product price otherwise.
+func (p *Product) PriceOf(v Variant) money.Money {
+	if v.Price != nil {
+		return *v.Price
+	}
+	return p.Price
+}
+
+// ListedPrice returns the price of p listed in currency: Price if it is the
+// currency of the store, or the entry of Prices.
+func (p *Product) ListedPrice(currency string) (money.Money, bool) {
+	if p.Price.Currency == currency {
+		return p.Price, true
+	}
+	for _, m := range p.Prices {
+		if m.Currency == currency {
+			return m, true
+		}
+	}
+	return money.Money{}, false
+}
+
+// ApplyDefaults fills in the attributes that products stored before they
+// existed lack, so that every product is returned with the same shape.
+func (p *Product) ApplyDefaults() {
+	if p.Gender == "" {
+		p.Gender = GenderUnisex
+	}
+	if p.Sizes == nil {
+		p.Sizes = []string{}
+	}
+	if p.Colors == nil {
+		p.Colors = []string{}
+	}
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+	if p.Prices == nil {
+		p.Prices = []money.Money{}
+	}
+	if p.Images == nil {
+		p.Images = []Image{}
+	}
+	if p.Variants == nil {
+		p.Variants = []Variant{}
+	}
+}
+
+// NormalizeList trims every value and drops blanks and case-insensitive
+// duplicates, keeping the first spelling of each value.
+func NormalizeList(values []string) []string {
+	out := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		key := strings.ToLower(v)
+		if v == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, v)
+	}
+	return out
 }
 
 type Products []Product
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+
+	"store/money"
+)
+
+// ExchangeRate is what one unit of the currency of the store is worth in
+// another currency. Prices of products that do not list one in Currency are
+// converted at Rate.
+type ExchangeRate struct {
+	Currency  string        `json:"currency" bson:"currency"`
+	Rate      money.Decimal `json:"rate" bson:"rate"`
+	UpdatedAt time.Time     `json:"updatedAt" bson:"updatedAt"`
+}
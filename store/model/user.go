@@ -4,6 +4,8 @@ type User struct {
 	Email    string `json:"email" bson:"email"`
 	Password string `json:"password" bson:"password"`
 	Username string `json:"username" bson:"username"`
+
+	Deletion `bson:",inline"`
 }
 
 type Users []User
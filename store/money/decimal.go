@@ -0,0 +1,172 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxDigits is the largest number of significant digits a Decimal holds,
+// which is what a BSON Decimal128 can store exactly.
+const MaxDigits = 34
+
+var decimalPattern = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+
+// Decimal is an exact decimal number, such as an exchange rate: an integer
+// scaled down by a power of ten. The zero value is 0.
+type Decimal struct {
+	unscaled *big.Int
+	scale    int
+
+	// invalid says what was wrong with the JSON d was decoded from.
+	invalid string
+}
+
+// NewDecimal returns unscaled / 10^scale.
+func NewDecimal(unscaled int64, scale int) Decimal {
+	return Decimal{unscaled: big.NewInt(unscaled), scale: scale}
+}
+
+// ParseDecimal reads a decimal written with digits, an optional sign and an
+// optional decimal point, such as "-12.50". Exponents are not accepted.
+func ParseDecimal(s string) (Decimal, error) {
+	if !decimalPattern.MatchString(s) {
+		return Decimal{}, fmt.Errorf("%q is not a decimal number", s)
+	}
+	whole, fraction, _ := strings.Cut(s, ".")
+	unscaled, _ := new(big.Int).SetString(whole+fraction, 10)
+	if len(strings.TrimLeft(strings.TrimLeft(whole, "+-")+fraction, "0")) > MaxDigits {
+		return Decimal{}, fmt.Errorf("%q has more than %d significant digits", s, MaxDigits)
+	}
+	return Decimal{unscaled: unscaled, scale: len(fraction)}, nil
+}
+
+func (d Decimal) int() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// String writes d with as many decimal places as it was given, such as
+// "19.90".
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.int()).String()
+	if d.scale > 0 {
+		if len(digits) <= d.scale {
+			digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+	}
+	if d.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Sign returns -1, 0 or +1 as d is negative, zero or positive.
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+// Cmp compares d and e exactly and returns -1, 0 or +1.
+func (d Decimal) Cmp(e Decimal) int {
+	a, b := d.int(), e.int()
+	switch {
+	case d.scale < e.scale:
+		a = new(big.Int).Mul(a, pow10(e.scale-d.scale))
+	case d.scale > e.scale:
+		b = new(big.Int).Mul(b, pow10(d.scale-e.scale))
+	}
+	return a.Cmp(b)
+}
+
+// CompareDecimal compares d with the decimal limit of a validation rule.
+func (d Decimal) CompareDecimal(limit string) int {
+	l, err := ParseDecimal(limit)
+	if err != nil {
+		panic("money: invalid limit " + strconv.Quote(limit))
+	}
+	return d.Cmp(l)
+}
+
+// rescale returns the unscaled value of d at the given scale, and false if
+// d has more decimal places than scale that are not zeros.
+func (d Decimal) rescale(scale int) (*big.Int, bool) {
+	if scale >= d.scale {
+		return new(big.Int).Mul(d.int(), pow10(scale-d.scale)), true
+	}
+	q, r := new(big.Int).QuoRem(d.int(), pow10(d.scale-scale), new(big.Int))
+	return q, r.Sign() == 0
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// MarshalJSON writes d as a string, so that clients parsing JSON numbers as
+// binary floating point do not round it.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON reads a decimal string or a JSON number, taking the digits
+// as written. Anything else is kept as invalid for Validate to report, as
+// Money does.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if strings.HasPrefix(s, `"`) && json.Unmarshal(data, &s) != nil {
+		s = ""
+	}
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		*d = Decimal{invalid: "must be a decimal number, such as 0.92"}
+		return nil
+	}
+	*d = parsed
+	return nil
+}
+
+// Validate returns what was wrong with the JSON d was decoded from, or "".
+func (d Decimal) Validate() string {
+	return d.invalid
+}
+
+// MarshalBSONValue stores d as a Decimal128.
+func (d Decimal) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	dec, ok := primitive.ParseDecimal128FromBigInt(d.int(), -d.scale)
+	if !ok {
+		return 0, nil, fmt.Errorf("money: %s does not fit a Decimal128", d)
+	}
+	return bson.MarshalValue(dec)
+}
+
+// UnmarshalBSONValue reads a Decimal128, or an integer.
+func (d *Decimal) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	v := bson.RawValue{Type: t, Value: data}
+	if dec, ok := v.Decimal128OK(); ok {
+		unscaled, exp, err := dec.BigInt()
+		if err != nil {
+			return err
+		}
+		if exp > 0 {
+			unscaled.Mul(unscaled, pow10(exp))
+			exp = 0
+		}
+		*d = Decimal{unscaled: unscaled, scale: -exp}
+		return nil
+	}
+	if n, ok := v.AsInt64OK(); ok && t != bson.TypeDouble {
+		*d = NewDecimal(n, 0)
+		return nil
+	}
+	return errors.New("money: cannot read a decimal from BSON " + t.String())
+}
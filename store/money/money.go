@@ -0,0 +1,198 @@
+// Package money represents prices exactly. Amounts of money are counted in
+// the minor unit of their currency, such as cents, and other decimals, such
+// as exchange rates, keep the digits they were written with. Both are stored
+// in MongoDB as Decimal128 and written to JSON as decimal strings, so that
+// no price passes through binary floating point.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// currencies maps the ISO 4217 codes of the currencies the store accepts to
+// the number of decimal places of their minor unit.
+var currencies = map[string]int{
+	"AED": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CLP": 0,
+	"CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2, "HKD": 2, "HUF": 2,
+	"IDR": 2, "ILS": 2, "INR": 2, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0,
+	"KWD": 3, "KZT": 2, "MXN": 2, "MYR": 2, "NOK": 2, "NZD": 2, "OMR": 3,
+	"PHP": 2, "PLN": 2, "RON": 2, "RUB": 2, "SAR": 2, "SEK": 2, "SGD": 2,
+	"THB": 2, "TND": 3, "TRY": 2, "TWD": 2, "UAH": 2, "USD": 2, "UZS": 2,
+	"VND": 0, "ZAR": 2,
+}
+
+// Known reports whether code is the ISO 4217 code of a currency the store
+// accepts.
+func Known(code string) bool {
+	_, ok := currencies[code]
+	return ok
+}
+
+// Places returns the number of decimal places of the minor unit of
+// currency, such as 2 for the cents of USD, or 0 if it is not known.
+func Places(currency string) int {
+	return currencies[currency]
+}
+
+// ErrUnknownCurrency is returned for currencies that are not Known.
+var ErrUnknownCurrency = errors.New("must be an ISO 4217 currency code, such as USD")
+
+// Money is an amount of a currency, counted in its minor unit.
+type Money struct {
+	Amount   int64
+	Currency string
+
+	// invalid says what was wrong with the JSON m was decoded from.
+	invalid string
+}
+
+// New returns the amount of currency written as a decimal, such as
+// New("19.99", "USD"). It fails if the currency is not known, the amount
+// has more decimal places than its minor unit or is too large.
+func New(amount, currency string) (Money, error) {
+	d, err := ParseDecimal(amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return FromDecimal(d, currency)
+}
+
+// FromDecimal returns d of currency as Money, failing as New does.
+func FromDecimal(d Decimal, currency string) (Money, error) {
+	if !Known(currency) {
+		return Money{}, ErrUnknownCurrency
+	}
+	places := Places(currency)
+	minor, ok := d.rescale(places)
+	if !ok {
+		return Money{}, fmt.Errorf("must have at most %d decimal places in %s", places, currency)
+	}
+	if !minor.IsInt64() {
+		return Money{}, errors.New("is too large")
+	}
+	return Money{Amount: minor.Int64(), Currency: currency}, nil
+}
+
+// Parse reads an amount followed by its currency, such as "19.99 USD", as
+// String writes it.
+func Parse(s string) (Money, error) {
+	amount, currency, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return Money{}, fmt.Errorf("%q must be an amount and a currency, such as 19.99 USD", s)
+	}
+	return New(amount, strings.TrimSpace(currency))
+}
+
+// Decimal returns the amount in units of the currency, such as 19.99.
+func (m Money) Decimal() Decimal {
+	return NewDecimal(m.Amount, Places(m.Currency))
+}
+
+// String writes m as its amount and currency, such as "19.99 USD".
+func (m Money) String() string {
+	return m.Decimal().String() + " " + m.Currency
+}
+
+// Convert returns m in currency at rate, the amount of currency that one
+// unit of the currency of m buys. The result is rounded to the minor unit
+// of currency, halves away from zero.
+func (m Money) Convert(currency string, rate Decimal) (Money, error) {
+	if !Known(currency) {
+		return Money{}, ErrUnknownCurrency
+	}
+	num := new(big.Int).Mul(big.NewInt(m.Amount), rate.int())
+	num.Mul(num, pow10(Places(currency)))
+	den := pow10(rate.scale + Places(m.Currency))
+
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Abs(r).Lsh(r, 1).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	}
+	if !q.IsInt64() {
+		return Money{}, fmt.Errorf("%s is too large to convert to %s", m, currency)
+	}
+	return Money{Amount: q.Int64(), Currency: currency}, nil
+}
+
+// CompareDecimal compares the amount of m in units of its currency with
+// the decimal limit of a validation rule.
+func (m Money) CompareDecimal(limit string) int {
+	return m.Decimal().CompareDecimal(limit)
+}
+
+// document is how Money is written to JSON and stored in MongoDB.
+type document struct {
+	Amount   *Decimal `json:"amount" bson:"amount"`
+	Currency string   `json:"currency" bson:"currency"`
+}
+
+// MarshalJSON writes m as {"amount": "19.99", "currency": "USD"}.
+func (m Money) MarshalJSON() ([]byte, error) {
+	d := m.Decimal()
+	return json.Marshal(document{Amount: &d, Currency: m.Currency})
+}
+
+// UnmarshalJSON reads an object with an amount, as a decimal string or a
+// JSON number, and a currency. A value that is not such an object, or not
+// an amount of a known currency, is kept as invalid for Validate to report,
+// because errors returned while decoding lose the name of the field.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var doc document
+	*m = Money{}
+	switch {
+	case !strings.HasPrefix(strings.TrimSpace(string(data)), "{") || json.Unmarshal(data, &doc) != nil:
+		m.invalid = `must be an object with an amount and a currency, such as {"amount": "19.99", "currency": "USD"}`
+	case doc.Amount == nil || doc.Currency == "":
+		m.invalid = "must have an amount and a currency"
+	case doc.Amount.invalid != "":
+		m.invalid = "amount " + doc.Amount.invalid
+	default:
+		parsed, err := FromDecimal(*doc.Amount, doc.Currency)
+		if err != nil {
+			m.invalid = err.Error()
+		} else {
+			*m = parsed
+		}
+	}
+	return nil
+}
+
+// Validate returns what was wrong with the JSON m was decoded from, or "".
+func (m Money) Validate() string {
+	return m.invalid
+}
+
+// MarshalBSONValue stores m as a document with a Decimal128 amount in units
+// of its currency, which MongoDB can compare and sum exactly.
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	d := m.Decimal()
+	data, err := bson.Marshal(document{Amount: &d, Currency: m.Currency})
+	return bson.TypeEmbeddedDocument, data, err
+}
+
+// UnmarshalBSONValue reads what MarshalBSONValue stores.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	if t != bson.TypeEmbeddedDocument {
+		return fmt.Errorf("money: cannot read money from BSON %s", t)
+	}
+	var doc document
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.Amount == nil {
+		return errors.New("money: stored without an amount")
+	}
+	parsed, err := FromDecimal(*doc.Amount, doc.Currency)
+	if err != nil {
+		return fmt.Errorf("money: stored amount %s %s: %w", doc.Amount, doc.Currency, err)
+	}
+	*m = parsed
+	return nil
+}
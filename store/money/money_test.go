@@ -0,0 +1,124 @@
+package money
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNew(t *testing.T) {
+	for _, tc := range []struct {
+		amount, currency string
+		want             Money
+		err              string
+	}{
+		{"19.99", "USD", Money{Amount: 1999, Currency: "USD"}, ""},
+		{"19.9", "USD", Money{Amount: 1990, Currency: "USD"}, ""},
+		{"19.900", "USD", Money{Amount: 1990, Currency: "USD"}, ""},
+		{"1500", "JPY", Money{Amount: 1500, Currency: "JPY"}, ""},
+		{"1.234", "KWD", Money{Amount: 1234, Currency: "KWD"}, ""},
+		{"-0.05", "EUR", Money{Amount: -5, Currency: "EUR"}, ""},
+		{"19.999", "USD", Money{}, "at most 2 decimal places"},
+		{"1.5", "JPY", Money{}, "at most 0 decimal places"},
+		{"1e3", "USD", Money{}, "not a decimal number"},
+		{"19.99", "XXX", Money{}, "ISO 4217"},
+		{"99999999999999999999", "USD", Money{}, "too large"},
+	} {
+		got, err := New(tc.amount, tc.currency)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("New(%s, %s): expected an error containing %q, got %v", tc.amount, tc.currency, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("New(%s, %s) = %+v, %v; want %+v", tc.amount, tc.currency, got, err, tc.want)
+		}
+	}
+
+	if m, err := Parse("0.10 EUR"); err != nil || m.String() != "0.10 EUR" {
+		t.Errorf("expected Parse to read what String writes, got %v %v", m, err)
+	}
+}
+
+func TestConvertRoundsHalfAwayFromZero(t *testing.T) {
+	rate, _ := ParseDecimal("0.925")
+	for _, tc := range []struct {
+		from Money
+		to   string
+		want int64
+	}{
+		{Money{Amount: 1000, Currency: "USD"}, "EUR", 925},   // 10.00 * 0.925 = 9.25
+		{Money{Amount: 1, Currency: "USD"}, "EUR", 1},        // 0.00925 rounds to 0.01
+		{Money{Amount: -1, Currency: "USD"}, "EUR", -1},      // and away from zero when negative
+		{Money{Amount: 1999, Currency: "USD"}, "JPY", 18},    // 18.49075 yen
+		{Money{Amount: 2000, Currency: "USD"}, "KWD", 18500}, // 18.500 dinars
+	} {
+		got, err := tc.from.Convert(tc.to, rate)
+		if err != nil || got != (Money{Amount: tc.want, Currency: tc.to}) {
+			t.Errorf("%s at %s: got %v %v, want %d %s", tc.from, rate, got, err, tc.want, tc.to)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, _ := json.Marshal(Money{Amount: 1990, Currency: "EUR"})
+	if string(data) != `{"amount":"19.90","currency":"EUR"}` {
+		t.Errorf("unexpected JSON %s", data)
+	}
+
+	var req struct {
+		Price Money `json:"price"`
+	}
+	for body, want := range map[string]Money{
+		`{"price": {"amount": "19.90", "currency": "EUR"}}`: {Amount: 1990, Currency: "EUR"},
+		`{"price": {"amount": 0.1, "currency": "USD"}}`:     {Amount: 10, Currency: "USD"},
+	} {
+		if err := json.Unmarshal([]byte(body), &req); err != nil || req.Price != want {
+			t.Errorf("%s: got %+v %v", body, req.Price, err)
+		}
+	}
+	for body, message := range map[string]string{
+		`{"price": 19.99}`: "must be an object",
+		`{"price": {"amount": "19.999", "currency": "USD"}}`: "at most 2 decimal places",
+		`{"price": {"amount": "19.99"}}`:                     "must have an amount and a currency",
+	} {
+		err := json.Unmarshal([]byte(body), &req)
+		if err != nil || !strings.Contains(req.Price.Validate(), message) {
+			t.Errorf("%s: expected the price to be invalid because it %s, got %q %v", body, message, req.Price.Validate(), err)
+		}
+	}
+}
+
+func TestMoneyBSON(t *testing.T) {
+	type product struct {
+		Price Money `bson:"price"`
+	}
+	data, err := bson.Marshal(product{Money{Amount: 1999, Currency: "USD"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount := bson.Raw(data).Lookup("price", "amount")
+	if amount.Type != bson.TypeDecimal128 || amount.Decimal128().String() != "19.99" {
+		t.Errorf("expected a Decimal128 amount, got %s", amount)
+	}
+
+	var got product
+	if err := bson.Unmarshal(data, &got); err != nil || got.Price != (Money{Amount: 1999, Currency: "USD"}) {
+		t.Errorf("expected the price back, got %+v %v", got, err)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	a, _ := ParseDecimal("1.10")
+	b, _ := ParseDecimal("1.1")
+	c, _ := ParseDecimal("-0.005")
+	if a.Cmp(b) != 0 || c.Cmp(a) >= 0 || a.String() != "1.10" || c.String() != "-0.005" {
+		t.Errorf("unexpected comparisons of %s, %s and %s", a, b, c)
+	}
+	if _, err := ParseDecimal(strings.Repeat("9", MaxDigits+1)); err == nil {
+		t.Error("expected a decimal with too many digits to be rejected")
+	}
+}
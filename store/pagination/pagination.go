@@ -0,0 +1,223 @@
+// Package pagination reads the paging parameters of list endpoints and
+// describes the resulting page in response metadata and Link headers
+// (RFC 5988).
+//
+// Two modes are supported. By default pages are addressed by opaque cursors
+// holding the sort values of the item a page continues from, so that items
+// inserted or deleted meanwhile do not shift pages. The legacy page mode,
+// chosen with the page parameter, skips (page-1)*limit items instead.
+package pagination
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"store/validation"
+)
+
+const (
+	// DefaultLimit is the page size used when the client does not choose one.
+	DefaultLimit = 10
+	// MaxLimit is the largest page size a client may ask for; larger limits
+	// are lowered to it.
+	MaxLimit = 100
+)
+
+// ErrInvalidCursor is returned for cursors that cannot be decoded or do not
+// fit the sort order of the listing.
+var ErrInvalidCursor = errors.New("pagination: invalid cursor")
+
+// Cursor marks where a page starts. Values are the sort values of the item
+// the page continues after, or ends before when Backward is set.
+type Cursor struct {
+	Values   []any `json:"v"`
+	Backward bool  `json:"b,omitempty"`
+}
+
+// Encode returns the cursor as an opaque URL-safe token.
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token returned by Encode. Integer values are
+// returned as int64 and other numbers as float64.
+func DecodeCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var c Cursor
+	if err := dec.Decode(&c); err != nil || len(c.Values) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	for i, v := range c.Values {
+		n, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+		if n, err := n.Int64(); err == nil {
+			c.Values[i] = n
+			continue
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		c.Values[i] = f
+	}
+	return &c, nil
+}
+
+// Request is the page a client asked for.
+type Request struct {
+	Limit int
+	// Page is the 1-based page number in page mode and 0 in cursor mode.
+	Page int
+	// Cursor is where the page starts in cursor mode; nil for the first page.
+	Cursor *Cursor
+}
+
+// Skip returns how many items precede the page in page mode.
+func (p Request) Skip() int {
+	if p.Page == 0 {
+		return 0
+	}
+	return (p.Page - 1) * p.Limit
+}
+
+// Parse reads the limit, cursor and page query parameters. cursor and page
+// cannot be combined.
+func Parse(values url.Values) (Request, validation.Errors) {
+	req := Request{Limit: DefaultLimit}
+	var errs validation.Errors
+
+	if v := strings.TrimSpace(values.Get("limit")); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			errs = append(errs, validation.FieldError{Field: "limit", Message: "must be a positive integer"})
+		}
+		req.Limit = min(limit, MaxLimit)
+	}
+	if v := strings.TrimSpace(values.Get("page")); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			errs = append(errs, validation.FieldError{Field: "page", Message: "must be a positive integer"})
+		}
+		req.Page = page
+	}
+	if v := strings.TrimSpace(values.Get("cursor")); v != "" {
+		cursor, err := DecodeCursor(v)
+		switch {
+		case err != nil:
+			errs = append(errs, validation.FieldError{Field: "cursor", Message: "is not a valid cursor"})
+		case req.Page != 0:
+			errs = append(errs, validation.FieldError{Field: "cursor", Message: "cannot be combined with page"})
+		}
+		req.Cursor = cursor
+	}
+	return req, errs
+}
+
+// Trim removes the extra item a listing fetched beyond the limit to learn
+// whether more items follow in the direction of paging, and reports whether
+// there was one. Listings are fetched with Request.Limit+1 for this.
+func Trim[T any](items []T, req Request) ([]T, bool) {
+	if len(items) <= req.Limit {
+		return items, false
+	}
+	if req.Cursor != nil && req.Cursor.Backward {
+		return items[len(items)-req.Limit:], true
+	}
+	return items[:req.Limit], true
+}
+
+// Meta describes a page in the response metadata.
+type Meta struct {
+	Limit      int    `json:"limit"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+
+	hasNext, hasPrev bool
+}
+
+// NewMeta describes the page of items returned for req. total counts every
+// item of the listing, more is the result of Trim and values returns the
+// sort values of an item, from which the cursors are made.
+func NewMeta[T any](req Request, total int64, more bool, items []T, values func(T) []any) Meta {
+	m := Meta{Limit: req.Limit, Total: total}
+	if req.Page > 0 {
+		m.Page = req.Page
+		m.hasNext = int64(req.Skip()+req.Limit) < total
+		m.hasPrev = req.Page > 1
+		return m
+	}
+	if len(items) == 0 {
+		return m
+	}
+	first, last := values(items[0]), values(items[len(items)-1])
+
+	backward := req.Cursor != nil && req.Cursor.Backward
+	if (backward && more) || (!backward && req.Cursor != nil) {
+		m.PrevCursor = (&Cursor{Values: first, Backward: true}).Encode()
+		m.hasPrev = true
+	}
+	if backward || more {
+		m.NextCursor = (&Cursor{Values: last}).Encode()
+		m.hasNext = true
+	}
+	return m
+}
+
+// SetLinks adds a Link header with the first, prev, next and, in page
+// mode, last pages of the listing requested by r. The links keep the other
+// query parameters of r.
+func SetLinks(w http.ResponseWriter, r *http.Request, m Meta) {
+	link := func(rel string, set func(url.Values)) string {
+		q := r.URL.Query()
+		q.Del("page")
+		q.Del("cursor")
+		set(q)
+		u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+	}
+	page := func(n int) func(url.Values) {
+		return func(q url.Values) { q.Set("page", strconv.Itoa(n)) }
+	}
+	cursor := func(token string) func(url.Values) {
+		return func(q url.Values) { q.Set("cursor", token) }
+	}
+
+	var links []string
+	if m.Page > 0 {
+		links = append(links, link("first", page(1)))
+		if m.hasPrev {
+			links = append(links, link("prev", page(m.Page-1)))
+		}
+		if m.hasNext {
+			links = append(links, link("next", page(m.Page+1)))
+		}
+		lastPage := max(1, int((m.Total+int64(m.Limit)-1)/int64(m.Limit)))
+		links = append(links, link("last", page(lastPage)))
+	} else {
+		links = append(links, link("first", func(url.Values) {}))
+		if m.hasPrev {
+			links = append(links, link("prev", cursor(m.PrevCursor)))
+		}
+		if m.hasNext {
+			links = append(links, link("next", cursor(m.NextCursor)))
+		}
+	}
+	w.Header().Add("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,93 @@
+package pagination
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := &Cursor{Values: []any{19.5, "Slim Jeans", 42}, Backward: true}
+	got, err := DecodeCursor(c.Encode())
+	if err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+	want := &Cursor{Values: []any{19.5, "Slim Jeans", int64(42)}, Backward: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeCursor() = %#v, want %#v", got, want)
+	}
+
+	for _, token := range []string{"not base64!", "e30", "bnVsbA"} {
+		if _, err := DecodeCursor(token); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q): expected ErrInvalidCursor, got %v", token, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	req, errs := Parse(url.Values{"limit": {"500"}, "page": {"3"}})
+	if len(errs) > 0 || req.Limit != MaxLimit || req.Page != 3 || req.Skip() != 2*MaxLimit {
+		t.Errorf("unexpected request %+v, errors %v", req, errs)
+	}
+
+	req, errs = Parse(url.Values{})
+	if len(errs) > 0 || req.Limit != DefaultLimit || req.Page != 0 || req.Cursor != nil {
+		t.Errorf("unexpected default request %+v, errors %v", req, errs)
+	}
+
+	cursor := (&Cursor{Values: []any{1}}).Encode()
+	_, errs = Parse(url.Values{"limit": {"0"}, "page": {"2"}, "cursor": {cursor}})
+	if len(errs) != 2 || errs[0].Field != "limit" || errs[1].Field != "cursor" {
+		t.Errorf("expected limit and cursor errors, got %v", errs)
+	}
+}
+
+func TestMetaAndLinks(t *testing.T) {
+	values := func(n int) []any { return []any{n} }
+
+	// The first page of a cursor listing only links forward.
+	req := Request{Limit: 2}
+	items, more := Trim([]int{1, 2, 3}, req)
+	meta := NewMeta(req, 5, more, items, values)
+	if meta.NextCursor == "" || meta.PrevCursor != "" {
+		t.Fatalf("expected only a next cursor, got %+v", meta)
+	}
+
+	next, _ := DecodeCursor(meta.NextCursor)
+	if !reflect.DeepEqual(next.Values, []any{int64(2)}) || next.Backward {
+		t.Errorf("expected the next page to start after 2, got %+v", next)
+	}
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/products?sort=-price&limit=2", nil)
+	SetLinks(rr, r, meta)
+	link := rr.Header().Get("Link")
+	if !strings.Contains(link, `rel="next"`) || strings.Contains(link, `rel="prev"`) || !strings.Contains(link, "sort=-price") {
+		t.Errorf("unexpected Link header %q", link)
+	}
+
+	// Paging backward drops the extra item at the start of the page.
+	req = Request{Limit: 2, Cursor: &Cursor{Values: []any{4}, Backward: true}}
+	items, more = Trim([]int{1, 2, 3}, req)
+	if !reflect.DeepEqual(items, []int{2, 3}) || !more {
+		t.Errorf("Trim() = %v, %v", items, more)
+	}
+	meta = NewMeta(req, 5, more, items, values)
+	if meta.NextCursor == "" || meta.PrevCursor == "" {
+		t.Errorf("expected both cursors, got %+v", meta)
+	}
+
+	// Page mode links to page numbers, including the last page.
+	req = Request{Limit: 2, Page: 2}
+	meta = NewMeta(req, 5, false, []int{3, 4}, values)
+	rr = httptest.NewRecorder()
+	SetLinks(rr, httptest.NewRequest("GET", "/api/v1/users?page=2&limit=2", nil), meta)
+	link = rr.Header().Get("Link")
+	for _, want := range []string{`page=1>; rel="prev"`, `page=3>; rel="next"`, `page=3>; rel="last"`} {
+		if !strings.Contains(link, want) {
+			t.Errorf("expected %s in Link header %q", want, link)
+		}
+	}
+}
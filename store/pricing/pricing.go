@@ -0,0 +1,161 @@
+// Package pricing keeps the exchange rates from the currency of the store
+// and shows product prices in the currency a client asks for.
+//
+// Products are priced in the currency of the store and may list their own
+// prices in other currencies. A client asking for a currency gets the
+// listed price when there is one, and otherwise the store price converted
+// at the exchange rate, rounded to the minor unit of the currency.
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"store/config"
+	"store/model"
+	"store/money"
+	"store/repository"
+	"store/validation"
+)
+
+var (
+	// ErrNoRate is returned for currencies without an exchange rate.
+	ErrNoRate = errors.New("pricing: no exchange rate")
+	// ErrStoreCurrency is returned when setting or removing the rate of the
+	// currency of the store, which is always 1.
+	ErrStoreCurrency = errors.New("pricing: the rate of the store currency is fixed")
+	// ErrInvalidRate is returned for rates that are not positive.
+	ErrInvalidRate = errors.New("pricing: rate must be positive")
+)
+
+// Service keeps the exchange rates and converts prices with them.
+type Service struct {
+	rates    repository.ExchangeRateRepository
+	currency string
+	now      func() time.Time
+}
+
+// NewService returns a Service for a store pricing in cfg.Currency.
+func NewService(rates repository.ExchangeRateRepository, cfg config.PricingConfig) *Service {
+	return &Service{rates: rates, currency: cfg.Currency, now: time.Now}
+}
+
+// Currency returns the currency of the store.
+func (s *Service) Currency() string {
+	return s.currency
+}
+
+// Rates returns the exchange rates, ordered by currency.
+func (s *Service) Rates(ctx context.Context) ([]model.ExchangeRate, error) {
+	return s.rates.List(ctx)
+}
+
+// SetRate sets how much one unit of the currency of the store is worth in
+// currency.
+func (s *Service) SetRate(ctx context.Context, currency string, rate money.Decimal) (*model.ExchangeRate, error) {
+	switch {
+	case !money.Known(currency):
+		return nil, money.ErrUnknownCurrency
+	case currency == s.currency:
+		return nil, ErrStoreCurrency
+	case rate.Sign() <= 0:
+		return nil, ErrInvalidRate
+	}
+	r := model.ExchangeRate{Currency: currency, Rate: rate, UpdatedAt: s.now().UTC()}
+	if err := s.rates.Set(ctx, r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// DeleteRate removes the exchange rate of currency. Products listing their
+// own price in it are still shown in it.
+func (s *Service) DeleteRate(ctx context.Context, currency string) error {
+	if currency == s.currency {
+		return ErrStoreCurrency
+	}
+	return s.rates.Delete(ctx, currency)
+}
+
+// Converter returns a Converter to currency. It returns
+// money.ErrUnknownCurrency for currencies that are not known and ErrNoRate
+// for those without an exchange rate.
+func (s *Service) Converter(ctx context.Context, currency string) (*Converter, error) {
+	if !money.Known(currency) {
+		return nil, money.ErrUnknownCurrency
+	}
+	c := &Converter{currency: currency, rate: money.NewDecimal(1, 0)}
+	if currency == s.currency {
+		return c, nil
+	}
+	r, err := s.rates.Get(ctx, currency)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrNoRate
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.rate = r.Rate
+	return c, nil
+}
+
+// Converter shows products in one currency.
+type Converter struct {
+	currency string
+	rate     money.Decimal
+}
+
+// Currency returns the currency c converts to.
+func (c *Converter) Currency() string {
+	return c.currency
+}
+
+// Product sets the price of p, and those of its variants, to their price in
+// the currency of c. Variants with their own price get it converted at the
+// exchange rate even when p lists a price in the currency.
+func (c *Converter) Product(p *model.Product) error {
+	price, listed := p.ListedPrice(c.currency)
+	if !listed {
+		var err error
+		if price, err = p.Price.Convert(c.currency, c.rate); err != nil {
+			return err
+		}
+	}
+	for i := range p.Variants {
+		v := &p.Variants[i]
+		if v.Price == nil || v.Price.Currency == c.currency {
+			continue
+		}
+		converted, err := v.Price.Convert(c.currency, c.rate)
+		if err != nil {
+			return fmt.Errorf("variant %s: %w", v.SKU, err)
+		}
+		v.Price = &converted
+	}
+	p.Price = price
+	return nil
+}
+
+// CheckPrices reports the problems of the price of a product, which must be
+// in currency, the currency of the store, and of its price list, which must
+// be in other currencies and list each at most once. A nil price or prices
+// is not checked.
+func CheckPrices(currency string, price *money.Money, prices []money.Money) validation.Errors {
+	var errs validation.Errors
+	if price != nil && price.Currency != "" && price.Currency != currency {
+		errs = append(errs, validation.FieldError{Field: "price", Message: "must be in " + currency + ", the currency of the store"})
+	}
+	for i, m := range prices {
+		field := fmt.Sprintf("prices[%d]", i)
+		switch {
+		case m.Currency == currency:
+			errs = append(errs, validation.FieldError{Field: field, Message: "must not be in " + currency + ", which price is in"})
+		case m.Currency != "" && slices.ContainsFunc(prices[:i], func(o money.Money) bool { return o.Currency == m.Currency }):
+			errs = append(errs, validation.FieldError{Field: field, Message: "lists " + m.Currency + " more than once"})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,65 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"store/config"
+	"store/model"
+	"store/money"
+	"store/repository"
+)
+
+func usd(cents int64) money.Money {
+	return money.Money{Amount: cents, Currency: "USD"}
+}
+
+func TestConverter(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(repository.NewMemoryExchangeRateRepository(), config.PricingConfig{Currency: "USD"})
+	if _, err := s.SetRate(ctx, "USD", money.NewDecimal(1, 0)); !errors.Is(err, ErrStoreCurrency) {
+		t.Errorf("expected the store currency to be refused, got %v", err)
+	}
+	if _, err := s.SetRate(ctx, "EUR", money.NewDecimal(925, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Converter(ctx, "JPY"); !errors.Is(err, ErrNoRate) {
+		t.Errorf("expected ErrNoRate, got %v", err)
+	}
+
+	c, err := s.Converter(ctx, "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	variantPrice := usd(3000)
+	p := model.Product{
+		Price:    usd(2500),
+		Prices:   []money.Money{{Amount: 2000, Currency: "EUR"}},
+		Variants: []model.Variant{{SKU: "A"}, {SKU: "B", Price: &variantPrice}},
+	}
+	if err := c.Product(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Price != (money.Money{Amount: 2000, Currency: "EUR"}) {
+		t.Errorf("expected the listed price, got %s", p.Price)
+	}
+	if p.PriceOf(p.Variants[0]) != p.Price || *p.Variants[1].Price != (money.Money{Amount: 2775, Currency: "EUR"}) {
+		t.Errorf("expected variant prices in EUR, got %s and %s", p.PriceOf(p.Variants[0]), p.Variants[1].Price)
+	}
+	if variantPrice != usd(3000) {
+		t.Errorf("expected the variant price to be replaced, not changed in place, got %s", variantPrice)
+	}
+}
+
+func TestCheckPrices(t *testing.T) {
+	eur := money.Money{Amount: 100, Currency: "EUR"}
+	price := usd(100)
+	if errs := CheckPrices("USD", &price, []money.Money{eur}); len(errs) != 0 {
+		t.Errorf("expected no problems, got %v", errs)
+	}
+	errs := CheckPrices("USD", &eur, []money.Money{price, eur, eur})
+	if len(errs) != 3 || errs[0].Field != "price" || errs[1].Field != "prices[0]" || errs[2].Field != "prices[2]" {
+		t.Errorf("unexpected problems %v", errs)
+	}
+}
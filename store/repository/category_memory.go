@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"store/model"
+)
+
+type memoryCategoryRepository struct {
+	mu         sync.RWMutex
+	categories model.Categories
+}
+
+// NewMemoryCategoryRepository returns a thread-safe CategoryRepository that
+// keeps categories in memory. It is intended for tests and local development.
+func NewMemoryCategoryRepository() CategoryRepository {
+	return &memoryCategoryRepository{}
+}
+
+func (r *memoryCategoryRepository) List(ctx context.Context) (model.Categories, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	categories := slices.Clone(r.categories)
+	slices.SortFunc(categories, func(a, b model.Category) int {
+		return cmp.Or(cmp.Compare(a.Parent, b.Parent), cmp.Compare(a.Position, b.Position), cmp.Compare(a.Name, b.Name))
+	})
+	if categories == nil {
+		categories = model.Categories{}
+	}
+	return categories, nil
+}
+
+func (r *memoryCategoryRepository) FindBySlug(ctx context.Context, slug string) (*model.Category, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if i := r.index(slug); i >= 0 {
+		c := r.categories[i]
+		return &c, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryCategoryRepository) Create(ctx context.Context, c *model.Category) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.index(c.Slug) >= 0 {
+		return ErrConflict
+	}
+	r.categories = append(r.categories, *c)
+	return nil
+}
+
+func (r *memoryCategoryRepository) Update(ctx context.Context, slug string, u CategoryUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(slug)
+	if i < 0 {
+		return ErrNotFound
+	}
+	setIf(&r.categories[i].Name, u.Name)
+	setIf(&r.categories[i].Parent, u.Parent)
+	setIf(&r.categories[i].Position, u.Position)
+	return nil
+}
+
+func (r *memoryCategoryRepository) Delete(ctx context.Context, slug string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(slug)
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.categories = slices.Delete(r.categories, i, i+1)
+	return nil
+}
+
+func (r *memoryCategoryRepository) index(slug string) int {
+	return slices.IndexFunc(r.categories, func(c model.Category) bool { return c.Slug == slug })
+}
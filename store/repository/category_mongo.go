@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"store/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoCategoryRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoCategoryRepository stores categories in the "categories" collection
+// of db.
+func NewMongoCategoryRepository(db *mongo.Database) CategoryRepository {
+	return &mongoCategoryRepository{collection: db.Collection("categories")}
+}
+
+func (r *mongoCategoryRepository) List(ctx context.Context) (model.Categories, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "parent", Value: 1}, {Key: "position", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	categories := model.Categories{}
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *mongoCategoryRepository) FindBySlug(ctx context.Context, slug string) (*model.Category, error) {
+	var category model.Category
+	if err := r.collection.FindOne(ctx, bson.M{"slug": slug}).Decode(&category); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *mongoCategoryRepository) Create(ctx context.Context, c *model.Category) error {
+	_, err := r.collection.InsertOne(ctx, c)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *mongoCategoryRepository) Update(ctx context.Context, slug string, u CategoryUpdate) error {
+	set := bson.M{}
+	if u.Name != nil {
+		set["name"] = *u.Name
+	}
+	if u.Parent != nil {
+		set["parent"] = *u.Parent
+	}
+	if u.Position != nil {
+		set["position"] = *u.Position
+	}
+	if len(set) == 0 {
+		_, err := r.FindBySlug(ctx, slug)
+		return err
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"slug": slug}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoCategoryRepository) Delete(ctx context.Context, slug string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"slug": slug})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"store/model"
+)
+
+type stockKey struct {
+	productID int
+	sku       string
+}
+
+type memoryInventoryRepository struct {
+	mu          sync.Mutex
+	levels      map[stockKey]*model.StockLevel
+	adjustments []model.StockAdjustment
+}
+
+// NewMemoryInventoryRepository returns a thread-safe InventoryRepository
+// that keeps stock in memory. It is intended for tests and local development.
+func NewMemoryInventoryRepository() InventoryRepository {
+	return &memoryInventoryRepository{levels: map[stockKey]*model.StockLevel{}}
+}
+
+func (r *memoryInventoryRepository) Levels(ctx context.Context, productID int) ([]model.StockLevel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	levels := []model.StockLevel{}
+	for key, level := range r.levels {
+		if key.productID == productID {
+			levels = append(levels, *level)
+		}
+	}
+	slices.SortFunc(levels, func(a, b model.StockLevel) int { return cmp.Compare(a.SKU, b.SKU) })
+	return levels, nil
+}
+
+func (r *memoryInventoryRepository) LevelsOf(ctx context.Context, productIDs []int) ([]model.StockLevel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	levels := []model.StockLevel{}
+	for key, level := range r.levels {
+		if slices.Contains(productIDs, key.productID) {
+			levels = append(levels, *level)
+		}
+	}
+	return levels, nil
+}
+
+func (r *memoryInventoryRepository) Reserve(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error) {
+	return r.change(productID, sku, false, func(l *model.StockLevel) bool {
+		if l.Available < quantity {
+			return false
+		}
+		l.Reserved += quantity
+		l.Available -= quantity
+		return true
+	})
+}
+
+func (r *memoryInventoryRepository) Release(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error) {
+	return r.change(productID, sku, false, func(l *model.StockLevel) bool {
+		if l.Reserved < quantity {
+			return false
+		}
+		l.Reserved -= quantity
+		l.Available += quantity
+		return true
+	})
+}
+
+func (r *memoryInventoryRepository) Commit(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error) {
+	return r.change(productID, sku, false, func(l *model.StockLevel) bool {
+		if l.Reserved < quantity {
+			return false
+		}
+		l.Reserved -= quantity
+		l.OnHand -= quantity
+		return true
+	})
+}
+
+func (r *memoryInventoryRepository) Adjust(ctx context.Context, productID int, sku string, delta int) (*model.StockLevel, error) {
+	return r.change(productID, sku, delta >= 0, func(l *model.StockLevel) bool {
+		if l.Available+delta < 0 {
+			return false
+		}
+		l.OnHand += delta
+		l.Available += delta
+		return true
+	})
+}
+
+// change applies apply to a copy of the stock level and stores the copy only
+// if apply accepts the change.
+func (r *memoryInventoryRepository) change(productID int, sku string, create bool, apply func(*model.StockLevel) bool) (*model.StockLevel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := stockKey{productID: productID, sku: sku}
+	current, ok := r.levels[key]
+	if !ok {
+		if !create {
+			return nil, ErrNotFound
+		}
+		current = &model.StockLevel{ProductID: productID, SKU: sku}
+	}
+
+	next := *current
+	if !apply(&next) {
+		return nil, ErrInsufficientStock
+	}
+	next.UpdatedAt = time.Now().UTC()
+	r.levels[key] = &next
+
+	result := next
+	return &result, nil
+}
+
+func (r *memoryInventoryRepository) AddAdjustment(ctx context.Context, a model.StockAdjustment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.adjustments = append(r.adjustments, a)
+	return nil
+}
+
+func (r *memoryInventoryRepository) Adjustments(ctx context.Context, productID int, sku string) ([]model.StockAdjustment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	adjustments := []model.StockAdjustment{}
+	for i := len(r.adjustments) - 1; i >= 0; i-- {
+		a := r.adjustments[i]
+		if a.ProductID == productID && (sku == "" || a.SKU == sku) {
+			adjustments = append(adjustments, a)
+		}
+	}
+	return adjustments, nil
+}
+
+func (r *memoryInventoryRepository) DeleteLevel(ctx context.Context, productID int, sku string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.levels, stockKey{productID: productID, sku: sku})
+	return nil
+}
+
+func (r *memoryInventoryRepository) DeleteProduct(ctx context.Context, productID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	maps.DeleteFunc(r.levels, func(key stockKey, _ *model.StockLevel) bool { return key.productID == productID })
+	r.adjustments = slices.DeleteFunc(r.adjustments, func(a model.StockAdjustment) bool { return a.ProductID == productID })
+	return nil
+}
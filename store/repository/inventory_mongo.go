@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"store/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoInventoryRepository struct {
+	levels      *mongo.Collection
+	adjustments *mongo.Collection
+}
+
+// NewMongoInventoryRepository stores stock levels in the "inventory"
+// collection of db and adjustments in "inventoryAdjustments".
+func NewMongoInventoryRepository(db *mongo.Database) InventoryRepository {
+	return &mongoInventoryRepository{
+		levels:      db.Collection("inventory"),
+		adjustments: db.Collection("inventoryAdjustments"),
+	}
+}
+
+func (r *mongoInventoryRepository) Levels(ctx context.Context, productID int) ([]model.StockLevel, error) {
+	cursor, err := r.levels.Find(ctx, bson.M{"productId": productID}, options.Find().SetSort(bson.D{{Key: "sku", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	levels := []model.StockLevel{}
+	if err := cursor.All(ctx, &levels); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+func (r *mongoInventoryRepository) LevelsOf(ctx context.Context, productIDs []int) ([]model.StockLevel, error) {
+	cursor, err := r.levels.Find(ctx, bson.M{"productId": bson.M{"$in": productIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	levels := []model.StockLevel{}
+	if err := cursor.All(ctx, &levels); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+func (r *mongoInventoryRepository) Reserve(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error) {
+	return r.change(ctx, productID, sku,
+		bson.M{"available": bson.M{"$gte": quantity}},
+		bson.M{"reserved": quantity, "available": -quantity}, false)
+}
+
+func (r *mongoInventoryRepository) Release(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error) {
+	return r.change(ctx, productID, sku,
+		bson.M{"reserved": bson.M{"$gte": quantity}},
+		bson.M{"reserved": -quantity, "available": quantity}, false)
+}
+
+func (r *mongoInventoryRepository) Commit(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error) {
+	return r.change(ctx, productID, sku,
+		bson.M{"reserved": bson.M{"$gte": quantity}},
+		bson.M{"reserved": -quantity, "onHand": -quantity}, false)
+}
+
+func (r *mongoInventoryRepository) Adjust(ctx context.Context, productID int, sku string, delta int) (*model.StockLevel, error) {
+	if delta >= 0 {
+		return r.change(ctx, productID, sku, bson.M{},
+			bson.M{"onHand": delta, "available": delta, "reserved": 0}, true)
+	}
+	return r.change(ctx, productID, sku,
+		bson.M{"available": bson.M{"$gte": -delta}},
+		bson.M{"onHand": delta, "available": delta}, false)
+}
+
+// change applies inc to the stock level of productID and sku if it also
+// matches guard, and returns the level after the update.
+func (r *mongoInventoryRepository) change(ctx context.Context, productID int, sku string, guard bson.M, inc bson.M, upsert bool) (*model.StockLevel, error) {
+	filter := bson.M{"productId": productID, "sku": sku}
+	for k, v := range guard {
+		filter[k] = v
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(upsert)
+	var level model.StockLevel
+	err := retryDuplicateKey(func() error {
+		return r.levels.FindOneAndUpdate(ctx, filter, bson.M{
+			"$inc": inc,
+			"$set": bson.M{"updatedAt": time.Now().UTC()},
+		}, opts).Decode(&level)
+	})
+	if err == nil {
+		return &level, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	// The guard failed or there is no stock level at all.
+	exists, err := r.levels.CountDocuments(ctx, bson.M{"productId": productID, "sku": sku}, options.Count().SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrNotFound
+	}
+	return nil, ErrInsufficientStock
+}
+
+func (r *mongoInventoryRepository) DeleteLevel(ctx context.Context, productID int, sku string) error {
+	_, err := r.levels.DeleteOne(ctx, bson.M{"productId": productID, "sku": sku})
+	return err
+}
+
+func (r *mongoInventoryRepository) DeleteProduct(ctx context.Context, productID int) error {
+	if _, err := r.levels.DeleteMany(ctx, bson.M{"productId": productID}); err != nil {
+		return err
+	}
+	_, err := r.adjustments.DeleteMany(ctx, bson.M{"productId": productID})
+	return err
+}
+
+// retryDuplicateKey runs upsert again if it fails with a duplicate key
+// error. Two upserts of a document that does not exist yet can both try to
+// insert it, and the unique index then rejects the loser, whose retry finds
+// and updates the document the winner inserted.
+func retryDuplicateKey(upsert func() error) error {
+	err := upsert()
+	if mongo.IsDuplicateKeyError(err) {
+		err = upsert()
+	}
+	return err
+}
+
+func (r *mongoInventoryRepository) AddAdjustment(ctx context.Context, a model.StockAdjustment) error {
+	_, err := r.adjustments.InsertOne(ctx, a)
+	return err
+}
+
+func (r *mongoInventoryRepository) Adjustments(ctx context.Context, productID int, sku string) ([]model.StockAdjustment, error) {
+	filter := bson.M{"productId": productID}
+	if sku != "" {
+		filter["sku"] = sku
+	}
+
+	cursor, err := r.adjustments.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	adjustments := []model.StockAdjustment{}
+	if err := cursor.All(ctx, &adjustments); err != nil {
+		return nil, err
+	}
+	return adjustments, nil
+}
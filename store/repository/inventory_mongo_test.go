@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRetryDuplicateKey(t *testing.T) {
+	duplicate := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}}
+
+	calls := 0
+	err := retryDuplicateKey(func() error {
+		calls++
+		if calls == 1 {
+			return duplicate
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("expected the losing upsert to be retried once, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = retryDuplicateKey(func() error {
+		calls++
+		return duplicate
+	})
+	if !mongo.IsDuplicateKeyError(err) || calls != 2 {
+		t.Errorf("expected a second duplicate key error to be returned, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	other := errors.New("network")
+	if err := retryDuplicateKey(func() error { calls++; return other }); err != other || calls != 1 {
+		t.Errorf("expected other errors not to be retried, got %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,606 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"store/model"
+	"store/money"
+	"store/pagination"
+	"store/search"
+	"store/sorting"
+)
+
+type memoryProductRepository struct {
+	mu       sync.RWMutex
+	products []model.Product
+	// lastID is the highest ID allocated or imported so far.
+	lastID int
+}
+
+// NewMemoryProductRepository returns a thread-safe ProductRepository that
+// keeps products in memory. It is intended for tests and local development.
+func NewMemoryProductRepository() ProductRepository {
+	return &memoryProductRepository{}
+}
+
+func (r *memoryProductRepository) List(ctx context.Context, q ProductQuery) (model.Products, error) {
+	nameRe, err := compileFilter(regexp.QuoteMeta(q.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	products := model.Products{}
+	for _, p := range r.products {
+		if matchesProduct(p, q, nameRe) {
+			products = append(products, p)
+		}
+	}
+	return listPage(products, q.sortKeys(), productSortKeys, q.Cursor, q.Skip, q.Limit)
+}
+
+func (r *memoryProductRepository) Count(ctx context.Context, q ProductQuery) (int64, error) {
+	nameRe, err := compileFilter(regexp.QuoteMeta(q.Name))
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var n int64
+	for _, p := range r.products {
+		if matchesProduct(p, q, nameRe) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// matchesProduct reports whether p passes the filters of q. nameRe is q.Name
+// compiled by compileFilter. Products in the trash never match.
+func matchesProduct(p model.Product, q ProductQuery, nameRe *regexp.Regexp) bool {
+	anyOf := func(filter []string, values ...string) bool {
+		if len(filter) == 0 {
+			return true
+		}
+		for _, v := range values {
+			if slices.Contains(filter, v) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case p.Deleted():
+		return false
+	case nameRe != nil && !nameRe.MatchString(p.Name):
+		return false
+	case !anyOf(q.Categories, p.Category), !anyOf(q.Brands, p.Brand):
+		return false
+	case !anyOf(q.Sizes, p.Sizes...), !anyOf(q.Colors, p.Colors...):
+		return false
+	case q.MinPrice != nil && p.Price.Decimal().Cmp(*q.MinPrice) < 0, q.MaxPrice != nil && p.Price.Decimal().Cmp(*q.MaxPrice) > 0:
+		return false
+	case q.InStock != nil && p.InStock != *q.InStock:
+		return false
+	}
+	return true
+}
+
+func (r *memoryProductRepository) Facets(ctx context.Context, q ProductQuery) (*ProductFacets, error) {
+	nameRe, err := compileFilter(regexp.QuoteMeta(q.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// matching returns the products counted for one dimension.
+	matching := func(dimension string) model.Products {
+		var products model.Products
+		without := q.Without(dimension)
+		for _, p := range r.products {
+			if matchesProduct(p, without, nameRe) {
+				products = append(products, p)
+			}
+		}
+		return products
+	}
+	countBy := func(dimension string, values func(model.Product) []string) []FacetCount {
+		counts := map[string]int{}
+		for _, p := range matching(dimension) {
+			for _, v := range values(p) {
+				if v != "" {
+					counts[v]++
+				}
+			}
+		}
+		facets := []FacetCount{}
+		for v, n := range counts {
+			facets = append(facets, FacetCount{Value: v, Count: n})
+		}
+		slices.SortFunc(facets, func(a, b FacetCount) int {
+			return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Value, b.Value))
+		})
+		return facets
+	}
+
+	facets := &ProductFacets{
+		Categories: countBy(FacetCategory, func(p model.Product) []string { return []string{p.Category} }),
+		Sizes:      countBy(FacetSize, func(p model.Product) []string { return p.Sizes }),
+		Colors:     countBy(FacetColor, func(p model.Product) []string { return p.Colors }),
+		Brands:     countBy(FacetBrand, func(p model.Product) []string { return []string{p.Brand} }),
+		Price:      []PriceRange{},
+	}
+
+	buckets := make([]int, len(PriceBoundaries))
+	for _, p := range matching(FacetPrice) {
+		for i := len(PriceBoundaries) - 1; i >= 0; i-- {
+			if p.Price.Decimal().Cmp(money.NewDecimal(PriceBoundaries[i], 0)) >= 0 {
+				buckets[i]++
+				break
+			}
+		}
+	}
+	for i, n := range buckets {
+		if n > 0 {
+			facets.Price = append(facets.Price, priceRange(PriceBoundaries[i], n))
+		}
+	}
+
+	for _, p := range matching(FacetInStock) {
+		if p.InStock {
+			facets.InStock++
+		}
+	}
+	return facets, nil
+}
+
+func (r *memoryProductRepository) FindByID(ctx context.Context, id int) (*model.Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if p := r.find(id); p != nil {
+		product := *p
+		return &product, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Search scores products by how often the terms occur in their name, tags
+// and description, weighted like the MongoDB text index.
+func (r *memoryProductRepository) Search(ctx context.Context, q SearchQuery) ([]ProductHit, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	hits := []ProductHit{}
+	for _, p := range r.products {
+		if p.Deleted() {
+			continue
+		}
+		score := 10*search.Count(p.Name, q.Terms) + search.Count(p.Description, q.Terms)
+		for _, tag := range p.Tags {
+			score += 5 * search.Count(tag, q.Terms)
+		}
+		if score > 0 {
+			hits = append(hits, ProductHit{Product: p, Score: float64(score)})
+		}
+	}
+	slices.SortStableFunc(hits, func(a, b ProductHit) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.ID, b.ID))
+	})
+	return paginate(hits, q.Skip, q.Limit), int64(len(hits)), nil
+}
+
+func (r *memoryProductRepository) FindBySKU(ctx context.Context, sku string) (*model.Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, p := range r.products {
+		if p.SKU == sku && !p.Deleted() {
+			return &p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryProductRepository) ImageUsed(ctx context.Context, file string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, p := range r.products {
+		if p.Image == file || p.ImageIndex(file) >= 0 || slices.ContainsFunc(p.Variants, func(v model.Variant) bool { return v.Image == file }) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryProductRepository) Create(ctx context.Context, p *model.Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.skuTaken(p.SKU, 0) {
+		return ErrConflict
+	}
+	r.lastID++
+	p.ID = r.lastID
+	p.ApplyDefaults()
+	r.products = append(r.products, *p)
+	return nil
+}
+
+func (r *memoryProductRepository) Import(ctx context.Context, products ...*model.Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make(map[int]bool, len(products))
+	skus := make(map[string]bool, len(products))
+	for _, p := range products {
+		// IDs in the trash are taken until the product is purged.
+		if ids[p.ID] || slices.ContainsFunc(r.products, func(other model.Product) bool { return other.ID == p.ID }) ||
+			p.SKU != "" && skus[p.SKU] || r.skuTaken(p.SKU, 0) {
+			return ErrConflict
+		}
+		ids[p.ID], skus[p.SKU] = true, true
+	}
+	for _, p := range products {
+		r.lastID = max(r.lastID, p.ID)
+		p.ApplyDefaults()
+		r.products = append(r.products, *p)
+	}
+	return nil
+}
+
+func (r *memoryProductRepository) Update(ctx context.Context, id int, u ProductUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.find(id)
+	if p == nil {
+		return ErrNotFound
+	}
+	if u.SKU != nil && r.skuTaken(*u.SKU, id) {
+		return ErrConflict
+	}
+	applyProductUpdate(p, u)
+	return nil
+}
+
+// skuTaken reports whether a product other than the one with exceptID, in
+// the trash or not, has the non-empty sku. The caller must hold r.mu.
+func (r *memoryProductRepository) skuTaken(sku string, exceptID int) bool {
+	return sku != "" && slices.ContainsFunc(r.products, func(p model.Product) bool {
+		return p.SKU == sku && p.ID != exceptID
+	})
+}
+
+func applyProductUpdate(p *model.Product, u ProductUpdate) {
+	setIf(&p.SKU, u.SKU)
+	setIf(&p.Name, u.Name)
+	setIf(&p.Price, u.Price)
+	setIf(&p.Prices, u.Prices)
+	setIf(&p.Image, u.Image)
+	setIf(&p.Images, u.Images)
+	setIf(&p.Description, u.Description)
+	setIf(&p.Category, u.Category)
+	setIf(&p.Brand, u.Brand)
+	setIf(&p.Gender, u.Gender)
+	setIf(&p.Sizes, u.Sizes)
+	setIf(&p.Colors, u.Colors)
+	setIf(&p.Material, u.Material)
+	setIf(&p.CareInstructions, u.CareInstructions)
+	setIf(&p.Tags, u.Tags)
+	setIf(&p.InStock, u.InStock)
+}
+
+// setIf copies *value into *dst unless value is nil.
+func setIf[T any](dst *T, value *T) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+func (r *memoryProductRepository) AddVariant(ctx context.Context, productID int, v model.Variant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.find(productID)
+	if p == nil {
+		return ErrNotFound
+	}
+	for _, other := range r.products {
+		if _, ok := other.Variant(v.SKU); ok {
+			return ErrConflict
+		}
+	}
+	if hasVariantIn(p, v, "") {
+		return ErrConflict
+	}
+
+	p.Variants = append(slices.Clone(p.Variants), v)
+	addVariantAttributes(p, v)
+	return nil
+}
+
+func (r *memoryProductRepository) ReplaceVariant(ctx context.Context, productID int, v model.Variant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.find(productID)
+	if p == nil {
+		return ErrNotFound
+	}
+	i := slices.IndexFunc(p.Variants, func(existing model.Variant) bool { return existing.SKU == v.SKU })
+	if i < 0 {
+		return ErrNotFound
+	}
+	if hasVariantIn(p, v, v.SKU) {
+		return ErrConflict
+	}
+
+	p.Variants = slices.Clone(p.Variants)
+	p.Variants[i] = v
+	addVariantAttributes(p, v)
+	return nil
+}
+
+func (r *memoryProductRepository) DeleteVariant(ctx context.Context, productID int, sku string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.find(productID)
+	if p == nil {
+		return ErrNotFound
+	}
+	i := slices.IndexFunc(p.Variants, func(v model.Variant) bool { return v.SKU == sku })
+	if i < 0 {
+		return ErrNotFound
+	}
+	p.Variants = slices.Delete(slices.Clone(p.Variants), i, i+1)
+	return nil
+}
+
+// find returns a pointer to the stored product with id, unless it is in the
+// trash. The caller must hold r.mu.
+func (r *memoryProductRepository) find(id int) *model.Product {
+	for i := range r.products {
+		if r.products[i].ID == id && !r.products[i].Deleted() {
+			return &r.products[i]
+		}
+	}
+	return nil
+}
+
+// hasVariantIn reports whether p has a variant other than the one with
+// skipSKU in the same size and color as v.
+func hasVariantIn(p *model.Product, v model.Variant, skipSKU string) bool {
+	for _, existing := range p.Variants {
+		if existing.SKU != skipSKU && existing.Size == v.Size && existing.Color == v.Color {
+			return true
+		}
+	}
+	return false
+}
+
+func addVariantAttributes(p *model.Product, v model.Variant) {
+	if !slices.Contains(p.Sizes, v.Size) {
+		p.Sizes = append(slices.Clone(p.Sizes), v.Size)
+	}
+	if !slices.Contains(p.Colors, v.Color) {
+		p.Colors = append(slices.Clone(p.Colors), v.Color)
+	}
+}
+
+type memoryUserRepository struct {
+	mu    sync.RWMutex
+	users []model.User
+}
+
+// NewMemoryUserRepository returns a thread-safe UserRepository that keeps
+// users in memory. It is intended for tests and local development.
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{}
+}
+
+func (r *memoryUserRepository) List(ctx context.Context, q UserQuery) (model.Users, error) {
+	users, err := r.matching(q)
+	if err != nil {
+		return nil, err
+	}
+	return listPage(users, q.sortKeys(), userSortKeys, q.Cursor, q.Skip, q.Limit)
+}
+
+func (r *memoryUserRepository) Count(ctx context.Context, q UserQuery) (int64, error) {
+	users, err := r.matching(q)
+	return int64(len(users)), err
+}
+
+func (r *memoryUserRepository) matching(q UserQuery) (model.Users, error) {
+	emailRe, err := compileFilter(regexp.QuoteMeta(q.Email))
+	if err != nil {
+		return nil, err
+	}
+	usernameRe, err := compileFilter(regexp.QuoteMeta(q.Username))
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := model.Users{}
+	for _, u := range r.users {
+		if u.Deleted() {
+			continue
+		}
+		if emailRe != nil && !emailRe.MatchString(u.Email) {
+			continue
+		}
+		if usernameRe != nil && !usernameRe.MatchString(u.Username) {
+			continue
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func (r *memoryUserRepository) FindByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.find(func(u model.User) bool { return strings.EqualFold(u.Email, email) })
+}
+
+func (r *memoryUserRepository) FindByUsername(ctx context.Context, username string) (*model.User, error) {
+	return r.find(func(u model.User) bool { return u.Username == username })
+}
+
+func (r *memoryUserRepository) find(match func(model.User) bool) (*model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if !u.Deleted() && match(u) {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, u *model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if strings.EqualFold(existing.Email, u.Email) && !existing.Deleted() {
+			return ErrConflict
+		}
+	}
+	r.users = append(r.users, *u)
+	return nil
+}
+
+func (r *memoryUserRepository) Update(ctx context.Context, email string, u UserUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.users {
+		if !strings.EqualFold(r.users[i].Email, email) || r.users[i].Deleted() {
+			continue
+		}
+		if u.Username != nil {
+			r.users[i].Username = *u.Username
+		}
+		if u.Password != nil {
+			r.users[i].Password = *u.Password
+		}
+		return nil
+	}
+	return ErrNotFound
+}
+
+func compileFilter(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// listPage sorts items by keys and returns the page that starts after skip
+// items or, when cursor is set, next to the item it points at.
+func listPage[T any](items []T, keys []sorting.Key, known map[string]func(T) any, cursor *pagination.Cursor, skip, limit int) ([]T, error) {
+	slices.SortStableFunc(items, func(a, b T) int {
+		return compareKeys(sortValues(a, keys, known), sortValues(b, keys, known), keys)
+	})
+	if cursor == nil {
+		return paginate(items, skip, limit), nil
+	}
+	values, err := cursorValues(keys, known, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// The items are sorted, so those after the cursor follow one another.
+	start, end := 0, len(items)
+	for i, item := range items {
+		c := compareKeys(sortValues(item, keys, known), values, keys)
+		if cursor.Backward && c >= 0 {
+			end = i
+			break
+		}
+		if !cursor.Backward && c <= 0 {
+			start = i + 1
+		}
+	}
+	items = items[start:end]
+	if cursor.Backward && limit > 0 && len(items) > limit {
+		items = items[len(items)-limit:]
+	}
+	return paginate(items, 0, limit), nil
+}
+
+func compareKeys(a, b []any, keys []sorting.Key) int {
+	for i, k := range keys {
+		if c := compareValues(a[i], b[i]); c != 0 {
+			return c * k.Order
+		}
+	}
+	return 0
+}
+
+// compareValues compares numbers of any type, decimals and strings. Values
+// from a decoded cursor may be int64 where the field is an int.
+func compareValues(a, b any) int {
+	if ad, ok := a.(money.Decimal); ok {
+		if bd, ok := b.(money.Decimal); ok {
+			return ad.Cmp(bd)
+		}
+	}
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			return cmp.Compare(af, bf)
+		}
+	}
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return cmp.Compare(as, bs)
+	}
+	return 0
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func paginate[T any](items []T, skip int, limit int) []T {
+	if skip >= len(items) {
+		return items[:0]
+	}
+	items = items[skip:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"store/model"
+	"store/money"
+	"store/pagination"
+	"store/sorting"
+)
+
+func usd(cents int64) money.Money {
+	return money.Money{Amount: cents, Currency: "USD"}
+}
+
+func TestMemoryProductListFiltersSortsAndPaginates(t *testing.T) {
+	repo := NewMemoryProductRepository()
+	ctx := context.Background()
+	for _, p := range []model.Product{
+		{ID: 1, Name: "Black Jeans", Price: usd(4000)},
+		{ID: 2, Name: "White T-Shirt", Price: usd(1500)},
+		{ID: 3, Name: "Blue Jeans", Price: usd(3500)},
+	} {
+		if err := repo.Create(ctx, &p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	products, err := repo.List(ctx, ProductQuery{Name: "jeans", Sort: sorting.Desc("price"), Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 2 || products[0].ID != 1 || products[1].ID != 3 {
+		t.Errorf("unexpected products %+v", products)
+	}
+
+	products, err = repo.List(ctx, ProductQuery{Sort: sorting.Asc("price"), Skip: 1, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 || products[0].ID != 3 {
+		t.Errorf("unexpected page %+v", products)
+	}
+
+	q := ProductQuery{Sort: sorting.Asc("price"), Limit: 1}
+	cursor, err := pagination.DecodeCursor((&pagination.Cursor{Values: ProductSortValues(products[0], q)}).Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Cursor = cursor
+	products, err = repo.List(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 || products[0].ID != 1 {
+		t.Errorf("expected the product after the cursor's price, got %+v", products)
+	}
+}
+
+func TestMemoryProductUpdateAndDelete(t *testing.T) {
+	repo := NewMemoryProductRepository()
+	ctx := context.Background()
+	if err := repo.Import(ctx, &model.Product{ID: 7, Name: "Jacket", Price: usd(8000)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Import(ctx, &model.Product{ID: 7, Name: "Coat", Price: usd(9000)}); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict on a taken ID, got %v", err)
+	}
+	created := model.Product{ID: 7, Name: "Coat", Price: usd(9000)}
+	if err := repo.Create(ctx, &created); err != nil || created.ID != 8 {
+		t.Errorf("expected Create to allocate ID 8, got %d (%v)", created.ID, err)
+	}
+
+	price := usd(7000)
+	if err := repo.Update(ctx, 7, ProductUpdate{Price: &price}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := repo.FindByID(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Price != usd(7000) || p.Name != "Jacket" {
+		t.Errorf("unexpected product after update %+v", p)
+	}
+
+	if err := repo.Delete(ctx, 7, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.FindByID(ctx, 7); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := repo.Delete(ctx, 7, "admin"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound on second delete, got %v", err)
+	}
+}
+
+func TestMemoryUserEmailIgnoresCase(t *testing.T) {
+	repo := NewMemoryUserRepository()
+	ctx := context.Background()
+	if err := repo.Create(ctx, &model.User{Email: "Shopper@Example.com", Username: "shopper"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if u, err := repo.FindByEmail(ctx, "SHOPPER@example.com"); err != nil || u.Username != "shopper" {
+		t.Errorf("expected the user to be found, got %+v, %v", u, err)
+	}
+	renamed := "buyer"
+	if err := repo.Update(ctx, "shopper@example.COM", UserUpdate{Username: &renamed}); err != nil {
+		t.Errorf("expected update to succeed, got %v", err)
+	}
+	if err := repo.Delete(ctx, "shopper@example.com", "admin"); err != nil {
+		t.Fatalf("expected delete to succeed, got %v", err)
+	}
+	if _, err := repo.FindByUsername(ctx, "buyer"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoryTrash(t *testing.T) {
+	repo := NewMemoryProductRepository()
+	ctx := context.Background()
+	for _, p := range []model.Product{{ID: 1, Name: "Shirt", Price: usd(2000)}, {ID: 2, Name: "Jeans", Price: usd(4000)}} {
+		if err := repo.Import(ctx, &p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Delete(ctx, 1, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := repo.Count(ctx, ProductQuery{}); n != 1 {
+		t.Errorf("expected the deleted product to be left out of the count, got %d", n)
+	}
+	if err := repo.Update(ctx, 1, ProductUpdate{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound updating a deleted product, got %v", err)
+	}
+	if err := repo.Import(ctx, &model.Product{ID: 1, Name: "Other", Price: usd(500)}); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected the ID of a deleted product to stay taken, got %v", err)
+	}
+	trash, total, err := repo.ListDeleted(ctx, TrashQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(trash) != 1 || trash[0].ID != 1 || trash[0].DeletedBy != "admin" {
+		t.Fatalf("unexpected trash %+v (total %d)", trash, total)
+	}
+
+	if err := repo.Restore(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := repo.FindByID(ctx, 1); err != nil || p.Deleted() {
+		t.Fatalf("expected the product to be restored, got %+v, %v", p, err)
+	}
+	if err := repo.Restore(ctx, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound restoring a live product, got %v", err)
+	}
+
+	if err := repo.Delete(ctx, 2, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if purged, _ := repo.Purge(ctx, time.Now().Add(-time.Hour)); len(purged) != 0 {
+		t.Errorf("expected a recent deletion to be kept, purged %v", purged)
+	}
+	if purged, _ := repo.Purge(ctx, time.Now().Add(time.Second)); len(purged) != 1 || purged[0].ID != 2 {
+		t.Errorf("expected product 2 purged, got %v", purged)
+	}
+	if err := repo.Restore(ctx, 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound restoring a purged product, got %v", err)
+	}
+}
+
+func TestMemoryUserRestoreConflict(t *testing.T) {
+	repo := NewMemoryUserRepository()
+	ctx := context.Background()
+	if err := repo.Create(ctx, &model.User{Email: "shopper@example.com", Username: "old"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, "shopper@example.com", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(ctx, &model.User{Email: "Shopper@example.com", Username: "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Restore(ctx, "shopper@example.com"); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict while the email is in use, got %v", err)
+	}
+	if u, err := repo.FindByEmail(ctx, "Shopper@example.com"); err != nil || u.Username != "new" {
+		t.Errorf("expected the new user to be found, got %+v, %v", u, err)
+	}
+	if err := repo.Create(ctx, &model.User{Email: "SHOPPER@example.com", Username: "twin"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict signing up twice with the email, got %v", err)
+	}
+}
+
+func TestMemoryUserFiltersAreLiteral(t *testing.T) {
+	repo := NewMemoryUserRepository()
+	ctx := context.Background()
+	for _, email := range []string{"a.b@example.com", "axb@example.com"} {
+		if err := repo.Create(ctx, &model.User{Email: email, Username: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	users, err := repo.List(ctx, UserQuery{Email: "a.b", Limit: 10})
+	if err != nil || len(users) != 1 || users[0].Email != "a.b@example.com" {
+		t.Errorf("expected only the literal match, got %+v, %v", users, err)
+	}
+	if _, err := repo.List(ctx, UserQuery{Username: "(", Limit: 10}); err != nil {
+		t.Errorf("expected a pattern character to be searched for, got %v", err)
+	}
+}
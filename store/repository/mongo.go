@@ -0,0 +1,748 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	"store/model"
+	"store/money"
+	"store/pagination"
+	"store/sorting"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the indexes the MongoDB repositories rely on and
+// brings the product ID counter up to the highest stored ID, for products
+// stored before IDs were allocated by the server. It is safe to call on
+// every startup.
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("inventory").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "productId", Value: 1}, {Key: "sku", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("create inventory index: %w", err)
+	}
+	_, err = db.Collection("inventoryAdjustments").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "productId", Value: 1}, {Key: "sku", Value: 1}, {Key: "at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("create inventory adjustment index: %w", err)
+	}
+	_, err = db.Collection("categories").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "slug", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("create category index: %w", err)
+	}
+	_, err = db.Collection("exchangeRates").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "currency", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("create exchange rate index: %w", err)
+	}
+	_, err = db.Collection("users").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "deletedAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{
+			// Emails are unique ignoring case among the users outside the
+			// trash, whose deletedAt is null; deleted users differ by it.
+			Keys: bson.D{{Key: "email", Value: 1}, {Key: "deletedAt", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("create user indexes (are user emails unique?): %w", err)
+	}
+	_, err = db.Collection("products").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			// Products without a SKU store none or an empty one.
+			Keys:    bson.D{{Key: "sku", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"sku": bson.M{"$gt": ""}}),
+		},
+		{
+			// Variant SKUs are unique across products, including those in
+			// the trash. Products without variants are left out of the index.
+			Keys:    bson.D{{Key: "variants.sku", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"variants.sku": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.D{{Key: "category", Value: 1}}},
+		{Keys: bson.D{{Key: "deletedAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{
+			Keys: bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}, {Key: "tags", Value: "text"}},
+			Options: options.Index().
+				SetName("product_text").
+				SetWeights(bson.D{{Key: "name", Value: 10}, {Key: "tags", Value: 5}, {Key: "description", Value: 1}}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("create product indexes (are product IDs and variant SKUs unique?): %w", err)
+	}
+
+	var last model.Product
+	err = db.Collection("products").FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "id", Value: -1}})).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("find highest product ID: %w", err)
+	}
+	if err := raiseCounter(ctx, db.Collection("counters"), "products", last.ID); err != nil {
+		return fmt.Errorf("update product ID counter: %w", err)
+	}
+	return nil
+}
+
+// MigratePrices converts the prices of products and variants stored as
+// plain numbers, before prices had a currency, to amounts of currency
+// rounded to its minor unit, and returns how many products it changed. It
+// is safe to call on every startup.
+func MigratePrices(ctx context.Context, db *mongo.Database, currency string) (int64, error) {
+	amount := func(price string) bson.M {
+		return bson.M{"$cond": bson.A{
+			bson.M{"$isNumber": price},
+			bson.M{
+				"amount":   bson.M{"$round": bson.A{bson.M{"$toDecimal": price}, money.Places(currency)}},
+				"currency": currency,
+			},
+			price,
+		}}
+	}
+	isNumber := bson.M{"$type": "number"}
+	result, err := db.Collection("products").UpdateMany(ctx,
+		bson.M{"$or": bson.A{bson.M{"price": isNumber}, bson.M{"variants.price": isNumber}}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"price": amount("$price"),
+			"variants": bson.M{"$map": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$variants", bson.A{}}},
+				"in": bson.M{"$cond": bson.A{
+					bson.M{"$isNumber": "$$this.price"},
+					bson.M{"$mergeObjects": bson.A{"$$this", bson.M{"price": amount("$$this.price")}}},
+					"$$this",
+				}},
+			}},
+		}}}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("migrate product prices: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// nextID atomically increments the named counter in counters and returns
+// its new value, starting from 1.
+func nextID(ctx context.Context, counters *mongo.Collection, name string) (int, error) {
+	var counter struct {
+		Seq int `bson:"seq"`
+	}
+	err := counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	return counter.Seq, err
+}
+
+// raiseCounter makes sure the named counter is at least n, so that nextID
+// does not hand out n or any ID below it.
+func raiseCounter(ctx context.Context, counters *mongo.Collection, name string, n int) error {
+	_, err := counters.UpdateOne(ctx,
+		bson.M{"_id": name},
+		bson.M{"$max": bson.M{"seq": n}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+type mongoProductRepository struct {
+	collection *mongo.Collection
+	counters   *mongo.Collection
+}
+
+// NewMongoProductRepository stores products in the "products" collection of
+// db and allocates their IDs from the "products" counter in "counters".
+func NewMongoProductRepository(db *mongo.Database) ProductRepository {
+	return &mongoProductRepository{collection: db.Collection("products"), counters: db.Collection("counters")}
+}
+
+// productFilter translates the filters of q into a MongoDB query. Products
+// in the trash never match.
+func productFilter(q ProductQuery) bson.M {
+	filter := bson.M{"deletedAt": nil}
+	if q.Name != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(q.Name), "$options": "i"}
+	}
+	if len(q.Categories) > 0 {
+		filter["category"] = bson.M{"$in": q.Categories}
+	}
+	if len(q.Sizes) > 0 {
+		filter["sizes"] = bson.M{"$in": q.Sizes}
+	}
+	if len(q.Colors) > 0 {
+		filter["colors"] = bson.M{"$in": q.Colors}
+	}
+	if len(q.Brands) > 0 {
+		filter["brand"] = bson.M{"$in": q.Brands}
+	}
+	if q.MinPrice != nil || q.MaxPrice != nil {
+		price := bson.M{}
+		if q.MinPrice != nil {
+			price["$gte"] = *q.MinPrice
+		}
+		if q.MaxPrice != nil {
+			price["$lte"] = *q.MaxPrice
+		}
+		filter["price.amount"] = price
+	}
+	if q.InStock != nil {
+		if *q.InStock {
+			filter["inStock"] = true
+		} else {
+			filter["inStock"] = bson.M{"$ne": true}
+		}
+	}
+	return filter
+}
+
+func (r *mongoProductRepository) List(ctx context.Context, q ProductQuery) (model.Products, error) {
+	keys := q.sortKeys()
+	filter, err := pageFilter(productFilter(q), keys, productSortKeys, q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := r.collection.Find(ctx, filter, findOptions(keys, q.Cursor, q.Skip, q.Limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	products := model.Products{}
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	for i := range products {
+		products[i].ApplyDefaults()
+	}
+	if q.Cursor != nil && q.Cursor.Backward {
+		slices.Reverse(products)
+	}
+	return products, nil
+}
+
+func (r *mongoProductRepository) Count(ctx context.Context, q ProductQuery) (int64, error) {
+	return r.collection.CountDocuments(ctx, productFilter(q))
+}
+
+// Facets runs one $facet aggregation in which every dimension is counted
+// over the products matching all filters except its own.
+func (r *mongoProductRepository) Facets(ctx context.Context, q ProductQuery) (*ProductFacets, error) {
+	countBy := func(dimension, field string, unwind bool) bson.A {
+		stages := bson.A{bson.M{"$match": productFilter(q.Without(dimension))}}
+		if unwind {
+			stages = append(stages, bson.M{"$unwind": "$" + field})
+		}
+		return append(stages,
+			bson.M{"$match": bson.M{field: bson.M{"$nin": bson.A{"", nil}}}},
+			bson.M{"$group": bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		)
+	}
+	boundaries := bson.A{}
+	for _, b := range PriceBoundaries {
+		boundaries = append(boundaries, b)
+	}
+	boundaries = append(boundaries, int64(math.MaxInt64))
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: productFilter(ProductQuery{Name: q.Name})}},
+		{{Key: "$facet", Value: bson.M{
+			FacetCategory: countBy(FacetCategory, "category", false),
+			FacetSize:     countBy(FacetSize, "sizes", true),
+			FacetColor:    countBy(FacetColor, "colors", true),
+			FacetBrand:    countBy(FacetBrand, "brand", false),
+			FacetPrice: bson.A{
+				bson.M{"$match": productFilter(q.Without(FacetPrice))},
+				bson.M{"$bucket": bson.M{
+					"groupBy":    "$price.amount",
+					"boundaries": boundaries,
+					"default":    "other",
+					"output":     bson.M{"count": bson.M{"$sum": 1}},
+				}},
+			},
+			FacetInStock: bson.A{
+				bson.M{"$match": productFilter(q.Without(FacetInStock))},
+				bson.M{"$match": bson.M{"inStock": true}},
+				bson.M{"$count": "count"},
+			},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Category []FacetCount `bson:"category"`
+		Size     []FacetCount `bson:"size"`
+		Color    []FacetCount `bson:"color"`
+		Brand    []FacetCount `bson:"brand"`
+		Price    []struct {
+			ID    bson.RawValue `bson:"_id"`
+			Count int           `bson:"count"`
+		} `bson:"price"`
+		InStock []struct {
+			Count int `bson:"count"`
+		} `bson:"inStock"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	facets := &ProductFacets{Categories: []FacetCount{}, Sizes: []FacetCount{}, Colors: []FacetCount{}, Brands: []FacetCount{}, Price: []PriceRange{}}
+	if len(results) == 0 {
+		return facets, nil
+	}
+	res := results[0]
+	facets.Categories = append(facets.Categories, res.Category...)
+	facets.Sizes = append(facets.Sizes, res.Size...)
+	facets.Colors = append(facets.Colors, res.Color...)
+	facets.Brands = append(facets.Brands, res.Brand...)
+	for _, bucket := range res.Price {
+		if min, ok := bucket.ID.AsInt64OK(); ok && bucket.ID.Type != bson.TypeDouble {
+			facets.Price = append(facets.Price, priceRange(min, bucket.Count))
+		}
+	}
+	if len(res.InStock) > 0 {
+		facets.InStock = res.InStock[0].Count
+	}
+	return facets, nil
+}
+
+func (r *mongoProductRepository) FindByID(ctx context.Context, id int) (*model.Product, error) {
+	return r.findOne(ctx, bson.M{"id": id, "deletedAt": nil})
+}
+
+func (r *mongoProductRepository) FindBySKU(ctx context.Context, sku string) (*model.Product, error) {
+	return r.findOne(ctx, bson.M{"sku": sku, "deletedAt": nil})
+}
+
+func (r *mongoProductRepository) ImageUsed(ctx context.Context, file string) (bool, error) {
+	n, err := r.collection.CountDocuments(ctx, bson.M{"$or": bson.A{
+		bson.M{"image": file},
+		bson.M{"images.key": file},
+		bson.M{"variants.image": file},
+	}}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+func (r *mongoProductRepository) Search(ctx context.Context, q SearchQuery) ([]ProductHit, int64, error) {
+	filter := bson.M{"$text": bson.M{"$search": strings.Join(q.Terms, " ")}, "deletedAt": nil}
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "id", Value: 1}}).
+		SetSkip(int64(q.Skip)).
+		SetLimit(int64(q.Limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	hits := []ProductHit{}
+	if err := cursor.All(ctx, &hits); err != nil {
+		return nil, 0, err
+	}
+	for i := range hits {
+		hits[i].ApplyDefaults()
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return hits, total, nil
+}
+
+func (r *mongoProductRepository) findOne(ctx context.Context, filter bson.M) (*model.Product, error) {
+	var product model.Product
+	if err := r.collection.FindOne(ctx, filter).Decode(&product); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	product.ApplyDefaults()
+	return &product, nil
+}
+
+func (r *mongoProductRepository) Create(ctx context.Context, p *model.Product) error {
+	id, err := nextID(ctx, r.counters, "products")
+	if err != nil {
+		return err
+	}
+	p.ID = id
+	return r.insert(ctx, p)
+}
+
+func (r *mongoProductRepository) Import(ctx context.Context, products ...*model.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	// Raising the counter first keeps Create from allocating the IDs while
+	// the products are being inserted.
+	last := 0
+	docs := make([]interface{}, len(products))
+	for i, p := range products {
+		last = max(last, p.ID)
+		p.ApplyDefaults()
+		docs[i] = p
+	}
+	if err := raiseCounter(ctx, r.counters, "products", last); err != nil {
+		return err
+	}
+
+	// The inserts stop at the first conflict, and the products inserted
+	// before it are removed again so that none of them is imported.
+	_, err := r.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(true))
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+		return err
+	}
+	inserted := make([]int, 0, bulkErr.WriteErrors[0].Index)
+	for _, p := range products[:bulkErr.WriteErrors[0].Index] {
+		inserted = append(inserted, p.ID)
+	}
+	if len(inserted) > 0 {
+		if _, delErr := r.collection.DeleteMany(ctx, bson.M{"id": bson.M{"$in": inserted}}); delErr != nil {
+			return fmt.Errorf("remove the products of a failed import: %w", delErr)
+		}
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *mongoProductRepository) insert(ctx context.Context, p *model.Product) error {
+	p.ApplyDefaults()
+	_, err := r.collection.InsertOne(ctx, p)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *mongoProductRepository) Update(ctx context.Context, id int, u ProductUpdate) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"id": id, "deletedAt": nil}, bson.M{"$set": productUpdateSet(u)})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// productUpdateSet builds the $set document for the non-nil fields of u.
+func productUpdateSet(u ProductUpdate) bson.M {
+	set := bson.M{}
+	if u.SKU != nil {
+		set["sku"] = *u.SKU
+	}
+	if u.Name != nil {
+		set["name"] = *u.Name
+	}
+	if u.Price != nil {
+		set["price"] = *u.Price
+	}
+	if u.Prices != nil {
+		set["prices"] = *u.Prices
+	}
+	if u.Image != nil {
+		set["image"] = *u.Image
+	}
+	if u.Images != nil {
+		set["images"] = *u.Images
+	}
+	if u.Description != nil {
+		set["description"] = *u.Description
+	}
+	if u.Category != nil {
+		set["category"] = *u.Category
+	}
+	if u.Brand != nil {
+		set["brand"] = *u.Brand
+	}
+	if u.Gender != nil {
+		set["gender"] = *u.Gender
+	}
+	if u.Sizes != nil {
+		set["sizes"] = *u.Sizes
+	}
+	if u.Colors != nil {
+		set["colors"] = *u.Colors
+	}
+	if u.Material != nil {
+		set["material"] = *u.Material
+	}
+	if u.CareInstructions != nil {
+		set["careInstructions"] = *u.CareInstructions
+	}
+	if u.Tags != nil {
+		set["tags"] = *u.Tags
+	}
+	if u.InStock != nil {
+		set["inStock"] = *u.InStock
+	}
+	return set
+}
+
+func (r *mongoProductRepository) AddVariant(ctx context.Context, productID int, v model.Variant) error {
+	// The SKU and size/color checks and the push happen in one conditional
+	// update so that concurrent requests cannot add the same variant twice
+	// to a product; the unique index on variants.sku keeps other products
+	// from taking the SKU at the same time.
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"id":           productID,
+		"deletedAt":    nil,
+		"variants.sku": bson.M{"$ne": v.SKU},
+		"variants":     bson.M{"$not": bson.M{"$elemMatch": bson.M{"size": v.Size, "color": v.Color}}},
+	}, bson.M{
+		"$push":     bson.M{"variants": v},
+		"$addToSet": bson.M{"sizes": v.Size, "colors": v.Color},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return r.variantWriteMiss(ctx, productID, "")
+	}
+	return nil
+}
+
+func (r *mongoProductRepository) ReplaceVariant(ctx context.Context, productID int, v model.Variant) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{
+		"id":           productID,
+		"deletedAt":    nil,
+		"variants.sku": v.SKU,
+		"variants": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+			"sku": bson.M{"$ne": v.SKU}, "size": v.Size, "color": v.Color,
+		}}},
+	}, bson.M{
+		"$set":      bson.M{"variants.$[v]": v},
+		"$addToSet": bson.M{"sizes": v.Size, "colors": v.Color},
+	}, options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"v.sku": v.SKU}},
+	}))
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return r.variantWriteMiss(ctx, productID, v.SKU)
+	}
+	return nil
+}
+
+func (r *mongoProductRepository) DeleteVariant(ctx context.Context, productID int, sku string) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"id": productID, "deletedAt": nil, "variants.sku": sku},
+		bson.M{"$pull": bson.M{"variants": bson.M{"sku": sku}}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// variantWriteMiss explains why a conditional variant update matched no
+// product: the product or the variant with sku does not exist, or the write
+// would have duplicated a size and color.
+func (r *mongoProductRepository) variantWriteMiss(ctx context.Context, productID int, sku string) error {
+	product, err := r.FindByID(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if _, ok := product.Variant(sku); sku != "" && !ok {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
+
+type mongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoUserRepository stores users in the "users" collection of db.
+func NewMongoUserRepository(db *mongo.Database) UserRepository {
+	return &mongoUserRepository{collection: db.Collection("users")}
+}
+
+// userFilter translates the filters of q into a MongoDB query. Users in the
+// trash never match.
+func userFilter(q UserQuery) bson.M {
+	filter := bson.M{"deletedAt": nil}
+	if q.Email != "" {
+		filter["email"] = bson.M{"$regex": regexp.QuoteMeta(q.Email), "$options": "i"}
+	}
+	if q.Username != "" {
+		filter["username"] = bson.M{"$regex": regexp.QuoteMeta(q.Username), "$options": "i"}
+	}
+	return filter
+}
+
+func (r *mongoUserRepository) List(ctx context.Context, q UserQuery) (model.Users, error) {
+	keys := q.sortKeys()
+	filter, err := pageFilter(userFilter(q), keys, userSortKeys, q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := r.collection.Find(ctx, filter, findOptions(keys, q.Cursor, q.Skip, q.Limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := model.Users{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	if q.Cursor != nil && q.Cursor.Backward {
+		slices.Reverse(users)
+	}
+	return users, nil
+}
+
+func (r *mongoUserRepository) Count(ctx context.Context, q UserQuery) (int64, error) {
+	return r.collection.CountDocuments(ctx, userFilter(q))
+}
+
+func (r *mongoUserRepository) FindByEmail(ctx context.Context, email string) (*model.User, error) {
+	filter := emailFilter(email)
+	filter["deletedAt"] = nil
+	return r.findOne(ctx, filter)
+}
+
+func (r *mongoUserRepository) FindByUsername(ctx context.Context, username string) (*model.User, error) {
+	return r.findOne(ctx, bson.M{"username": username, "deletedAt": nil})
+}
+
+func (r *mongoUserRepository) findOne(ctx context.Context, filter bson.M) (*model.User, error) {
+	var user model.User
+	if err := r.collection.FindOne(ctx, filter).Decode(&user); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *mongoUserRepository) Create(ctx context.Context, u *model.User) error {
+	_, err := r.collection.InsertOne(ctx, u)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *mongoUserRepository) Update(ctx context.Context, email string, u UserUpdate) error {
+	set := bson.M{}
+	if u.Username != nil {
+		set["username"] = *u.Username
+	}
+	if u.Password != nil {
+		set["password"] = *u.Password
+	}
+
+	filter := emailFilter(email)
+	filter["deletedAt"] = nil
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// pageFilter narrows filter to the items after, or before, the cursor in
+// the order of keys. Without a cursor it returns filter unchanged.
+func pageFilter[T any](filter bson.M, keys []sorting.Key, known map[string]func(T) any, cursor *pagination.Cursor) (bson.M, error) {
+	if cursor == nil {
+		return filter, nil
+	}
+	values, err := cursorValues(keys, known, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// (k1 > v1) or (k1 = v1 and k2 > v2) or ..., with < for descending keys
+	// and the comparisons flipped when paging backward.
+	or := bson.A{}
+	for i, k := range keys {
+		cond := bson.M{}
+		for j := 0; j < i; j++ {
+			cond[sortPath(keys[j].Field)] = values[j]
+		}
+		op := "$gt"
+		if (k.Order < 0) != cursor.Backward {
+			op = "$lt"
+		}
+		cond[sortPath(k.Field)] = bson.M{op: values[i]}
+		or = append(or, cond)
+	}
+	return bson.M{"$and": bson.A{filter, bson.M{"$or": or}}}, nil
+}
+
+// sortPath returns the path of the stored value of a sort field. Prices
+// are sorted by their amount, which is in the currency of the store.
+func sortPath(field string) string {
+	if field == "price" {
+		return "price.amount"
+	}
+	return field
+}
+
+// findOptions sorts by keys, reversed when paging backward from a cursor,
+// and applies skip and limit.
+func findOptions(keys []sorting.Key, cursor *pagination.Cursor, skip int, limit int) *options.FindOptions {
+	backward := cursor != nil && cursor.Backward
+	sort := bson.D{}
+	for _, k := range keys {
+		order := k.Order
+		if backward {
+			order = -order
+		}
+		sort = append(sort, bson.E{Key: sortPath(k.Field), Value: order})
+	}
+	opts := options.Find().SetSort(sort)
+	if skip > 0 {
+		opts.SetSkip(int64(skip))
+	}
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	return opts
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"store/model"
+)
+
+type memoryExchangeRateRepository struct {
+	mu    sync.RWMutex
+	rates map[string]model.ExchangeRate
+}
+
+// NewMemoryExchangeRateRepository returns a thread-safe
+// ExchangeRateRepository that keeps rates in memory. It is intended for
+// tests and local development.
+func NewMemoryExchangeRateRepository() ExchangeRateRepository {
+	return &memoryExchangeRateRepository{rates: map[string]model.ExchangeRate{}}
+}
+
+func (r *memoryExchangeRateRepository) List(ctx context.Context) ([]model.ExchangeRate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rates := []model.ExchangeRate{}
+	for _, rate := range r.rates {
+		rates = append(rates, rate)
+	}
+	slices.SortFunc(rates, func(a, b model.ExchangeRate) int { return cmp.Compare(a.Currency, b.Currency) })
+	return rates, nil
+}
+
+func (r *memoryExchangeRateRepository) Get(ctx context.Context, currency string) (*model.ExchangeRate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rate, ok := r.rates[currency]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &rate, nil
+}
+
+func (r *memoryExchangeRateRepository) Set(ctx context.Context, rate model.ExchangeRate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rates[rate.Currency] = rate
+	return nil
+}
+
+func (r *memoryExchangeRateRepository) Delete(ctx context.Context, currency string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.rates[currency]; !ok {
+		return ErrNotFound
+	}
+	delete(r.rates, currency)
+	return nil
+}
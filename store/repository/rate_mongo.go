@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"store/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoExchangeRateRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoExchangeRateRepository stores exchange rates in the
+// "exchangeRates" collection of db.
+func NewMongoExchangeRateRepository(db *mongo.Database) ExchangeRateRepository {
+	return &mongoExchangeRateRepository{collection: db.Collection("exchangeRates")}
+}
+
+func (r *mongoExchangeRateRepository) List(ctx context.Context) ([]model.ExchangeRate, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "currency", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rates := []model.ExchangeRate{}
+	if err := cursor.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+func (r *mongoExchangeRateRepository) Get(ctx context.Context, currency string) (*model.ExchangeRate, error) {
+	var rate model.ExchangeRate
+	if err := r.collection.FindOne(ctx, bson.M{"currency": currency}).Decode(&rate); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &rate, nil
+}
+
+func (r *mongoExchangeRateRepository) Set(ctx context.Context, rate model.ExchangeRate) error {
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"currency": rate.Currency}, rate, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *mongoExchangeRateRepository) Delete(ctx context.Context, currency string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"currency": currency})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
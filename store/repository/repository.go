@@ -0,0 +1,441 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"store/model"
+	"store/money"
+	"store/pagination"
+	"store/sorting"
+)
+
+var (
+	// ErrNotFound is returned when no document matches a lookup, update or
+	// delete.
+	ErrNotFound = errors.New("repository: not found")
+	// ErrConflict is returned when a write would break a uniqueness rule.
+	ErrConflict = errors.New("repository: conflict")
+	// ErrInsufficientStock is returned when a stock change would make the
+	// available or reserved count negative.
+	ErrInsufficientStock = errors.New("repository: insufficient stock")
+)
+
+// ProductQuery describes a filtered, sorted and paginated product listing.
+type ProductQuery struct {
+	// Name is matched case-insensitively as a literal substring of the
+	// product name. An empty value matches every product.
+	Name string
+	// Categories limits the listing to products in one of these category
+	// slugs. An empty list matches every product.
+	Categories []string
+	// Sizes, Colors and Brands each match products with any of the given
+	// values. An empty list matches every product.
+	Sizes  []string
+	Colors []string
+	Brands []string
+	// MinPrice and MaxPrice bound the price, in the currency of the store,
+	// inclusively when set.
+	MinPrice *money.Decimal
+	MaxPrice *money.Decimal
+	// InStock, when set, matches products that are or are not in stock.
+	InStock *bool
+
+	// Sort orders the listing by these fields, then by ID. Fields that
+	// are not in ProductSortFields are ignored.
+	Sort  []sorting.Key
+	Skip  int
+	Limit int
+	// Cursor, when set, replaces Skip: the listing continues after, or
+	// before, the item whose sort values it holds.
+	Cursor *pagination.Cursor
+}
+
+// Facet dimensions, as passed to ProductQuery.Without.
+const (
+	FacetCategory = "category"
+	FacetSize     = "size"
+	FacetColor    = "color"
+	FacetBrand    = "brand"
+	FacetPrice    = "price"
+	FacetInStock  = "inStock"
+)
+
+// PriceBoundaries are the lower bounds, in whole units of the currency of
+// the store, of the price ranges counted by Facets. The last range has no
+// upper bound.
+var PriceBoundaries = []int64{0, 25, 50, 100, 200}
+
+// Without returns a copy of q without the filter of one facet dimension.
+// The counts of a dimension are taken without its own filter, so that
+// choosing one size still shows how many products come in the other sizes.
+func (q ProductQuery) Without(dimension string) ProductQuery {
+	switch dimension {
+	case FacetCategory:
+		q.Categories = nil
+	case FacetSize:
+		q.Sizes = nil
+	case FacetColor:
+		q.Colors = nil
+	case FacetBrand:
+		q.Brands = nil
+	case FacetPrice:
+		q.MinPrice, q.MaxPrice = nil, nil
+	case FacetInStock:
+		q.InStock = nil
+	}
+	return q
+}
+
+// FacetCount is how many products have one value of a facet dimension.
+type FacetCount struct {
+	Value string `json:"value" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// PriceRange is how many products cost at least Min and less than Max. Max
+// is nil for the last range.
+type PriceRange struct {
+	Min   int64  `json:"min"`
+	Max   *int64 `json:"max,omitempty"`
+	Count int    `json:"count"`
+}
+
+// priceRange returns the range of PriceBoundaries that starts at min.
+func priceRange(min int64, count int) PriceRange {
+	r := PriceRange{Min: min, Count: count}
+	for i, b := range PriceBoundaries {
+		if b == min && i+1 < len(PriceBoundaries) {
+			max := PriceBoundaries[i+1]
+			r.Max = &max
+		}
+	}
+	return r
+}
+
+// ProductFacets counts the products of a listing per value of each facet
+// dimension, most common values first. Values without products are left out.
+type ProductFacets struct {
+	Categories []FacetCount `json:"category"`
+	Sizes      []FacetCount `json:"size"`
+	Colors     []FacetCount `json:"color"`
+	Brands     []FacetCount `json:"brand"`
+	Price      []PriceRange `json:"price"`
+	InStock    int          `json:"inStock"`
+}
+
+// SearchQuery is a full-text product search. Terms are words of letters and
+// digits, as produced by search.Terms; a product matches if its name,
+// description or tags contain any of them.
+type SearchQuery struct {
+	Terms []string
+	Skip  int
+	Limit int
+}
+
+// ProductHit is a product found by a search, with its relevance score. Higher
+// scores are better matches.
+type ProductHit struct {
+	model.Product `bson:",inline"`
+	Score         float64 `json:"score" bson:"score"`
+}
+
+// productSortKeys maps the sortable product fields to their values.
+var productSortKeys = map[string]func(model.Product) any{
+	"id":       func(p model.Product) any { return p.ID },
+	"name":     func(p model.Product) any { return p.Name },
+	"price":    func(p model.Product) any { return p.Price.Decimal() },
+	"category": func(p model.Product) any { return p.Category },
+	"brand":    func(p model.Product) any { return p.Brand },
+	"gender":   func(p model.Product) any { return string(p.Gender) },
+}
+
+var userSortKeys = map[string]func(model.User) any{
+	"email":    func(u model.User) any { return u.Email },
+	"username": func(u model.User) any { return u.Username },
+}
+
+var (
+	// ProductSortFields lists the fields products can be sorted by.
+	ProductSortFields = sortFields(productSortKeys)
+	// UserSortFields lists the fields users can be sorted by.
+	UserSortFields = sortFields(userSortKeys)
+)
+
+func sortFields[T any](known map[string]func(T) any) []string {
+	fields := make([]string, 0, len(known))
+	for f := range known {
+		fields = append(fields, f)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// sortKeys returns the sort order of a listing: the known fields of sort,
+// followed by the unique tiebreak field unless sort already holds it.
+// Keyset paging needs the order to be total, and fields after the tiebreak
+// would never be compared, so they are dropped.
+func sortKeys[T any](sort []sorting.Key, known map[string]func(T) any, tiebreak string) []sorting.Key {
+	var keys []sorting.Key
+	for _, k := range sort {
+		if _, ok := known[k.Field]; !ok {
+			continue
+		}
+		keys = append(keys, k)
+		if k.Field == tiebreak {
+			return keys
+		}
+	}
+	return append(keys, sorting.Key{Field: tiebreak, Order: 1})
+}
+
+func (q ProductQuery) sortKeys() []sorting.Key {
+	return sortKeys(q.Sort, productSortKeys, "id")
+}
+
+func (q UserQuery) sortKeys() []sorting.Key {
+	return sortKeys(q.Sort, userSortKeys, "email")
+}
+
+// sortValues returns the values of item for keys.
+func sortValues[T any](item T, keys []sorting.Key, known map[string]func(T) any) []any {
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		values[i] = known[k.Field](item)
+	}
+	return values
+}
+
+// cursorValues checks that cursor was made for keys and returns its sort
+// values. Cursors start with the sort order, such as "-price,id", so that a
+// cursor is not applied to a listing sorted differently. Decimals, which
+// cursors hold as strings, are parsed back for the fields of known that
+// have them.
+func cursorValues[T any](keys []sorting.Key, known map[string]func(T) any, cursor *pagination.Cursor) ([]any, error) {
+	if len(cursor.Values) != len(keys)+1 || cursor.Values[0] != sorting.String(keys) {
+		return nil, pagination.ErrInvalidCursor
+	}
+	var zero T
+	values := slices.Clone(cursor.Values[1:])
+	for i, k := range keys {
+		if _, ok := known[k.Field](zero).(money.Decimal); !ok {
+			continue
+		}
+		s, _ := values[i].(string)
+		d, err := money.ParseDecimal(s)
+		if err != nil {
+			return nil, pagination.ErrInvalidCursor
+		}
+		values[i] = d
+	}
+	return values, nil
+}
+
+// ProductSortValues returns the cursor values of p in the sort order of q.
+func ProductSortValues(p model.Product, q ProductQuery) []any {
+	keys := q.sortKeys()
+	return append([]any{sorting.String(keys)}, sortValues(p, keys, productSortKeys)...)
+}
+
+// UserSortValues returns the cursor values of u in the sort order of q.
+func UserSortValues(u model.User, q UserQuery) []any {
+	keys := q.sortKeys()
+	return append([]any{sorting.String(keys)}, sortValues(u, keys, userSortKeys)...)
+}
+
+// ProductUpdate holds the fields to change on a product. Nil fields are left
+// untouched.
+type ProductUpdate struct {
+	SKU              *string
+	Name             *string
+	Price            *money.Money
+	Prices           *[]money.Money
+	Image            *string
+	Images           *[]model.Image
+	Description      *string
+	Category         *string
+	Brand            *string
+	Gender           *model.Gender
+	Sizes            *[]string
+	Colors           *[]string
+	Material         *string
+	CareInstructions *string
+	Tags             *[]string
+	InStock          *bool
+}
+
+type ProductRepository interface {
+	// List returns a page of the products matching q. It returns
+	// pagination.ErrInvalidCursor if q.Cursor does not fit the sort order.
+	List(ctx context.Context, q ProductQuery) (model.Products, error)
+	// Count returns how many products match q, ignoring its paging.
+	Count(ctx context.Context, q ProductQuery) (int64, error)
+	// Facets counts the products matching q, ignoring its pagination and
+	// sorting, per value of each facet dimension.
+	Facets(ctx context.Context, q ProductQuery) (*ProductFacets, error)
+	FindByID(ctx context.Context, id int) (*model.Product, error)
+	// FindBySKU returns the product with the given product-level SKU. It
+	// does not match the SKUs of variants.
+	FindBySKU(ctx context.Context, sku string) (*model.Product, error)
+	// Search returns the products matching q, best matches first, and the
+	// total number of matches.
+	Search(ctx context.Context, q SearchQuery) ([]ProductHit, int64, error)
+	// Create stores p under a newly allocated ID, which it sets on p. It
+	// returns ErrConflict if another product has the SKU of p.
+	Create(ctx context.Context, p *model.Product) error
+	// Import stores products under the IDs they already have, for moving
+	// products between stores. The products are stored together or not at
+	// all: if any ID or SKU is taken, including by a product in the trash,
+	// it returns ErrConflict and stores none of them. Later IDs allocated by
+	// Create are higher than every imported one.
+	Import(ctx context.Context, products ...*model.Product) error
+	// Update returns ErrConflict if u sets a SKU that another product has.
+	Update(ctx context.Context, id int, u ProductUpdate) error
+	// ImageUsed reports whether any product, in the trash or not, uses the
+	// image file as its image, in its gallery or for one of its variants.
+	ImageUsed(ctx context.Context, file string) (bool, error)
+	// Delete moves the product to the trash, recording who deleted it.
+	// Products in the trash are left out of every method except ListDeleted,
+	// Restore and Purge, but keep their ID and SKUs until they are purged.
+	Delete(ctx context.Context, id int, by string) error
+	// ListDeleted returns a page of the products in the trash, most recently
+	// deleted first, and how many there are.
+	ListDeleted(ctx context.Context, q TrashQuery) (model.Products, int64, error)
+	// Restore takes the product out of the trash. It returns ErrNotFound if
+	// the product is not in the trash.
+	Restore(ctx context.Context, id int) error
+	// Purge permanently removes the products deleted before cutoff and
+	// returns them, so that what they leave behind can be removed too. On an
+	// error, the products already removed are returned with it.
+	Purge(ctx context.Context, cutoff time.Time) (model.Products, error)
+
+	// AddVariant appends v to the product's variants and adds its size and
+	// color to the product's lists. It returns ErrConflict if the SKU is
+	// used by any product or the product already has a variant in the same
+	// size and color.
+	AddVariant(ctx context.Context, productID int, v model.Variant) error
+	// ReplaceVariant replaces the variant with v.SKU. It returns ErrConflict
+	// if another variant of the product has the same size and color.
+	ReplaceVariant(ctx context.Context, productID int, v model.Variant) error
+	DeleteVariant(ctx context.Context, productID int, sku string) error
+}
+
+// CategoryUpdate holds the fields to change on a category. Nil fields are
+// left untouched.
+type CategoryUpdate struct {
+	Name     *string
+	Parent   *string
+	Position *int
+}
+
+// CategoryRepository stores the category tree. Categories are identified by
+// their slug, which cannot be changed once created.
+type CategoryRepository interface {
+	List(ctx context.Context) (model.Categories, error)
+	FindBySlug(ctx context.Context, slug string) (*model.Category, error)
+	// Create returns ErrConflict if the slug is already taken.
+	Create(ctx context.Context, c *model.Category) error
+	Update(ctx context.Context, slug string, u CategoryUpdate) error
+	Delete(ctx context.Context, slug string) error
+}
+
+// ExchangeRateRepository stores the exchange rates from the currency of the
+// store, at most one per currency.
+type ExchangeRateRepository interface {
+	// List returns the rates ordered by currency.
+	List(ctx context.Context) ([]model.ExchangeRate, error)
+	Get(ctx context.Context, currency string) (*model.ExchangeRate, error)
+	// Set creates the rate of r.Currency or replaces it.
+	Set(ctx context.Context, r model.ExchangeRate) error
+	Delete(ctx context.Context, currency string) error
+}
+
+// UserQuery describes a filtered, sorted and paginated user listing. Email and
+// Username match users whose email or username contains them, ignoring case.
+type UserQuery struct {
+	Email    string
+	Username string
+	// Sort orders the listing by these fields, then by email, as in
+	// ProductQuery.
+	Sort  []sorting.Key
+	Skip  int
+	Limit int
+	// Cursor, when set, replaces Skip as in ProductQuery.
+	Cursor *pagination.Cursor
+}
+
+// UserUpdate holds the fields to change on a user. Nil fields are left
+// untouched.
+type UserUpdate struct {
+	Username *string
+	Password *string
+}
+
+// UserRepository keeps users, which are identified by their email. Every
+// method that takes an email matches it exactly but ignoring case, like the
+// uniqueness Create enforces.
+type UserRepository interface {
+	List(ctx context.Context, q UserQuery) (model.Users, error)
+	Count(ctx context.Context, q UserQuery) (int64, error)
+	FindByEmail(ctx context.Context, email string) (*model.User, error)
+	FindByUsername(ctx context.Context, username string) (*model.User, error)
+	// Create returns ErrConflict if another user outside the trash has the
+	// email of u, ignoring case.
+	Create(ctx context.Context, u *model.User) error
+	Update(ctx context.Context, email string, u UserUpdate) error
+	// Delete moves the user whose email equals email, ignoring case, to the
+	// trash, recording who deleted it. Users in the trash are left out of
+	// every method except ListDeleted, Restore and Purge.
+	Delete(ctx context.Context, email, by string) error
+	// ListDeleted returns a page of the users in the trash, most recently
+	// deleted first, and how many there are.
+	ListDeleted(ctx context.Context, q TrashQuery) (model.Users, int64, error)
+	// Restore takes the user whose email equals email, ignoring case, out
+	// of the trash. It returns ErrNotFound if there is no such user in the
+	// trash and ErrConflict if another user has signed up with the email
+	// meanwhile.
+	Restore(ctx context.Context, email string) error
+	// Purge permanently removes the users deleted before cutoff and returns
+	// how many there were.
+	Purge(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// TrashQuery describes a page of a trash listing.
+type TrashQuery struct {
+	Skip  int
+	Limit int
+}
+
+// InventoryRepository keeps stock levels keyed by product ID and SKU, where
+// an empty SKU is the stock of a product without variants. Every change is a
+// single conditional update that either applies completely or fails with
+// ErrInsufficientStock, and returns the resulting level.
+type InventoryRepository interface {
+	Levels(ctx context.Context, productID int) ([]model.StockLevel, error)
+	// LevelsOf returns the stock levels of several products at once, for
+	// listings.
+	LevelsOf(ctx context.Context, productIDs []int) ([]model.StockLevel, error)
+	// Reserve moves quantity from available to reserved.
+	Reserve(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error)
+	// Release moves quantity from reserved back to available.
+	Release(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error)
+	// Commit removes quantity from reserved and on-hand once it has been
+	// sold.
+	Commit(ctx context.Context, productID int, sku string, quantity int) (*model.StockLevel, error)
+	// Adjust adds delta, which may be negative, to on-hand and available,
+	// creating the stock level if it does not exist yet.
+	Adjust(ctx context.Context, productID int, sku string, delta int) (*model.StockLevel, error)
+
+	AddAdjustment(ctx context.Context, a model.StockAdjustment) error
+	// Adjustments returns the adjustments of a product, or of one of its
+	// SKUs when sku is not empty, newest first.
+	Adjustments(ctx context.Context, productID int, sku string) ([]model.StockAdjustment, error)
+	// DeleteLevel removes the stock level of a SKU that is no longer sold,
+	// such as a deleted variant. Its adjustments are kept as history.
+	DeleteLevel(ctx context.Context, productID int, sku string) error
+	// DeleteProduct removes the stock levels and adjustments of a product
+	// that no longer exists.
+	DeleteProduct(ctx context.Context, productID int) error
+}
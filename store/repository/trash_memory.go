@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"store/model"
+)
+
+func (r *memoryProductRepository) Delete(ctx context.Context, id int, by string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.find(id)
+	if p == nil {
+		return ErrNotFound
+	}
+	p.Deletion = newDeletion(by)
+	return nil
+}
+
+func (r *memoryProductRepository) ListDeleted(ctx context.Context, q TrashQuery) (model.Products, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	products := deleted(r.products, func(p model.Product) model.Deletion { return p.Deletion })
+	slices.SortStableFunc(products, func(a, b model.Product) int {
+		return cmp.Or(b.DeletedAt.Compare(*a.DeletedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return paginate(products, q.Skip, q.Limit), int64(len(products)), nil
+}
+
+func (r *memoryProductRepository) Restore(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.products {
+		if r.products[i].ID == id && r.products[i].Deleted() {
+			r.products[i].Deletion = model.Deletion{}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryProductRepository) Purge(ctx context.Context, cutoff time.Time) (model.Products, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged model.Products
+	r.products, purged = purgeBefore(r.products, cutoff, func(p model.Product) model.Deletion { return p.Deletion })
+	return purged, nil
+}
+
+func (r *memoryUserRepository) Delete(ctx context.Context, email, by string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.users {
+		if strings.EqualFold(r.users[i].Email, email) && !r.users[i].Deleted() {
+			r.users[i].Deletion = newDeletion(by)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryUserRepository) ListDeleted(ctx context.Context, q TrashQuery) (model.Users, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := deleted(r.users, func(u model.User) model.Deletion { return u.Deletion })
+	slices.SortStableFunc(users, func(a, b model.User) int {
+		return cmp.Or(b.DeletedAt.Compare(*a.DeletedAt), cmp.Compare(a.Email, b.Email))
+	})
+	return paginate(users, q.Skip, q.Limit), int64(len(users)), nil
+}
+
+func (r *memoryUserRepository) Restore(ctx context.Context, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if strings.EqualFold(u.Email, email) && !u.Deleted() {
+			return ErrConflict
+		}
+	}
+	for i := range r.users {
+		if strings.EqualFold(r.users[i].Email, email) && r.users[i].Deleted() {
+			r.users[i].Deletion = model.Deletion{}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryUserRepository) Purge(ctx context.Context, cutoff time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged []model.User
+	r.users, purged = purgeBefore(r.users, cutoff, func(u model.User) model.Deletion { return u.Deletion })
+	return int64(len(purged)), nil
+}
+
+func newDeletion(by string) model.Deletion {
+	now := time.Now().UTC()
+	return model.Deletion{DeletedAt: &now, DeletedBy: by}
+}
+
+// deleted returns copies of the items in the trash.
+func deleted[T any](items []T, deletion func(T) model.Deletion) []T {
+	trash := []T{}
+	for _, item := range items {
+		if deletion(item).Deleted() {
+			trash = append(trash, item)
+		}
+	}
+	return trash
+}
+
+// purgeBefore removes the items deleted before cutoff and returns them.
+func purgeBefore[T any](items []T, cutoff time.Time, deletion func(T) model.Deletion) (kept, purged []T) {
+	expired := func(item T) bool {
+		d := deletion(item)
+		return d.Deleted() && d.DeletedAt.Before(cutoff)
+	}
+	for _, item := range items {
+		if expired(item) {
+			purged = append(purged, item)
+		}
+	}
+	return slices.DeleteFunc(items, expired), purged
+}
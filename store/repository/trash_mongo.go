@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"store/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// inTrash matches the documents that were deleted.
+func inTrash() bson.M {
+	return bson.M{"deletedAt": bson.M{"$ne": nil}}
+}
+
+// moveToTrash marks the document matching filter as deleted by by. It
+// returns ErrNotFound if there is no such document outside the trash.
+func moveToTrash(ctx context.Context, collection *mongo.Collection, filter bson.M, by string) error {
+	filter["deletedAt"] = nil
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+		"deletedAt": time.Now().UTC(),
+		"deletedBy": by,
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// restoreFromTrash clears the deletion of the document matching filter. It
+// returns ErrNotFound if there is no such document in the trash.
+func restoreFromTrash(ctx context.Context, collection *mongo.Collection, filter bson.M) error {
+	filter["deletedAt"] = bson.M{"$ne": nil}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{"deletedAt": "", "deletedBy": ""}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// listDeleted returns a page of the documents in the trash of collection,
+// most recently deleted first and then ordered by the unique tiebreak field,
+// and how many there are.
+func listDeleted[T any](ctx context.Context, collection *mongo.Collection, q TrashQuery, tiebreak string) ([]T, int64, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "deletedAt", Value: -1}, {Key: tiebreak, Value: 1}}).
+		SetSkip(int64(q.Skip)).
+		SetLimit(int64(q.Limit))
+	cursor, err := collection.Find(ctx, inTrash(), opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	items := []T{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, 0, err
+	}
+	total, err := collection.CountDocuments(ctx, inTrash())
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// purge removes the documents of collection deleted before cutoff.
+func purge(ctx context.Context, collection *mongo.Collection, cutoff time.Time) (int64, error) {
+	result, err := collection.DeleteMany(ctx, bson.M{"deletedAt": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *mongoProductRepository) Delete(ctx context.Context, id int, by string) error {
+	return moveToTrash(ctx, r.collection, bson.M{"id": id}, by)
+}
+
+func (r *mongoProductRepository) ListDeleted(ctx context.Context, q TrashQuery) (model.Products, int64, error) {
+	products, total, err := listDeleted[model.Product](ctx, r.collection, q, "id")
+	for i := range products {
+		products[i].ApplyDefaults()
+	}
+	return products, total, err
+}
+
+func (r *mongoProductRepository) Restore(ctx context.Context, id int) error {
+	return restoreFromTrash(ctx, r.collection, bson.M{"id": id})
+}
+
+// Purge removes the expired products one at a time, each only if it is
+// still in the trash, so that a product restored meanwhile is neither
+// removed nor returned.
+func (r *mongoProductRepository) Purge(ctx context.Context, cutoff time.Time) (model.Products, error) {
+	expired := bson.M{"deletedAt": bson.M{"$lt": cutoff}}
+	cursor, err := r.collection.Find(ctx, expired, options.Find().SetProjection(bson.M{"id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var candidates []struct {
+		ID int `bson:"id"`
+	}
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+
+	purged := model.Products{}
+	for _, c := range candidates {
+		var p model.Product
+		err := r.collection.FindOneAndDelete(ctx, bson.M{"id": c.ID, "deletedAt": bson.M{"$lt": cutoff}}).Decode(&p)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged = append(purged, p)
+	}
+	return purged, nil
+}
+
+// emailFilter matches email exactly but ignoring case.
+func emailFilter(email string) bson.M {
+	return bson.M{"email": bson.M{"$regex": "^" + regexp.QuoteMeta(email) + "$", "$options": "i"}}
+}
+
+func (r *mongoUserRepository) Delete(ctx context.Context, email, by string) error {
+	return moveToTrash(ctx, r.collection, emailFilter(email), by)
+}
+
+func (r *mongoUserRepository) ListDeleted(ctx context.Context, q TrashQuery) (model.Users, int64, error) {
+	return listDeleted[model.User](ctx, r.collection, q, "email")
+}
+
+func (r *mongoUserRepository) Restore(ctx context.Context, email string) error {
+	filter := emailFilter(email)
+	filter["deletedAt"] = nil
+	taken, err := r.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrConflict
+	}
+	return restoreFromTrash(ctx, r.collection, emailFilter(email))
+}
+
+func (r *mongoUserRepository) Purge(ctx context.Context, cutoff time.Time) (int64, error) {
+	return purge(ctx, r.collection, cutoff)
+}
@@ -0,0 +1,148 @@
+// Package search turns user input into safe full-text search terms and
+// highlights the matches in search results.
+//
+// Terms only ever contain letters and digits, so they can be passed to a
+// MongoDB $text query without the user being able to form phrases,
+// negations or regular expressions.
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// MaxTerms is the most terms taken from one query; the rest are ignored.
+const MaxTerms = 10
+
+// Terms splits a query into lowercase words, dropping punctuation, operators
+// and duplicates.
+func Terms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, w := range words(query) {
+		term := strings.ToLower(w.text)
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		terms = append(terms, term)
+		if len(terms) == MaxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// Matches reports whether word matches one of terms. A word matches a term
+// it equals or, for terms of three letters or more, one it starts with, so
+// that "shirt" also finds "shirts".
+func Matches(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if word == term || (len([]rune(term)) >= 3 && strings.HasPrefix(word, term)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns how many words of text match one of terms.
+func Count(text string, terms []string) int {
+	n := 0
+	for _, w := range words(text) {
+		if Matches(w.text, terms) {
+			n++
+		}
+	}
+	return n
+}
+
+// Highlight returns text with every matching word wrapped in <mark> tags and
+// reports whether there was any match. The rest of the text is HTML-escaped,
+// so the result can be inserted into a page as is.
+func Highlight(text string, terms []string) (string, bool) {
+	return highlight(text, words(text), terms)
+}
+
+// Snippet returns the part of text around its first matching word, about
+// width characters long, highlighted like Highlight. Text cut off at either
+// end is replaced by an ellipsis.
+func Snippet(text string, terms []string, width int) (string, bool) {
+	ws := words(text)
+	first := -1
+	for _, w := range ws {
+		if Matches(w.text, terms) {
+			first = w.start
+			break
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	runes := []rune(text)
+	start := max(0, first-width/3)
+	end := min(len(runes), start+width)
+	start = max(0, min(start, end-width))
+	// Move the edges to word boundaries so that no word is cut in half.
+	for start > 0 && start < first && !unicode.IsSpace(runes[start-1]) {
+		start++
+	}
+	for end < len(runes) && end > first && !unicode.IsSpace(runes[end]) {
+		end--
+	}
+
+	part := string(runes[start:end])
+	snippet, _ := highlight(part, words(part), terms)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet, true
+}
+
+type word struct {
+	text       string
+	start, end int // rune offsets
+}
+
+// words splits text into runs of letters and digits.
+func words(text string) []word {
+	var ws []word
+	runes := []rune(text)
+	start := -1
+	for i := 0; i <= len(runes); i++ {
+		inWord := i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]))
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			ws = append(ws, word{text: string(runes[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	return ws
+}
+
+func highlight(text string, ws []word, terms []string) (string, bool) {
+	runes := []rune(text)
+	var b strings.Builder
+	found := false
+	last := 0
+	for _, w := range ws {
+		if !Matches(w.text, terms) {
+			continue
+		}
+		found = true
+		b.WriteString(html.EscapeString(string(runes[last:w.start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(w.text))
+		b.WriteString("</mark>")
+		last = w.end
+	}
+	b.WriteString(html.EscapeString(string(runes[last:])))
+	return b.String(), found
+}
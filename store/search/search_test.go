@@ -0,0 +1,40 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTermsDropOperators(t *testing.T) {
+	got := Terms(`"Slim" -jeans .* (blue|red) jeans Ärmel`)
+	want := []string{"slim", "jeans", "blue", "red", "ärmel"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Terms() = %q, want %q", got, want)
+	}
+	if terms := Terms("$where: {}"); len(terms) != 1 || terms[0] != "where" {
+		t.Errorf("expected only the word of an operator, got %q", terms)
+	}
+}
+
+func TestHighlightEscapesHTML(t *testing.T) {
+	got, ok := Highlight("<b>Blue</b> shirts & tees", []string{"shirt", "blue"})
+	want := "&lt;b&gt;<mark>Blue</mark>&lt;/b&gt; <mark>shirts</mark> &amp; tees"
+	if !ok || got != want {
+		t.Errorf("Highlight() = %q, %v, want %q", got, ok, want)
+	}
+	if _, ok := Highlight("Red dress", []string{"shirt"}); ok {
+		t.Error("expected no match")
+	}
+}
+
+func TestSnippetAroundFirstMatch(t *testing.T) {
+	text := "A classic cut in heavy cotton that keeps its shape wash after wash, finished with a soft collar and a relaxed fit."
+	got, ok := Snippet(text, []string{"collar"}, 40)
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	want := "…with a soft <mark>collar</mark> and a relaxed fit."
+	if got != want {
+		t.Errorf("Snippet() = %q, want %q", got, want)
+	}
+}
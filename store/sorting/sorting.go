@@ -0,0 +1,77 @@
+// Package sorting reads the sort parameter of list endpoints, such as
+// sort=-price,name, against the fields a resource can be sorted by.
+package sorting
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"store/validation"
+)
+
+// Key is one field of a sort order, ascending for Order 1 and descending for
+// Order -1.
+type Key struct {
+	Field string
+	Order int
+}
+
+// Asc and Desc build single-field sort orders.
+func Asc(field string) []Key  { return []Key{{Field: field, Order: 1}} }
+func Desc(field string) []Key { return []Key{{Field: field, Order: -1}} }
+
+// String describes keys the way clients write them, such as "-price,name".
+func String(keys []Key) string {
+	fields := make([]string, len(keys))
+	for i, k := range keys {
+		fields[i] = k.Field
+		if k.Order < 0 {
+			fields[i] = "-" + k.Field
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// Parse reads a comma-separated list of fields, each prefixed with "-" to
+// sort it in descending order. Every field must be one of allowed and appear
+// once. An empty value returns defaults. All invalid fields are reported.
+func Parse(value string, allowed []string, defaults []Key) ([]Key, validation.Errors) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaults, nil
+	}
+
+	var keys []Key
+	var errs validation.Errors
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		// A "+" sent unencoded arrives as a space, so it is trimmed too.
+		k := Key{Field: strings.TrimSpace(part), Order: 1}
+		switch {
+		case strings.HasPrefix(k.Field, "-"):
+			k.Field, k.Order = k.Field[1:], -1
+		case strings.HasPrefix(k.Field, "+"):
+			k.Field = k.Field[1:]
+		}
+
+		switch {
+		case k.Field == "":
+			errs = append(errs, validation.FieldError{Field: "sort", Message: "must not contain empty fields"})
+		case !slices.Contains(allowed, k.Field):
+			errs = append(errs, validation.FieldError{
+				Field:   "sort",
+				Message: fmt.Sprintf("cannot sort by %q; must be one of: %s", k.Field, strings.Join(allowed, ", ")),
+			})
+		case seen[k.Field]:
+			errs = append(errs, validation.FieldError{Field: "sort", Message: fmt.Sprintf("%q is listed more than once", k.Field)})
+		default:
+			seen[k.Field] = true
+			keys = append(keys, k)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return keys, nil
+}
@@ -0,0 +1,46 @@
+package sorting
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	allowed := []string{"id", "name", "price"}
+	defaults := Asc("price")
+
+	for value, want := range map[string][]Key{
+		"":             defaults,
+		"-price,name":  {{Field: "price", Order: -1}, {Field: "name", Order: 1}},
+		" name , +id ": {{Field: "name", Order: 1}, {Field: "id", Order: 1}},
+	} {
+		keys, errs := Parse(value, allowed, defaults)
+		if len(errs) > 0 || !slices.Equal(keys, want) {
+			t.Errorf("Parse(%q) = %v, %v; want %v", value, keys, errs, want)
+		}
+	}
+
+	for value, want := range map[string]int{
+		"password":        1,
+		"-price,,stock":   2,
+		"name,-name":      1,
+		"price,-":         1,
+		"color,size,name": 2,
+	} {
+		keys, errs := Parse(value, allowed, defaults)
+		if keys != nil || len(errs) != want {
+			t.Errorf("Parse(%q) = %v, %v; want %d errors", value, keys, errs, want)
+		}
+		for _, fe := range errs {
+			if fe.Field != "sort" {
+				t.Errorf("Parse(%q) reported field %q", value, fe.Field)
+			}
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	if s := String([]Key{{Field: "price", Order: -1}, {Field: "id", Order: 1}}); s != "-price,id" {
+		t.Errorf("String = %q", s)
+	}
+}
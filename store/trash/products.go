@@ -0,0 +1,52 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"store/images"
+	"store/repository"
+)
+
+// ProductPurger purges the trash of products together with what they leave
+// behind: their stock levels and adjustments, and the blobs of their images
+// that no other product uses.
+type ProductPurger struct {
+	products repository.ProductRepository
+	stock    repository.InventoryRepository
+	images   *images.Store
+}
+
+// NewProductPurger returns a Purger of the products in the trash of
+// products.
+func NewProductPurger(products repository.ProductRepository, stock repository.InventoryRepository, imgs *images.Store) *ProductPurger {
+	return &ProductPurger{products: products, stock: stock, images: imgs}
+}
+
+// Purge removes the products deleted before cutoff and then their stock and
+// images. A product whose stock or images cannot be removed does not stop
+// the others; the failures are returned together.
+func (p *ProductPurger) Purge(ctx context.Context, cutoff time.Time) (int64, error) {
+	purged, err := p.products.Purge(ctx, cutoff)
+	errs := []error{err}
+	for _, product := range purged {
+		if err := p.stock.DeleteProduct(ctx, product.ID); err != nil {
+			errs = append(errs, fmt.Errorf("stock of product %d: %w", product.ID, err))
+		}
+		keys := []string{product.Image}
+		for _, img := range product.Images {
+			keys = append(keys, img.Key)
+		}
+		for _, key := range keys {
+			if key == "" {
+				continue
+			}
+			if err := p.images.Release(ctx, key, p.products); err != nil {
+				errs = append(errs, fmt.Errorf("image %s of product %d: %w", key, product.ID, err))
+			}
+		}
+	}
+	return int64(len(purged)), errors.Join(errs...)
+}
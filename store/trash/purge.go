@@ -0,0 +1,116 @@
+// Package trash permanently removes deleted products and users once they
+// have spent the retention period in the trash.
+package trash
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"store/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Purger permanently removes the items deleted before cutoff and reports how
+// many there were. The user repository and ProductPurger are Purgers.
+type Purger interface {
+	Purge(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Job purges the trash of its Purgers in the background every
+// PurgeInterval.
+type Job struct {
+	purgers map[string]Purger
+	cfg     config.TrashConfig
+	logger  *logrus.Logger
+	now     func() time.Time
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewJob returns a job that purges each of purgers, named for logging. It
+// does nothing until Start is called.
+func NewJob(purgers map[string]Purger, cfg config.TrashConfig, logger *logrus.Logger) *Job {
+	return &Job{
+		purgers: purgers,
+		cfg:     cfg,
+		logger:  logger,
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start purges the trash once right away and then every PurgeInterval until
+// Close is called.
+func (j *Job) Start() {
+	go j.work()
+}
+
+// Close stops the job and waits until a purge in progress has finished or
+// ctx is done.
+func (j *Job) Close(ctx context.Context) error {
+	j.closeOnce.Do(func() { close(j.stop) })
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *Job) work() {
+	defer close(j.done)
+	ticker := time.NewTicker(j.cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-j.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		j.Run(ctx)
+		select {
+		case <-ticker.C:
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// Run purges every Purger once, removing the items deleted more than
+// Retention ago. Failures are logged and do not stop the other Purgers.
+func (j *Job) Run(ctx context.Context) {
+	cutoff := j.now().Add(-j.cfg.Retention)
+	for name, p := range j.purgers {
+		n, err := p.Purge(ctx, cutoff)
+		if err != nil {
+			j.logger.WithFields(logrus.Fields{
+				"action": "purge_trash",
+				"status": "fail",
+				"trash":  name,
+				"count":  n,
+				"error":  err.Error(),
+			}).Error("Failed to purge the trash")
+			continue
+		}
+		if n > 0 {
+			j.logger.WithFields(logrus.Fields{
+				"action": "purge_trash",
+				"status": "success",
+				"trash":  name,
+				"count":  n,
+				"cutoff": cutoff,
+			}).Info("Purged the trash")
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package trash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+
+	"store/blob"
+	"store/config"
+	"store/images"
+	"store/model"
+	"store/money"
+	"store/repository"
+
+	"github.com/sirupsen/logrus"
+)
+
+type recordingPurger struct {
+	cutoffs []time.Time
+	err     error
+}
+
+func (p *recordingPurger) Purge(ctx context.Context, cutoff time.Time) (int64, error) {
+	p.cutoffs = append(p.cutoffs, cutoff)
+	return 1, p.err
+}
+
+func TestRunPurgesPastRetention(t *testing.T) {
+	products, users := &recordingPurger{err: errors.New("unavailable")}, &recordingPurger{}
+	job := NewJob(map[string]Purger{"products": products, "users": users},
+		config.TrashConfig{Retention: 24 * time.Hour, PurgeInterval: time.Hour}, logrus.New())
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	job.now = func() time.Time { return now }
+
+	job.Run(context.Background())
+
+	want := now.Add(-24 * time.Hour)
+	for name, p := range map[string]*recordingPurger{"products": products, "users": users} {
+		if len(p.cutoffs) != 1 || !p.cutoffs[0].Equal(want) {
+			t.Errorf("%s: expected one purge before %v, got %v", name, want, p.cutoffs)
+		}
+	}
+}
+
+func TestCloseStopsTheJob(t *testing.T) {
+	purger := &recordingPurger{}
+	job := NewJob(map[string]Purger{"products": purger}, config.TrashConfig{Retention: time.Hour, PurgeInterval: time.Hour}, logrus.New())
+	job.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := job.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := job.Close(ctx); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+// savePNG stores a w×h PNG image, which gets thumbnails when it is larger
+// than the smallest thumbnail size.
+func savePNG(t *testing.T, store *images.Store, w, h int) model.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	img, err := store.Save(context.Background(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestProductPurgerRemovesImagesAndStock(t *testing.T) {
+	ctx := context.Background()
+	blobs := blob.NewFileStore(t.TempDir(), "/uploads")
+	store := images.NewStore(blobs)
+	products := repository.NewMemoryProductRepository()
+	stock := repository.NewMemoryInventoryRepository()
+
+	own, shared := savePNG(t, store, 200, 100), savePNG(t, store, 300, 100)
+	deleted := model.Product{ID: 1, Name: "Parka", Price: money.Money{Amount: 9000, Currency: "USD"}}
+	deleted.SetImages([]model.Image{own, shared})
+	kept := model.Product{ID: 2, Name: "Coat", Price: money.Money{Amount: 8000, Currency: "USD"}}
+	kept.SetImages([]model.Image{shared})
+	for _, p := range []*model.Product{&deleted, &kept} {
+		if err := products.Import(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stock.Adjust(ctx, p.ID, "", 5); err != nil {
+			t.Fatal(err)
+		}
+		if err := stock.AddAdjustment(ctx, model.StockAdjustment{ProductID: p.ID, Delta: 5}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := products.Delete(ctx, 1, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := NewProductPurger(products, stock, store).Purge(ctx, time.Now().Add(time.Second))
+	if err != nil || n != 1 {
+		t.Fatalf("expected one product purged, got %d %v", n, err)
+	}
+
+	exists := func(key string) bool {
+		ok, err := blobs.Exists(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	for _, key := range append([]string{own.Key}, thumbnailKeys(own)...) {
+		if exists(key) {
+			t.Errorf("expected blob %s of the purged product to be removed", key)
+		}
+	}
+	for _, key := range append([]string{shared.Key}, thumbnailKeys(shared)...) {
+		if !exists(key) {
+			t.Errorf("expected blob %s, still used by another product, to be kept", key)
+		}
+	}
+	if levels, _ := stock.Levels(ctx, 1); len(levels) != 0 {
+		t.Errorf("expected the stock of the purged product to be removed, got %+v", levels)
+	}
+	if adjustments, _ := stock.Adjustments(ctx, 1, ""); len(adjustments) != 0 {
+		t.Errorf("expected the adjustments of the purged product to be removed, got %+v", adjustments)
+	}
+	if levels, _ := stock.Levels(ctx, 2); len(levels) != 1 {
+		t.Errorf("expected the stock of the other product to be kept, got %+v", levels)
+	}
+}
+
+func thumbnailKeys(img model.Image) []string {
+	var keys []string
+	for _, thumb := range img.Thumbnails {
+		keys = append(keys, thumb.Key)
+	}
+	return keys
+}
@@ -0,0 +1,423 @@
+// Package validation decodes request bodies strictly and checks them against
+// rules declared in `validate` struct tags.
+//
+// Supported rules, separated by commas:
+//
+//	required     the field must not be its zero value (or nil for pointers)
+//	omitempty    skip the remaining rules when the field is empty
+//	min=N max=N  length bounds for strings and slices, value bounds for numbers
+//	gt=N gte=N   exclusive and inclusive lower bounds for numbers
+//	lt=N lte=N   exclusive and inclusive upper bounds for numbers
+//	email        the string must be an email address
+//	oneof=a b c  the value must be one of the space-separated options
+//	eqfield=F    the value must equal that of the sibling field F
+//	dive         the rules that follow apply to each element of a slice
+//
+// Pointer fields are validated through the value they point to, so a nil
+// pointer only fails a required rule. Nested structs and slices of structs
+// are validated recursively and their errors are reported with dotted paths.
+//
+// Values implementing Validator report their own problems before any rule
+// is checked, and the bound rules compare values implementing Number
+// exactly instead of as float64.
+package validation
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+// FieldError describes why a single field was rejected. Field uses the JSON
+// name of the field.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Errors collects every rejected field of a request.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validator is implemented by values that know what is wrong with them,
+// such as amounts of money decoded from JSON with more decimal places than
+// their currency has. Validate returns the message of the problem, or "".
+type Validator interface {
+	Validate() string
+}
+
+// Number is implemented by exact numbers, such as amounts of money, which
+// the bound rules compare with their decimal limit without rounding them to
+// float64. CompareDecimal returns -1, 0 or +1.
+type Number interface {
+	CompareDecimal(limit string) int
+}
+
+// DecodeError reports a body that is not a single well-formed JSON object of
+// the expected shape.
+type DecodeError struct {
+	Message string
+}
+
+func (e *DecodeError) Error() string {
+	return e.Message
+}
+
+// DecodeJSON decodes exactly one JSON object from body into dst, rejecting
+// unknown fields and trailing data. Type mismatches on individual fields are
+// returned as Errors so they can be reported alongside rule violations;
+// a body cut off by http.MaxBytesReader is returned unchanged and anything
+// else is returned as a *DecodeError.
+func DecodeJSON(body io.Reader, dst interface{}) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		var syntaxErr *json.SyntaxError
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			return err
+		case errors.Is(err, io.EOF):
+			return &DecodeError{Message: "Request body must not be empty"}
+		case errors.As(err, &typeErr):
+			if typeErr.Field == "" {
+				return &DecodeError{Message: "Request body must be a JSON object"}
+			}
+			return Errors{{Field: typeErr.Field, Message: "must be of type " + jsonType(typeErr.Type)}}
+		case errors.As(err, &syntaxErr):
+			return &DecodeError{Message: fmt.Sprintf("Malformed JSON at position %d", syntaxErr.Offset)}
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			return Errors{{Field: field, Message: "is not a recognised field"}}
+		default:
+			return &DecodeError{Message: "Malformed JSON: " + err.Error()}
+		}
+	}
+
+	if dec.More() {
+		return &DecodeError{Message: "Request body must contain a single JSON object"}
+	}
+	return nil
+}
+
+// DecodeAndValidate decodes body into dst with DecodeJSON and then validates
+// it with Struct.
+func DecodeAndValidate(body io.Reader, dst interface{}) error {
+	if err := DecodeJSON(body, dst); err != nil {
+		return err
+	}
+	if errs := Struct(dst); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Struct checks every field of the struct v points to against its rules and
+// returns all violations, or nil if there are none.
+func Struct(v interface{}) Errors {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs Errors
+	validateStruct(rv, "", &errs)
+	return errs
+}
+
+func validateStruct(rv reflect.Value, prefix string, errs *Errors) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := prefix + jsonName(sf)
+		fv := rv.Field(i)
+
+		if msg := problem(fv); msg != "" {
+			*errs = append(*errs, FieldError{Field: name, Message: msg})
+			continue
+		}
+		if tag := sf.Tag.Get("validate"); tag != "" && tag != "-" {
+			outer, inner, dive := splitDive(tag)
+			if outer != "" {
+				if msg := checkRules(rv, fv, outer); msg != "" {
+					*errs = append(*errs, FieldError{Field: name, Message: msg})
+					continue
+				}
+			}
+			if dive {
+				validateElements(rv, fv, name, inner, errs)
+			}
+		}
+		validateNested(fv, name, errs)
+	}
+}
+
+// splitDive separates the rules that apply to a slice itself from those
+// following "dive", which apply to each of its elements.
+func splitDive(tag string) (outer, inner string, dive bool) {
+	rules := strings.Split(tag, ",")
+	for i, rule := range rules {
+		if rule == "dive" {
+			return strings.Join(rules[:i], ","), strings.Join(rules[i+1:], ","), true
+		}
+	}
+	return tag, "", false
+}
+
+func validateElements(parent reflect.Value, fv reflect.Value, name string, rules string, errs *Errors) {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+	if fv.Kind() != reflect.Slice && fv.Kind() != reflect.Array {
+		return
+	}
+	for i := 0; i < fv.Len(); i++ {
+		if problem(fv.Index(i)) != "" {
+			// validateNested reports it.
+			continue
+		}
+		if msg := checkRules(parent, fv.Index(i), rules); msg != "" {
+			*errs = append(*errs, FieldError{Field: fmt.Sprintf("%s[%d]", name, i), Message: msg})
+		}
+	}
+}
+
+func validateNested(fv reflect.Value, name string, errs *Errors) {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		validateStruct(fv, name+".", errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			el := fv.Index(i)
+			if msg := problem(el); msg != "" {
+				*errs = append(*errs, FieldError{Field: fmt.Sprintf("%s[%d]", name, i), Message: msg})
+				continue
+			}
+			for el.Kind() == reflect.Pointer && !el.IsNil() {
+				el = el.Elem()
+			}
+			if el.Kind() == reflect.Struct {
+				validateStruct(el, fmt.Sprintf("%s[%d].", name, i), errs)
+			}
+		}
+	}
+}
+
+// problem returns what a Validator says is wrong with fv, or "".
+func problem(fv reflect.Value) string {
+	for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+		fv = fv.Elem()
+	}
+	if !fv.IsValid() || !fv.CanInterface() || fv.Kind() == reflect.Pointer {
+		return ""
+	}
+	if v, ok := fv.Interface().(Validator); ok {
+		return v.Validate()
+	}
+	return ""
+}
+
+// checkRules returns the message of the first rule fv violates, or "".
+func checkRules(parent reflect.Value, fv reflect.Value, tag string) string {
+	rules := strings.Split(tag, ",")
+
+	isNil := fv.Kind() == reflect.Pointer && fv.IsNil()
+	for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+		fv = fv.Elem()
+	}
+	empty := isNil || fv.IsZero()
+
+	for _, rule := range rules {
+		name, _, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			if empty {
+				return "is required"
+			}
+		case "omitempty":
+			if empty {
+				return ""
+			}
+		}
+	}
+	if isNil {
+		return ""
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		var msg string
+		switch name {
+		case "required", "omitempty":
+		case "min", "max", "gt", "gte", "lt", "lte":
+			msg = checkBound(fv, name, arg)
+		case "email":
+			if fv.Kind() == reflect.String && !emailPattern.MatchString(fv.String()) {
+				msg = "must be a valid email address"
+			}
+		case "oneof":
+			options := strings.Fields(arg)
+			value := fmt.Sprint(fv.Interface())
+			found := false
+			for _, o := range options {
+				if o == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				msg = "must be one of: " + strings.Join(options, ", ")
+			}
+		case "eqfield":
+			other := parent.FieldByName(arg)
+			if other.IsValid() && !reflect.DeepEqual(fv.Interface(), reflect.Indirect(other).Interface()) {
+				msg = "must match " + jsonNameOf(parent.Type(), arg)
+			}
+		default:
+			panic("validation: unknown rule " + strconv.Quote(name))
+		}
+		if msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+func checkBound(fv reflect.Value, rule string, arg string) string {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic("validation: invalid bound " + strconv.Quote(arg))
+	}
+
+	if fv.CanInterface() {
+		if number, ok := fv.Interface().(Number); ok {
+			return checkLimit(number.CompareDecimal(arg), rule, arg)
+		}
+	}
+
+	var n float64
+	isLength := false
+	switch fv.Kind() {
+	case reflect.String:
+		n, isLength = float64(len([]rune(fv.String()))), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, isLength = float64(fv.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = fv.Float()
+	default:
+		return ""
+	}
+
+	if isLength {
+		switch rule {
+		case "min":
+			if n < limit {
+				return fmt.Sprintf("must be at least %s characters long", arg)
+			}
+		case "max":
+			if n > limit {
+				return fmt.Sprintf("must be at most %s characters long", arg)
+			}
+		}
+		return ""
+	}
+
+	return checkLimit(cmp.Compare(n, limit), rule, arg)
+}
+
+// checkLimit returns the message of a bound rule given how the value
+// compares with its limit arg.
+func checkLimit(c int, rule string, arg string) string {
+	switch rule {
+	case "min", "gte":
+		if c < 0 {
+			return "must be greater than or equal to " + arg
+		}
+	case "max", "lte":
+		if c > 0 {
+			return "must be less than or equal to " + arg
+		}
+	case "gt":
+		if c <= 0 {
+			return "must be greater than " + arg
+		}
+	case "lt":
+		if c >= 0 {
+			return "must be less than " + arg
+		}
+	}
+	return ""
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+func jsonNameOf(rt reflect.Type, field string) string {
+	if sf, ok := rt.FieldByName(field); ok {
+		return jsonName(sf)
+	}
+	return field
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,145 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type item struct {
+	SKU string `json:"sku" validate:"required"`
+	Qty int    `json:"qty" validate:"gt=0"`
+}
+
+type order struct {
+	Email    string   `json:"email" validate:"required,email"`
+	Password string   `json:"password" validate:"required,min=6"`
+	Confirm  string   `json:"confirm" validate:"eqfield=Password"`
+	Size     string   `json:"size" validate:"omitempty,oneof=S M L"`
+	Note     *string  `json:"note" validate:"max=5"`
+	Items    []item   `json:"items"`
+	Tags     []string `json:"tags" validate:"max=3,dive,required,max=4"`
+}
+
+func TestStructReportsEveryViolation(t *testing.T) {
+	long := "far too long"
+	errs := Struct(&order{
+		Email:    "not-an-email",
+		Password: "abc",
+		Confirm:  "abd",
+		Size:     "XL",
+		Note:     &long,
+		Items:    []item{{SKU: "a", Qty: 1}, {Qty: 0}},
+		Tags:     []string{"ok", "", "too long"},
+	})
+
+	want := map[string]string{
+		"email":        "must be a valid email address",
+		"password":     "must be at least 6 characters long",
+		"confirm":      "must match password",
+		"size":         "must be one of: S, M, L",
+		"note":         "must be at most 5 characters long",
+		"items[1].sku": "is required",
+		"items[1].qty": "must be greater than 0",
+		"tags[1]":      "is required",
+		"tags[2]":      "must be at most 4 characters long",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %v", len(want), errs)
+	}
+	for _, e := range errs {
+		if want[e.Field] != e.Message {
+			t.Errorf("%s: expected %q, got %q", e.Field, want[e.Field], e.Message)
+		}
+	}
+}
+
+func TestStructAcceptsValidInput(t *testing.T) {
+	errs := Struct(&order{Email: "a@b.co", Password: "secret", Confirm: "secret"})
+	if errs != nil {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{name: "empty body", body: ""},
+		{name: "malformed", body: `{"email":`},
+		{name: "trailing data", body: `{} {}`},
+		{name: "unknown field", body: `{"admin":true}`, field: "admin"},
+		{name: "wrong type", body: `{"email":42}`, field: "email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst order
+			err := DecodeJSON(strings.NewReader(tt.body), &dst)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			var errs Errors
+			if tt.field == "" {
+				var decodeErr *DecodeError
+				if !errors.As(err, &decodeErr) {
+					t.Fatalf("expected a DecodeError, got %T: %v", err, err)
+				}
+				return
+			}
+			if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Field != tt.field {
+				t.Fatalf("expected a field error on %q, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+// cents is an exact number that may know it was decoded from bad input.
+type cents struct {
+	n       int
+	invalid string
+}
+
+func (c cents) Validate() string { return c.invalid }
+
+func (c cents) CompareDecimal(limit string) int {
+	switch {
+	case limit != "0":
+		panic("unexpected limit " + limit)
+	case c.n < 0:
+		return -1
+	case c.n > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestStructAsksValidatorsAndNumbers(t *testing.T) {
+	errs := Struct(&struct {
+		Price  cents   `json:"price" validate:"required,gt=0"`
+		Free   cents   `json:"free" validate:"gt=0"`
+		Prices []cents `json:"prices" validate:"dive,gt=0"`
+	}{
+		Price:  cents{invalid: "has too many decimal places"},
+		Free:   cents{n: 0},
+		Prices: []cents{{n: 5}, {n: -1}, {invalid: "is not a number"}},
+	})
+
+	want := Errors{
+		{Field: "price", Message: "has too many decimal places"},
+		{Field: "free", Message: "must be greater than 0"},
+		{Field: "prices[1]", Message: "must be greater than 0"},
+		{Field: "prices[2]", Message: "is not a number"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %v, got %v", want, errs)
+	}
+	for i := range want {
+		if errs[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], errs[i])
+		}
+	}
+}
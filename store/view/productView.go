@@ -1,11 +1,9 @@
 package view
 
 import (
-	"encoding/json"
 	"net/http"
 )
 
-func RenderProducts(w http.ResponseWriter, products interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(products)
+func RenderProducts(w http.ResponseWriter, r *http.Request, products interface{}) {
+	Render(w, r, http.StatusOK, products)
 }
@@ -0,0 +1,197 @@
+package view
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"store/requestid"
+	"store/validation"
+)
+
+// ErrorCode is a stable, machine-readable identifier for a class of error.
+// Clients should branch on the code rather than on the message text.
+type ErrorCode string
+
+const (
+	CodeBadRequest         ErrorCode = "BAD_REQUEST"
+	CodeInvalidJSON        ErrorCode = "INVALID_JSON"
+	CodeValidationFailed   ErrorCode = "VALIDATION_FAILED"
+	CodeUnauthorized       ErrorCode = "UNAUTHORIZED"
+	CodeNotFound           ErrorCode = "NOT_FOUND"
+	CodeMethodNotAllowed   ErrorCode = "METHOD_NOT_ALLOWED"
+	CodeConflict           ErrorCode = "CONFLICT"
+	CodePayloadTooLarge    ErrorCode = "PAYLOAD_TOO_LARGE"
+	CodeRateLimited        ErrorCode = "RATE_LIMITED"
+	CodeInternal           ErrorCode = "INTERNAL_ERROR"
+	CodeServiceUnavailable ErrorCode = "SERVICE_UNAVAILABLE"
+)
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is the error half of the response envelope. HTTPStatus selects the
+// response status code and is not serialized.
+type APIError struct {
+	HTTPStatus int          `json:"-"`
+	Code       ErrorCode    `json:"code"`
+	Message    string       `json:"message"`
+	Details    []FieldError `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func NewError(status int, code ErrorCode, message string) *APIError {
+	return &APIError{HTTPStatus: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *APIError {
+	return NewError(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+func InvalidJSON(err error) *APIError {
+	return NewError(http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON format: "+err.Error())
+}
+
+// ValidationFailed reports one or more rejected fields.
+func ValidationFailed(details ...FieldError) *APIError {
+	e := NewError(http.StatusBadRequest, CodeValidationFailed, "Request validation failed")
+	e.Details = details
+	return e
+}
+
+func Unauthorized(message string) *APIError {
+	return NewError(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func NotFound(message string) *APIError {
+	return NewError(http.StatusNotFound, CodeNotFound, message)
+}
+
+func MethodNotAllowed(allowed string) *APIError {
+	return NewError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Only "+allowed+" methods are allowed!")
+}
+
+func Conflict(message string) *APIError {
+	return NewError(http.StatusConflict, CodeConflict, message)
+}
+
+func PayloadTooLarge(limit int64) *APIError {
+	return NewError(http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+		fmt.Sprintf("Request body must not exceed %d bytes", limit))
+}
+
+func RateLimited() *APIError {
+	return NewError(http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded")
+}
+
+func Internal(message string) *APIError {
+	return NewError(http.StatusInternalServerError, CodeInternal, message)
+}
+
+func Timeout() *APIError {
+	return NewError(http.StatusServiceUnavailable, CodeServiceUnavailable, "Request timed out")
+}
+
+// Response is the envelope every JSON endpoint responds with. Status is
+// "success" for 2xx responses, "fail" for client errors and "error" for
+// server errors.
+type Response struct {
+	Status    string      `json:"status"`
+	Message   string      `json:"message,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	Meta      interface{} `json:"meta,omitempty"`
+	Error     *APIError   `json:"error,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+}
+
+// Render writes a success envelope carrying data.
+func Render(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	write(w, r, status, Response{Status: "success", Data: data})
+}
+
+// RenderMessage writes a success envelope carrying only a human-readable
+// message, for actions that have no resource to return.
+func RenderMessage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	write(w, r, status, Response{Status: "success", Message: message})
+}
+
+// RenderList writes a success envelope carrying a collection and the
+// metadata describing it, such as pagination.
+func RenderList(w http.ResponseWriter, r *http.Request, data interface{}, meta interface{}) {
+	write(w, r, http.StatusOK, Response{Status: "success", Data: data, Meta: meta})
+}
+
+// RenderError writes an error envelope. Errors that are not an *APIError are
+// reported as an internal error without exposing their text.
+func RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = Internal("Internal server error")
+	}
+
+	status := "fail"
+	if apiErr.HTTPStatus >= http.StatusInternalServerError {
+		status = "error"
+	}
+	write(w, r, apiErr.HTTPStatus, Response{Status: status, Error: apiErr})
+}
+
+func write(w http.ResponseWriter, r *http.Request, status int, resp Response) {
+	resp.RequestID = requestID(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// requestID returns the ID of the current request, preferring the one stored
+// in the context, then the one sent by the client, and finally a new one that
+// is echoed back in the response headers.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id := requestid.FromContext(r.Context()); id != "" {
+		return id
+	}
+	id := r.Header.Get(requestid.Header)
+	if id == "" {
+		id = requestid.New()
+	}
+	w.Header().Set(requestid.Header, id)
+	return id
+}
+
+// RequestError converts the errors returned by the validation package into
+// the error envelope: field violations become VALIDATION_FAILED details and
+// malformed bodies become INVALID_JSON. Bodies cut off by a size limit become
+// PAYLOAD_TOO_LARGE.
+func RequestError(err error) *APIError {
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		details := make([]FieldError, len(fieldErrs))
+		for i, fe := range fieldErrs {
+			details[i] = FieldError{Field: fe.Field, Message: fe.Message}
+		}
+		return ValidationFailed(details...)
+	}
+
+	var decodeErr *validation.DecodeError
+	if errors.As(err, &decodeErr) {
+		return NewError(http.StatusBadRequest, CodeInvalidJSON, decodeErr.Message)
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return PayloadTooLarge(tooLarge.Limit)
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return BadRequest(err.Error())
+}
@@ -0,0 +1,54 @@
+package view
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"store/requestid"
+)
+
+func TestRenderErrorEnvelope(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/v1/products", nil)
+	req.Header.Set(requestid.Header, "req-123")
+	rr := httptest.NewRecorder()
+
+	RenderError(rr, req, ValidationFailed(FieldError{Field: "price", Message: "'price' must be a positive number"}))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %v, got %v", http.StatusBadRequest, rr.Code)
+	}
+	var resp Response
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "fail" || resp.RequestID != "req-123" {
+		t.Errorf("unexpected envelope %+v", resp)
+	}
+	if resp.Error == nil || resp.Error.Code != CodeValidationFailed || len(resp.Error.Details) != 1 || resp.Error.Details[0].Field != "price" {
+		t.Errorf("unexpected error %+v", resp.Error)
+	}
+}
+
+func TestRenderErrorHidesInternalErrors(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/products", nil)
+	rr := httptest.NewRecorder()
+
+	RenderError(rr, req, errors.New("connection refused to 10.0.0.5"))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %v, got %v", http.StatusInternalServerError, rr.Code)
+	}
+	var resp Response
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "error" || resp.Error.Code != CodeInternal || resp.Error.Message != "Internal server error" {
+		t.Errorf("unexpected envelope %+v", resp)
+	}
+	if resp.RequestID == "" || rr.Header().Get(requestid.Header) != resp.RequestID {
+		t.Errorf("expected generated request ID to be echoed, got %q and %q", resp.RequestID, rr.Header().Get(requestid.Header))
+	}
+}
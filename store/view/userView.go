@@ -1,11 +1,9 @@
 package view
 
 import (
-	"encoding/json"
 	"net/http"
 )
 
-func RenderUsers(w http.ResponseWriter, users interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+func RenderUsers(w http.ResponseWriter, r *http.Request, users interface{}) {
+	Render(w, r, http.StatusOK, users)
 }